@@ -16,6 +16,8 @@ type config struct {
 	consumerServiceName string
 	producerServiceName string
 	analyticsRate       float64
+	groupID             string
+	dataStreams         bool
 }
 
 func defaults(cfg *config) {
@@ -30,6 +32,7 @@ func defaults(cfg *config) {
 	} else {
 		cfg.analyticsRate = math.NaN()
 	}
+	cfg.dataStreams = internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false)
 }
 
 // An Option is used to customize the config for the sarama tracer.
@@ -65,3 +68,26 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithGroupID sets the ID of the consumer group, with which the spans started by
+// the handlers wrapped using WrapConsumerGroupHandler are tagged.
+func WithGroupID(groupID string) Option {
+	return func(cfg *config) {
+		cfg.groupID = groupID
+	}
+}
+
+// WithDataStreams enables the measurement of the latency of messages across the
+// pipeline: producers stamp the messages with a pathway and consumers report the
+// time elapsed since the messages were produced, for each topic, partition and
+// consumer group. The pathway of a consumed message is continued by the messages
+// produced while processing it when it is passed along using ContextWithPathway and
+// InjectPathway. When a group is set using WithGroupID, the lag of the consumer
+// group, which is the difference between the high watermark of each claimed
+// partition and the offset marked on it, is reported as well. It can also be
+// enabled by setting DD_DATA_STREAMS_ENABLED.
+func WithDataStreams() Option {
+	return func(cfg *config) {
+		cfg.dataStreams = true
+	}
+}
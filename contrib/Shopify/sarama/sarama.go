@@ -7,11 +7,14 @@
 package sarama // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/Shopify/sarama"
 
 import (
+	"context"
+	"fmt"
 	"math"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
 	"github.com/Shopify/sarama"
@@ -41,46 +44,171 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, opts ...Option) sarama.P
 		PartitionConsumer: pc,
 		messages:          make(chan *sarama.ConsumerMessage),
 	}
-	go func() {
-		msgs := pc.Messages()
-		var prev ddtrace.Span
-		for msg := range msgs {
-			// create the next span from the message
-			opts := []tracer.StartSpanOption{
-				tracer.ServiceName(cfg.consumerServiceName),
-				tracer.ResourceName("Consume Topic " + msg.Topic),
-				tracer.SpanType(ext.SpanTypeMessageConsumer),
-				tracer.Tag("partition", msg.Partition),
-				tracer.Tag("offset", msg.Offset),
-				tracer.Measured(),
-			}
-			if !math.IsNaN(cfg.analyticsRate) {
-				opts = append(opts, tracer.Tag(ext.EventSampleRate, cfg.analyticsRate))
-			}
-			// kafka supports headers, so try to extract a span context
-			carrier := NewConsumerMessageCarrier(msg)
-			if spanctx, err := tracer.Extract(carrier); err == nil {
-				opts = append(opts, tracer.ChildOf(spanctx))
-			}
-			next := tracer.StartSpan("kafka.consume", opts...)
-			// reinject the span context so consumers can pick it up
-			tracer.Inject(next.Context(), carrier)
-
-			wrapped.messages <- msg
+	go traceMessages(cfg, pc.Messages(), wrapped.messages, nil)
+	return wrapped
+}
 
-			// if the next message was received, finish the previous span
-			if prev != nil {
-				prev.Finish()
+// traceMessages sends the messages received from in to out, starting a span for
+// each one of them which is finished when the next message is received. It
+// returns, closing out and finishing any remaining span, when in or done is
+// closed.
+func traceMessages(cfg *config, in <-chan *sarama.ConsumerMessage, out chan<- *sarama.ConsumerMessage, done <-chan struct{}) {
+	var prev ddtrace.Span
+	defer func() {
+		// finish any remaining span
+		if prev != nil {
+			prev.Finish()
+		}
+		close(out)
+	}()
+	for {
+		var msg *sarama.ConsumerMessage
+		select {
+		case m, ok := <-in:
+			if !ok {
+				return
 			}
-			prev = next
+			msg = m
+		case <-done:
+			return
 		}
-		// finish any remaining span
+		// create the next span from the message
+		opts := []tracer.StartSpanOption{
+			tracer.ServiceName(cfg.consumerServiceName),
+			tracer.ResourceName("Consume Topic " + msg.Topic),
+			tracer.SpanType(ext.SpanTypeMessageConsumer),
+			tracer.Tag("topic", msg.Topic),
+			tracer.Tag("partition", msg.Partition),
+			tracer.Tag("offset", msg.Offset),
+			tracer.Measured(),
+		}
+		if cfg.groupID != "" {
+			opts = append(opts, tracer.Tag("group", cfg.groupID))
+		}
+		if !math.IsNaN(cfg.analyticsRate) {
+			opts = append(opts, tracer.Tag(ext.EventSampleRate, cfg.analyticsRate))
+		}
+		// kafka supports headers, so try to extract a span context
+		carrier := NewConsumerMessageCarrier(msg)
+		if spanctx, err := tracer.Extract(carrier); err == nil {
+			opts = append(opts, tracer.ChildOf(spanctx))
+		}
+		next := tracer.StartSpan("kafka.consume", opts...)
+		// reinject the span context so consumers can pick it up
+		tracer.Inject(next.Context(), carrier)
+		if cfg.dataStreams {
+			setConsumeCheckpoint(cfg, msg)
+		}
+
+		select {
+		case out <- msg:
+		case <-done:
+			// the message was never delivered, so its span is
+			// dropped rather than finished.
+			return
+		}
+
+		// if the next message was received, finish the previous span
 		if prev != nil {
 			prev.Finish()
 		}
-		close(wrapped.messages)
+		prev = next
+	}
+}
+
+type consumerGroupHandler struct {
+	sarama.ConsumerGroupHandler
+	cfg *config
+}
+
+// ConsumeClaim calls the ConsumeClaim method of the wrapped handler, with a claim
+// whose messages are traced. The span of the last message is finished when the
+// wrapped handler returns, ending the session.
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	wrapped := &consumerGroupClaim{
+		ConsumerGroupClaim: claim,
+		messages:           make(chan *sarama.ConsumerMessage),
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		traceMessages(h.cfg, claim.Messages(), wrapped.messages, done)
+		close(finished)
 	}()
-	return wrapped
+	if h.cfg.dataStreams && h.cfg.groupID != "" && session != nil {
+		session = &consumerGroupSession{
+			ConsumerGroupSession: session,
+			cfg:                  h.cfg,
+			claim:                claim,
+		}
+	}
+	err := h.ConsumerGroupHandler.ConsumeClaim(session, wrapped)
+	close(done)
+	<-finished
+	return err
+}
+
+// consumerGroupSession wraps the session of a claim, tracking the offsets marked
+// on it along with the high watermark of the claimed partition, so that the lag
+// of the consumer group is reported.
+type consumerGroupSession struct {
+	sarama.ConsumerGroupSession
+	cfg   *config
+	claim sarama.ConsumerGroupClaim
+}
+
+// MarkOffset calls the MarkOffset method of the wrapped session and tracks offset.
+func (s *consumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.ConsumerGroupSession.MarkOffset(topic, partition, offset, metadata)
+	s.trackOffset(topic, partition, offset)
+}
+
+// MarkMessage calls the MarkMessage method of the wrapped session and tracks the
+// offset following the one of msg, which is the one it marks.
+func (s *consumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.ConsumerGroupSession.MarkMessage(msg, metadata)
+	s.trackOffset(msg.Topic, msg.Partition, msg.Offset+1)
+}
+
+// ResetOffset calls the ResetOffset method of the wrapped session and tracks
+// offset.
+func (s *consumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.ConsumerGroupSession.ResetOffset(topic, partition, offset, metadata)
+	s.trackOffset(topic, partition, offset)
+}
+
+func (s *consumerGroupSession) trackOffset(topic string, partition int32, offset int64) {
+	datastreams.TrackKafkaCommitOffset(s.cfg.groupID, topic, partition, offset)
+	if topic == s.claim.Topic() && partition == s.claim.Partition() {
+		datastreams.TrackKafkaHighWatermarkOffset(topic, partition, s.claim.HighWaterMarkOffset())
+	}
+}
+
+type consumerGroupClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+// Messages returns the read channel for the messages of the claim.
+func (c *consumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// WrapConsumerGroupHandler wraps a sarama.ConsumerGroupHandler causing each
+// message received through the claims passed to its ConsumeClaim method to be
+// traced. The spans are tagged with the topic, partition and offset of their
+// messages and with the group set using WithGroupID.
+func WrapConsumerGroupHandler(handler sarama.ConsumerGroupHandler, opts ...Option) sarama.ConsumerGroupHandler {
+	cfg := new(config)
+	defaults(cfg)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	log.Debug("contrib/Shopify/sarama: Wrapping Consumer Group Handler: %#v", cfg)
+	return &consumerGroupHandler{
+		ConsumerGroupHandler: handler,
+		cfg:                  cfg,
+	}
 }
 
 type consumer struct {
@@ -270,10 +398,63 @@ func startProducerSpan(cfg *config, version sarama.KafkaVersion, msg *sarama.Pro
 	if version.IsAtLeast(sarama.V0_11_0_0) {
 		// re-inject the span context so consumers can pick it up
 		tracer.Inject(span.Context(), carrier)
+		if cfg.dataStreams {
+			setProduceCheckpoint(msg)
+		}
 	}
 	return span
 }
 
+// ContextWithPathway returns a copy of ctx carrying the data streams pathway of msg,
+// which is set when msg is received from a consumer wrapped with data streams
+// enabled (see WithDataStreams). Passing the returned context to InjectPathway when
+// producing messages while processing msg makes their pathway continue the one of
+// msg, so that the latency is measured across the whole pipeline rather than from
+// the last producer.
+func ContextWithPathway(ctx context.Context, msg *sarama.ConsumerMessage) context.Context {
+	p := datastreams.ExtractPathway(NewConsumerMessageCarrier(msg))
+	if p.IsZero() {
+		return ctx
+	}
+	return datastreams.ContextWithPathway(ctx, p)
+}
+
+// InjectPathway sets the data streams pathway carried by ctx, if any, on msg, so
+// that it is continued when msg is sent through a producer wrapped with data
+// streams enabled. See ContextWithPathway.
+func InjectPathway(ctx context.Context, msg *sarama.ProducerMessage) {
+	if p, ok := datastreams.PathwayFromContext(ctx); ok {
+		datastreams.InjectPathway(NewProducerMessageCarrier(msg), p)
+	}
+}
+
+// setProduceCheckpoint stamps msg with its pathway, continuing the one found in
+// its headers, if any, such as the one set by InjectPathway.
+func setProduceCheckpoint(msg *sarama.ProducerMessage) {
+	carrier := NewProducerMessageCarrier(msg)
+	parent := datastreams.ExtractPathway(carrier)
+	p := datastreams.Checkpoint(parent, "direction:out", "topic:"+msg.Topic, "type:kafka")
+	datastreams.InjectPathway(carrier, p)
+}
+
+// setConsumeCheckpoint records the latency of msg since it was produced, and
+// updates its pathway so that it can be forwarded further.
+func setConsumeCheckpoint(cfg *config, msg *sarama.ConsumerMessage) {
+	carrier := NewConsumerMessageCarrier(msg)
+	parent := datastreams.ExtractPathway(carrier)
+	edgeTags := []string{
+		"direction:in",
+		"topic:" + msg.Topic,
+		fmt.Sprintf("partition:%d", msg.Partition),
+		"type:kafka",
+	}
+	if cfg.groupID != "" {
+		edgeTags = append(edgeTags, "group:"+cfg.groupID)
+	}
+	p := datastreams.Checkpoint(parent, edgeTags...)
+	datastreams.InjectPathway(carrier, p)
+}
+
 func finishProducerSpan(span ddtrace.Span, partition int32, offset int64, err error) {
 	span.SetTag("partition", partition)
 	span.SetTag("offset", offset)
@@ -13,6 +13,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 
 	"github.com/Shopify/sarama"
 	"github.com/stretchr/testify/assert"
@@ -71,6 +72,7 @@ func TestConsumer(t *testing.T) {
 		assert.Equal(t, spanctx.TraceID(), s.TraceID(),
 			"span context should be injected into the consumer message headers")
 
+		assert.Equal(t, "test-topic", s.Tag("topic"))
 		assert.Equal(t, int32(0), s.Tag("partition"))
 		assert.Equal(t, int64(0), s.Tag("offset"))
 		assert.Equal(t, "kafka", s.Tag(ext.ServiceName))
@@ -94,6 +96,170 @@ func TestConsumer(t *testing.T) {
 	}
 }
 
+// testConsumerGroupClaim is a sarama.ConsumerGroupClaim receiving the messages
+// sent to its channel.
+type testConsumerGroupClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+	first    *sarama.ConsumerMessage
+}
+
+func (c *testConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+func (c *testConsumerGroupClaim) Topic() string                            { return "test-topic" }
+func (c *testConsumerGroupClaim) Partition() int32                         { return 1 }
+func (c *testConsumerGroupClaim) HighWaterMarkOffset() int64               { return 10 }
+
+// testConsumerGroupSession is a sarama.ConsumerGroupSession recording the offsets
+// marked on it.
+type testConsumerGroupSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *testConsumerGroupSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset)
+}
+
+func (s *testConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// testConsumerGroupHandler is a sarama.ConsumerGroupHandler which consumes n
+// messages before returning, or all of them if n is negative.
+type testConsumerGroupHandler struct {
+	n    int
+	msgs []*sarama.ConsumerMessage
+}
+
+func (h *testConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *testConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *testConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		h.msgs = append(h.msgs, msg)
+		if session != nil {
+			session.MarkMessage(msg, "")
+		}
+		if len(h.msgs) == h.n {
+			break
+		}
+	}
+	return nil
+}
+
+func TestConsumerGroupHandler(t *testing.T) {
+	newClaim := func(n int) *testConsumerGroupClaim {
+		claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, n)}
+		for i := 0; i < n; i++ {
+			msg := &sarama.ConsumerMessage{Topic: "test-topic", Partition: 1, Offset: int64(i)}
+			if i == 0 {
+				claim.first = msg
+			}
+			claim.messages <- msg
+		}
+		return claim
+	}
+
+	t.Run("session-end", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		claim := newClaim(3)
+		// propagate a trace from the producer through the headers of the first message
+		parent := tracer.StartSpan("produce")
+		assert.NoError(t, tracer.Inject(parent.Context(), NewConsumerMessageCarrier(claim.first)))
+
+		h := &testConsumerGroupHandler{n: 2}
+		handler := WrapConsumerGroupHandler(h, WithGroupID("test-group"))
+		assert.NoError(t, handler.ConsumeClaim(nil, claim))
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 2)
+		for i, s := range spans {
+			assert.Equal(t, "kafka.consume", s.OperationName())
+			assert.Equal(t, "Consume Topic test-topic", s.Tag(ext.ResourceName))
+			assert.Equal(t, "test-topic", s.Tag("topic"))
+			assert.Equal(t, int32(1), s.Tag("partition"))
+			assert.Equal(t, int64(i), s.Tag("offset"))
+			assert.Equal(t, "test-group", s.Tag("group"))
+
+			spanctx, err := tracer.Extract(NewConsumerMessageCarrier(h.msgs[i]))
+			assert.NoError(t, err)
+			assert.Equal(t, s.SpanID(), spanctx.SpanID(),
+				"span context should be injected into the consumer message headers")
+		}
+		assert.Equal(t, parent.Context().TraceID(), spans[0].TraceID())
+		assert.Equal(t, parent.Context().SpanID(), spans[0].ParentID())
+	})
+
+	t.Run("claim-end", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		claim := newClaim(2)
+		close(claim.messages)
+		h := &testConsumerGroupHandler{n: -1}
+		assert.NoError(t, WrapConsumerGroupHandler(h).ConsumeClaim(nil, claim))
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 2)
+		assert.Len(t, h.msgs, 2)
+		assert.Nil(t, spans[0].Tag("group"))
+	})
+}
+
+func TestDataStreams(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := new(config)
+	defaults(cfg)
+	WithDataStreams()(cfg)
+	pmsg := &sarama.ProducerMessage{Topic: "test-topic"}
+	startProducerSpan(cfg, sarama.V0_11_0_0, pmsg).Finish()
+	produced := datastreams.ExtractPathway(NewProducerMessageCarrier(pmsg))
+	assert.False(t, produced.IsZero(), "the pathway should be injected into the producer message headers")
+
+	cmsg := &sarama.ConsumerMessage{Topic: "test-topic", Partition: 1}
+	for i := range pmsg.Headers {
+		cmsg.Headers = append(cmsg.Headers, &pmsg.Headers[i])
+	}
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- cmsg
+	close(claim.messages)
+	h := &testConsumerGroupHandler{n: -1}
+	handler := WrapConsumerGroupHandler(h, WithGroupID("test-group"), WithDataStreams())
+	assert.NoError(t, handler.ConsumeClaim(nil, claim))
+
+	consumed := datastreams.ExtractPathway(NewConsumerMessageCarrier(h.msgs[0]))
+	assert.NotEqual(t, produced.Hash, consumed.Hash)
+	assert.True(t, produced.PathwayStart.Equal(consumed.PathwayStart))
+	assert.False(t, consumed.EdgeStart.Before(produced.EdgeStart))
+
+	// a message produced while processing the consumed one continues its pathway
+	ctx := ContextWithPathway(context.Background(), h.msgs[0])
+	next := &sarama.ProducerMessage{Topic: "next-topic"}
+	InjectPathway(ctx, next)
+	startProducerSpan(cfg, sarama.V0_11_0_0, next).Finish()
+	forwarded := datastreams.ExtractPathway(NewProducerMessageCarrier(next))
+	assert.NotEqual(t, consumed.Hash, forwarded.Hash)
+	assert.True(t, produced.PathwayStart.Equal(forwarded.PathwayStart))
+}
+
+func TestDataStreamsLag(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "test-topic", Partition: 1, Offset: 4}
+	close(claim.messages)
+	session := &testConsumerGroupSession{}
+	h := &testConsumerGroupHandler{n: -1}
+	handler := WrapConsumerGroupHandler(h, WithGroupID("test-group"), WithDataStreams())
+	assert.NoError(t, handler.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{5}, session.marked, "the offsets should be marked on the wrapped session")
+}
+
 func TestSyncProducer(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -7,23 +7,32 @@
 package kafka // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/confluentinc/confluent-kafka-go/kafka"
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-// NewConsumer calls kafka.NewConsumer and wraps the resulting Consumer.
+// NewConsumer calls kafka.NewConsumer and wraps the resulting Consumer. The
+// consumer group found in conf is used to report data streams metrics.
 func NewConsumer(conf *kafka.ConfigMap, opts ...Option) (*Consumer, error) {
 	c, err := kafka.NewConsumer(conf)
 	if err != nil {
 		return nil, err
 	}
+	if group, err := conf.Get("group.id", ""); err == nil {
+		if id, ok := group.(string); ok {
+			opts = append([]Option{func(cfg *config) { cfg.groupID = id }}, opts...)
+		}
+	}
 	return WrapConsumer(c, opts...), nil
 }
 
@@ -67,9 +76,12 @@ func (c *Consumer) traceEventsChannel(in chan kafka.Event) chan kafka.Event {
 		for evt := range in {
 			var next ddtrace.Span
 
-			// only trace messages
-			if msg, ok := evt.(*kafka.Message); ok {
-				next = c.startSpan(msg)
+			// trace messages and track the offsets committed automatically
+			switch e := evt.(type) {
+			case *kafka.Message:
+				next = c.startSpan(e)
+			case kafka.OffsetsCommitted:
+				c.trackCommits(e.Offsets, e.Error)
 			}
 
 			out <- evt
@@ -109,9 +121,57 @@ func (c *Consumer) startSpan(msg *kafka.Message) ddtrace.Span {
 	span, _ := tracer.StartSpanFromContext(c.cfg.ctx, "kafka.consume", opts...)
 	// reinject the span context so consumers can pick it up
 	tracer.Inject(span.Context(), carrier)
+	if c.cfg.dataStreams {
+		setConsumeCheckpoint(c.cfg, msg)
+		c.trackHighWatermark(msg.TopicPartition)
+	}
 	return span
 }
 
+// trackHighWatermark tracks the high watermark of the partition tp, as last
+// fetched by the consumer, to report the lag of its consumer group.
+func (c *Consumer) trackHighWatermark(tp kafka.TopicPartition) {
+	if c.cfg.groupID == "" || tp.Topic == nil {
+		return
+	}
+	if _, high, err := c.Consumer.GetWatermarkOffsets(*tp.Topic, tp.Partition); err == nil && high >= 0 {
+		datastreams.TrackKafkaHighWatermarkOffset(*tp.Topic, tp.Partition, high)
+	}
+}
+
+// trackCommits tracks the offsets committed by the consumer, to report the lag
+// of its consumer group.
+func (c *Consumer) trackCommits(tps []kafka.TopicPartition, err error) {
+	if err != nil || !c.cfg.dataStreams || c.cfg.groupID == "" {
+		return
+	}
+	for _, tp := range tps {
+		if tp.Error != nil || tp.Topic == nil || tp.Offset < 0 {
+			// the partition has no committed offset
+			continue
+		}
+		datastreams.TrackKafkaCommitOffset(c.cfg.groupID, *tp.Topic, tp.Partition, int64(tp.Offset))
+	}
+}
+
+// setConsumeCheckpoint records the latency of msg since it was produced, and
+// updates its pathway so that it can be forwarded further.
+func setConsumeCheckpoint(cfg *config, msg *kafka.Message) {
+	carrier := NewMessageCarrier(msg)
+	parent := datastreams.ExtractPathway(carrier)
+	edgeTags := []string{
+		"direction:in",
+		"topic:" + *msg.TopicPartition.Topic,
+		fmt.Sprintf("partition:%d", msg.TopicPartition.Partition),
+		"type:kafka",
+	}
+	if cfg.groupID != "" {
+		edgeTags = append(edgeTags, "group:"+cfg.groupID)
+	}
+	p := datastreams.Checkpoint(parent, edgeTags...)
+	datastreams.InjectPathway(carrier, p)
+}
+
 // Close calls the underlying Consumer.Close and if polling is enabled, finishes
 // any remaining span.
 func (c *Consumer) Close() error {
@@ -140,12 +200,39 @@ func (c *Consumer) Poll(timeoutMS int) (event kafka.Event) {
 		c.prev = nil
 	}
 	evt := c.Consumer.Poll(timeoutMS)
-	if msg, ok := evt.(*kafka.Message); ok {
-		c.prev = c.startSpan(msg)
+	switch e := evt.(type) {
+	case *kafka.Message:
+		c.prev = c.startSpan(e)
+	case kafka.OffsetsCommitted:
+		c.trackCommits(e.Offsets, e.Error)
 	}
 	return evt
 }
 
+// Commit calls the underlying Consumer.Commit and, when data streams are enabled,
+// tracks the committed offsets to report the lag of the consumer group.
+func (c *Consumer) Commit() ([]kafka.TopicPartition, error) {
+	tps, err := c.Consumer.Commit()
+	c.trackCommits(tps, err)
+	return tps, err
+}
+
+// CommitMessage calls the underlying Consumer.CommitMessage and, when data streams
+// are enabled, tracks the committed offsets to report the lag of the consumer group.
+func (c *Consumer) CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error) {
+	tps, err := c.Consumer.CommitMessage(msg)
+	c.trackCommits(tps, err)
+	return tps, err
+}
+
+// CommitOffsets calls the underlying Consumer.CommitOffsets and, when data streams
+// are enabled, tracks the committed offsets to report the lag of the consumer group.
+func (c *Consumer) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	tps, err := c.Consumer.CommitOffsets(offsets)
+	c.trackCommits(tps, err)
+	return tps, err
+}
+
 // ReadMessage polls the consumer for a message. Message will be traced.
 func (c *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
 	if c.prev != nil {
@@ -209,9 +296,44 @@ func (p *Producer) startSpan(msg *kafka.Message) ddtrace.Span {
 	span, _ := tracer.StartSpanFromContext(p.cfg.ctx, "kafka.produce", opts...)
 	// inject the span context so consumers can pick it up
 	tracer.Inject(span.Context(), carrier)
+	if p.cfg.dataStreams {
+		setProduceCheckpoint(msg)
+	}
 	return span
 }
 
+// ContextWithPathway returns a copy of ctx carrying the data streams pathway of the
+// consumed message msg, which is set when msg is received from a consumer wrapped
+// with data streams enabled (see WithDataStreams). Passing the returned context to
+// InjectPathway when producing messages while processing msg makes their pathway
+// continue the one of msg, so that the latency is measured across the whole
+// pipeline rather than from the last producer.
+func ContextWithPathway(ctx context.Context, msg *kafka.Message) context.Context {
+	p := datastreams.ExtractPathway(NewMessageCarrier(msg))
+	if p.IsZero() {
+		return ctx
+	}
+	return datastreams.ContextWithPathway(ctx, p)
+}
+
+// InjectPathway sets the data streams pathway carried by ctx, if any, on the
+// message msg to be produced, so that it is continued when msg is sent through a
+// producer wrapped with data streams enabled. See ContextWithPathway.
+func InjectPathway(ctx context.Context, msg *kafka.Message) {
+	if p, ok := datastreams.PathwayFromContext(ctx); ok {
+		datastreams.InjectPathway(NewMessageCarrier(msg), p)
+	}
+}
+
+// setProduceCheckpoint stamps msg with its pathway, continuing the one found in
+// its headers, if any, such as the one set by InjectPathway.
+func setProduceCheckpoint(msg *kafka.Message) {
+	carrier := NewMessageCarrier(msg)
+	parent := datastreams.ExtractPathway(carrier)
+	p := datastreams.Checkpoint(parent, "direction:out", "topic:"+*msg.TopicPartition.Topic, "type:kafka")
+	datastreams.InjectPathway(carrier, p)
+}
+
 // Close calls the underlying Producer.Close and also closes the internal
 // wrapping producer channel.
 func (p *Producer) Close() {
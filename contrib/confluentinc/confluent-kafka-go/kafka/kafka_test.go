@@ -6,6 +6,7 @@
 package kafka
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
@@ -13,6 +14,7 @@ import (
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 
@@ -207,3 +209,30 @@ func TestConsumerFunctional(t *testing.T) {
 		})
 	}
 }
+
+func TestDataStreamsCheckpoints(t *testing.T) {
+	topic := testTopic
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1},
+	}
+	setProduceCheckpoint(msg)
+	produced := datastreams.ExtractPathway(NewMessageCarrier(msg))
+	assert.False(t, produced.IsZero(), "the pathway should be injected into the message headers")
+
+	setConsumeCheckpoint(newConfig(func(cfg *config) { cfg.groupID = testGroupID }), msg)
+	consumed := datastreams.ExtractPathway(NewMessageCarrier(msg))
+	assert.NotEqual(t, produced.Hash, consumed.Hash)
+	assert.True(t, produced.PathwayStart.Equal(consumed.PathwayStart))
+	assert.Len(t, msg.Headers, 1)
+
+	// a message produced while processing the consumed one continues its pathway
+	nextTopic := "next-topic"
+	next := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &nextTopic},
+	}
+	InjectPathway(ContextWithPathway(context.Background(), msg), next)
+	setProduceCheckpoint(next)
+	forwarded := datastreams.ExtractPathway(NewMessageCarrier(next))
+	assert.NotEqual(t, consumed.Hash, forwarded.Hash)
+	assert.True(t, produced.PathwayStart.Equal(forwarded.PathwayStart))
+}
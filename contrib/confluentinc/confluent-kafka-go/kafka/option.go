@@ -18,6 +18,8 @@ type config struct {
 	consumerServiceName string
 	producerServiceName string
 	analyticsRate       float64
+	dataStreams         bool
+	groupID             string
 }
 
 // An Option customizes the config.
@@ -34,6 +36,7 @@ func newConfig(opts ...Option) *config {
 	if internal.BoolEnv("DD_TRACE_KAFKA_ANALYTICS_ENABLED", false) {
 		cfg.analyticsRate = 1.0
 	}
+	cfg.dataStreams = internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false)
 	if svc := globalconfig.ServiceName(); svc != "" {
 		cfg.consumerServiceName = svc
 	}
@@ -80,3 +83,17 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithDataStreams enables the measurement of the latency of messages across the
+// pipeline: producers stamp the messages with a pathway and consumers report the
+// time elapsed since the messages were produced, for each topic, partition and
+// consumer group. The pathway of a consumed message is continued by the messages
+// produced while processing it when it is passed along using ContextWithPathway and
+// InjectPathway. The lag of the consumer group, which is the difference between
+// the high watermark of each consumed partition and the offset committed on it,
+// is reported as well. It can also be enabled by setting DD_DATA_STREAMS_ENABLED.
+func WithDataStreams() Option {
+	return func(cfg *config) {
+		cfg.dataStreams = true
+	}
+}
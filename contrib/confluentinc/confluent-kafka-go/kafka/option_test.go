@@ -7,6 +7,7 @@ package kafka
 
 import (
 	"math"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -43,3 +44,22 @@ func TestAnalyticsSettings(t *testing.T) {
 		assert.Equal(t, 0.2, cfg.analyticsRate)
 	})
 }
+
+func TestDataStreamsSettings(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := newConfig()
+		assert.False(t, cfg.dataStreams)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_DATA_STREAMS_ENABLED", "true")
+		defer os.Unsetenv("DD_DATA_STREAMS_ENABLED")
+		cfg := newConfig()
+		assert.True(t, cfg.dataStreams)
+	})
+
+	t.Run("option", func(t *testing.T) {
+		cfg := newConfig(WithDataStreams())
+		assert.True(t, cfg.dataStreams)
+	})
+}
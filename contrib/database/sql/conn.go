@@ -10,8 +10,10 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -22,14 +24,16 @@ var _ driver.Conn = (*tracedConn)(nil)
 type queryType string
 
 const (
-	queryTypeQuery    queryType = "Query"
-	queryTypePing               = "Ping"
-	queryTypePrepare            = "Prepare"
-	queryTypeExec               = "Exec"
-	queryTypeBegin              = "Begin"
-	queryTypeClose              = "Close"
-	queryTypeCommit             = "Commit"
-	queryTypeRollback           = "Rollback"
+	queryTypeQuery       queryType = "Query"
+	queryTypePing                  = "Ping"
+	queryTypePrepare               = "Prepare"
+	queryTypeExec                  = "Exec"
+	queryTypeBegin                 = "Begin"
+	queryTypeClose                 = "Close"
+	queryTypeCommit                = "Commit"
+	queryTypeRollback              = "Rollback"
+	queryTypeConnect               = "Connect"
+	queryTypeTransaction           = "Transaction"
 )
 
 type tracedConn struct {
@@ -39,33 +43,44 @@ type tracedConn struct {
 
 func (tc *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
 	start := time.Now()
+	var begin time.Time
+	if tc.cfg.txSpans != nil && *tc.cfg.txSpans {
+		begin = start
+	}
 	if connBeginTx, ok := tc.Conn.(driver.ConnBeginTx); ok {
 		tx, err = connBeginTx.BeginTx(ctx, opts)
 		tc.tryTrace(ctx, queryTypeBegin, "", start, err)
 		if err != nil {
 			return nil, err
 		}
-		return &tracedTx{tx, tc.traceParams, ctx}, nil
+		return &tracedTx{tx, tc.traceParams, ctx, begin}, nil
 	}
 	tx, err = tc.Conn.Begin()
 	tc.tryTrace(ctx, queryTypeBegin, "", start, err)
 	if err != nil {
 		return nil, err
 	}
-	return &tracedTx{tx, tc.traceParams, ctx}, nil
+	return &tracedTx{tx, tc.traceParams, ctx, begin}, nil
 }
 
 func (tc *tracedConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
 	start := time.Now()
+	mode := tc.cfg.commentMode
+	if mode == tracer.SQLInjectionModeFull {
+		// the traceparent would change the text of the statement on each
+		// call, preventing the database from caching it.
+		mode = tracer.SQLInjectionModeService
+	}
+	cquery, _ := tc.injectComments(ctx, query, mode)
 	if connPrepareCtx, ok := tc.Conn.(driver.ConnPrepareContext); ok {
-		stmt, err := connPrepareCtx.PrepareContext(ctx, query)
+		stmt, err := connPrepareCtx.PrepareContext(ctx, cquery)
 		tc.tryTrace(ctx, queryTypePrepare, query, start, err)
 		if err != nil {
 			return nil, err
 		}
 		return &tracedStmt{stmt, tc.traceParams, ctx, query}, nil
 	}
-	stmt, err = tc.Prepare(query)
+	stmt, err = tc.Prepare(cquery)
 	tc.tryTrace(ctx, queryTypePrepare, query, start, err)
 	if err != nil {
 		return nil, err
@@ -82,9 +97,10 @@ func (tc *tracedConn) Exec(query string, args []driver.Value) (driver.Result, er
 
 func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (r driver.Result, err error) {
 	start := time.Now()
+	cquery, spanID := tc.injectComments(ctx, query, tc.cfg.commentMode)
 	if execContext, ok := tc.Conn.(driver.ExecerContext); ok {
-		r, err := execContext.ExecContext(ctx, query, args)
-		tc.tryTrace(ctx, queryTypeExec, query, start, err)
+		r, err := execContext.ExecContext(ctx, cquery, args)
+		tc.tryTrace(ctx, queryTypeExec, query, start, err, tracer.WithSpanID(spanID))
 		return r, err
 	}
 	dargs, err := namedValueToValue(args)
@@ -96,8 +112,8 @@ func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driv
 		return nil, ctx.Err()
 	default:
 	}
-	r, err = tc.Exec(query, dargs)
-	tc.tryTrace(ctx, queryTypeExec, query, start, err)
+	r, err = tc.Exec(cquery, dargs)
+	tc.tryTrace(ctx, queryTypeExec, query, start, err, tracer.WithSpanID(spanID))
 	return r, err
 }
 
@@ -120,9 +136,10 @@ func (tc *tracedConn) Query(query string, args []driver.Value) (driver.Rows, err
 
 func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
 	start := time.Now()
+	cquery, spanID := tc.injectComments(ctx, query, tc.cfg.commentMode)
 	if queryerContext, ok := tc.Conn.(driver.QueryerContext); ok {
-		rows, err := queryerContext.QueryContext(ctx, query, args)
-		tc.tryTrace(ctx, queryTypeQuery, query, start, err)
+		rows, err := queryerContext.QueryContext(ctx, cquery, args)
+		tc.tryTrace(ctx, queryTypeQuery, query, start, err, tracer.WithSpanID(spanID))
 		return rows, err
 	}
 	dargs, err := namedValueToValue(args)
@@ -134,8 +151,8 @@ func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []dri
 		return nil, ctx.Err()
 	default:
 	}
-	rows, err = tc.Query(query, dargs)
-	tc.tryTrace(ctx, queryTypeQuery, query, start, err)
+	rows, err = tc.Query(cquery, dargs)
+	tc.tryTrace(ctx, queryTypeQuery, query, start, err, tracer.WithSpanID(spanID))
 	return rows, err
 }
 
@@ -173,8 +190,39 @@ func WithSpanTags(ctx context.Context, tags map[string]string) context.Context {
 	return context.WithValue(ctx, spanTagsKey, tags)
 }
 
+// injectComments returns the query with a comment prepended to it which carries
+// the information specified by mode, along with the ID of the span which must
+// trace it when that information includes the traceparent (or zero otherwise).
+func (tp *traceParams) injectComments(ctx context.Context, query string, mode tracer.SQLCommentInjectionMode) (string, uint64) {
+	if mode == "" || mode == tracer.SQLInjectionDisabled {
+		return query, 0
+	}
+	var spanCtx ddtrace.SpanContext
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		spanCtx = span.Context()
+	}
+	carrier := tracer.SQLCommentCarrier{
+		Query:         query,
+		Mode:          mode,
+		DBServiceName: tp.cfg.serviceName,
+	}
+	carrier.Inject(spanCtx)
+	return carrier.Query, carrier.SpanID
+}
+
+// sqlDialect returns the dialect of the queries run using the driver registered
+// under the given name. Double-quoted text is only kept as an identifier for
+// PostgreSQL; other databases, such as MySQL, may consider it a string literal.
+func sqlDialect(driverName string) obfuscate.SQLDialect {
+	if strings.Contains(driverName, "postgres") || strings.HasPrefix(driverName, "pgx") {
+		return obfuscate.SQLDialectANSI
+	}
+	return obfuscate.SQLDialectDefault
+}
+
 // tryTrace will create a span using the given arguments, but will act as a no-op when err is driver.ErrSkip.
-func (tp *traceParams) tryTrace(ctx context.Context, qtype queryType, query string, startTime time.Time, err error) {
+// Any given spanOpts are used when starting the span.
+func (tp *traceParams) tryTrace(ctx context.Context, qtype queryType, query string, startTime time.Time, err error, spanOpts ...ddtrace.StartSpanOption) {
 	if err == driver.ErrSkip {
 		// Not a user error: driver is telling sql package that an
 		// optional interface method is not implemented. There is
@@ -191,10 +239,14 @@ func (tp *traceParams) tryTrace(ctx context.Context, qtype queryType, query stri
 	if !math.IsNaN(tp.cfg.analyticsRate) {
 		opts = append(opts, tracer.Tag(ext.EventSampleRate, tp.cfg.analyticsRate))
 	}
+	opts = append(opts, spanOpts...)
 	span, _ := tracer.StartSpanFromContext(ctx, name, opts...)
 	resource := string(qtype)
 	if query != "" {
 		resource = query
+		if tp.cfg.obfuscate == nil || *tp.cfg.obfuscate {
+			resource = obfuscate.SQLWithDialect(query, sqlDialect(tp.driverName))
+		}
 	}
 	span.SetTag("sql.query_type", string(qtype))
 	span.SetTag(ext.ResourceName, resource)
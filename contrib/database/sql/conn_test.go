@@ -11,6 +11,7 @@ import (
 	"log"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 
 	"github.com/go-sql-driver/mysql"
@@ -100,3 +101,15 @@ func TestWithSpanTags(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLDialect(t *testing.T) {
+	for name, want := range map[string]obfuscate.SQLDialect{
+		"postgres":         obfuscate.SQLDialectANSI,
+		"cloudsqlpostgres": obfuscate.SQLDialectANSI,
+		"pgx":              obfuscate.SQLDialectANSI,
+		"mysql":            obfuscate.SQLDialectDefault,
+		"sqlite3":          obfuscate.SQLDialectDefault,
+	} {
+		assert.Equal(t, want, sqlDialect(name), name)
+	}
+}
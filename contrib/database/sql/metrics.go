@@ -0,0 +1,70 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
+)
+
+// dbStatsInterval is the interval at which the statistics of a DB are reported.
+var dbStatsInterval = 10 * time.Second
+
+// canceledCtx is a context which is already canceled.
+var canceledCtx = func() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}()
+
+// pollDBStats reports the statistics of db, along with the given tags, every
+// dbStatsInterval until stop or db is closed. Nothing is reported while the
+// tracer is not started.
+func pollDBStats(db *sql.DB, tags []string, stop <-chan struct{}) {
+	tick := time.NewTicker(dbStatsInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			if dbClosed(db) {
+				return
+			}
+			if statsd := globalconfig.Statsd(); statsd != nil {
+				reportDBStats(statsd, db.Stats(), tags)
+			}
+		}
+	}
+}
+
+// dbClosed reports whether db was closed. sql.DB.Close only closes the connector,
+// which closes stop, as of Go 1.17. On all versions, requesting a connection with
+// a canceled context fails because of the context, unless the DB is closed.
+func dbClosed(db *sql.DB) bool {
+	conn, err := db.Conn(canceledCtx)
+	if err == nil {
+		conn.Close()
+		return false
+	}
+	return err != context.Canceled
+}
+
+// reportDBStats sends the given statistics through statsd. The counts and
+// durations accumulated since the DB was opened are reported as such.
+func reportDBStats(statsd globalconfig.StatsdClient, stats sql.DBStats, tags []string) {
+	statsd.Gauge("datadog.tracer.sql.db.max_open", float64(stats.MaxOpenConnections), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.open", float64(stats.OpenConnections), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.in_use", float64(stats.InUse), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.idle", float64(stats.Idle), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.wait_count", float64(stats.WaitCount), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.wait_duration", stats.WaitDuration.Seconds(), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.max_idle_closed", float64(stats.MaxIdleClosed), tags, 1)
+	statsd.Gauge("datadog.tracer.sql.db.max_lifetime_closed", float64(stats.MaxLifetimeClosed), tags, 1)
+}
@@ -7,14 +7,22 @@ package sql
 
 import (
 	"math"
+	"os"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
 type config struct {
 	serviceName   string
 	analyticsRate float64
 	dsn           string
+	obfuscate     *bool // nil when unset, in which case queries are obfuscated
+	commentMode   tracer.SQLCommentInjectionMode
+	connectSpans  *bool // nil when unset, in which case connections are not traced
+	txSpans       *bool // nil when unset, in which case transactions are not traced
+	dbStats       *bool // nil when unset, in which case the DB statistics are reported
 }
 
 // Option represents an option that can be passed to Register, Open or OpenDB.
@@ -74,3 +82,67 @@ func WithDSN(name string) Option {
 		cfg.dsn = name
 	}
 }
+
+// WithObfuscation specifies whether the queries used as resource names are
+// obfuscated, replacing their literals with "?". Double-quoted text is replaced
+// too, as MySQL considers it a string literal, except with PostgreSQL drivers.
+// It is enabled by default.
+func WithObfuscation(on bool) Option {
+	return func(cfg *config) {
+		cfg.obfuscate = &on
+	}
+}
+
+// WithSQLCommentInjection enables the injection of a comment carrying the service,
+// environment and version of the application into the queries sent to the
+// database and, in tracer.SQLInjectionModeFull, the traceparent of the span
+// tracing them. Prepared statements only ever carry the service information, so
+// that they can still be cached by the database. It defaults to the value of the
+// DD_TRACE_SQL_COMMENT_INJECTION_MODE environment variable ("disabled", "service"
+// or "full") and is disabled when it is unset.
+func WithSQLCommentInjection(mode tracer.SQLCommentInjectionMode) Option {
+	return func(cfg *config) {
+		cfg.commentMode = mode
+	}
+}
+
+// WithConnectSpans specifies whether the connections opened by the driver, as the
+// pool of the database needs them, are traced. It is disabled by default.
+func WithConnectSpans(on bool) Option {
+	return func(cfg *config) {
+		cfg.connectSpans = &on
+	}
+}
+
+// WithTransactionSpans specifies whether transactions are traced by a span
+// covering them from their beginning until they are committed or rolled back,
+// the outcome of which is tagged as "sql.tx_outcome". It is disabled by default.
+func WithTransactionSpans(on bool) Option {
+	return func(cfg *config) {
+		cfg.txSpans = &on
+	}
+}
+
+// WithDBStats specifies whether the statistics of the connection pool of the
+// databases returned by Open and OpenDB (see sql.DBStats) are periodically
+// reported as metrics through the started tracer. It is disabled by default.
+// Reporting stops when the database is closed.
+func WithDBStats(on bool) Option {
+	return func(cfg *config) {
+		cfg.dbStats = &on
+	}
+}
+
+// commentModeFromEnv returns the comment injection mode found in the
+// DD_TRACE_SQL_COMMENT_INJECTION_MODE environment variable.
+func commentModeFromEnv() tracer.SQLCommentInjectionMode {
+	switch v := tracer.SQLCommentInjectionMode(os.Getenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE")); v {
+	case tracer.SQLInjectionModeService, tracer.SQLInjectionModeFull, tracer.SQLInjectionDisabled:
+		return v
+	case "":
+		return tracer.SQLInjectionDisabled
+	default:
+		log.Warn("Invalid value for DD_TRACE_SQL_COMMENT_INJECTION_MODE (%q), using default of %q", v, tracer.SQLInjectionDisabled)
+		return tracer.SQLInjectionDisabled
+	}
+}
@@ -6,10 +6,13 @@
 package sql
 
 import (
+	"os"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +46,55 @@ func TestAnalyticsSettings(t *testing.T) {
 		assert.Equal(t, 0.2, cfg.analyticsRate)
 	})
 }
+
+func TestObfuscationSettings(t *testing.T) {
+	cfg := new(config)
+	defaults(cfg)
+	assert.Nil(t, cfg.obfuscate)
+	WithObfuscation(false)(cfg)
+	assert.False(t, *cfg.obfuscate)
+}
+
+func TestSQLCommentInjectionSettings(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		Register("comment-defaults", &pq.Driver{})
+		rc, _ := registeredDrivers.config("comment-defaults")
+		assert.Equal(t, tracer.SQLInjectionDisabled, rc.commentMode)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE", "service")
+		defer os.Unsetenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE")
+		Register("comment-env", &pq.Driver{})
+		rc, _ := registeredDrivers.config("comment-env")
+		assert.Equal(t, tracer.SQLInjectionModeService, rc.commentMode)
+	})
+
+	t.Run("invalid-env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE", "everything")
+		defer os.Unsetenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE")
+		assert.Equal(t, tracer.SQLInjectionDisabled, commentModeFromEnv())
+	})
+
+	t.Run("option", func(t *testing.T) {
+		os.Setenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE", "service")
+		defer os.Unsetenv("DD_TRACE_SQL_COMMENT_INJECTION_MODE")
+		Register("comment-option", &pq.Driver{}, WithSQLCommentInjection(tracer.SQLInjectionModeFull))
+		rc, _ := registeredDrivers.config("comment-option")
+		assert.Equal(t, tracer.SQLInjectionModeFull, rc.commentMode)
+	})
+}
+
+func TestPoolSettings(t *testing.T) {
+	cfg := new(config)
+	defaults(cfg)
+	assert.Nil(t, cfg.connectSpans)
+	assert.Nil(t, cfg.txSpans)
+	assert.Nil(t, cfg.dbStats)
+	WithConnectSpans(true)(cfg)
+	WithTransactionSpans(true)(cfg)
+	WithDBStats(false)(cfg)
+	assert.True(t, *cfg.connectSpans)
+	assert.True(t, *cfg.txSpans)
+	assert.False(t, *cfg.dbStats)
+}
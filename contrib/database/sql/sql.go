@@ -14,6 +14,11 @@
 //
 // The rest of our application would continue as usual, but with tracing enabled.
 //
+// Comments carrying the service, environment and version of the application, and
+// optionally the trace context, can be injected into the queries sent to the
+// database using the WithSQLCommentInjection option, allowing them to be
+// correlated with traces from the database side (e.g. in its slow query logs).
+//
 package sql
 
 import (
@@ -21,8 +26,10 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"io"
 	"math"
 	"reflect"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
@@ -99,6 +106,9 @@ func Register(driverName string, driver driver.Driver, opts ...RegisterOption) {
 	if cfg.serviceName == "" {
 		cfg.serviceName = driverName + ".db"
 	}
+	if cfg.commentMode == "" {
+		cfg.commentMode = commentModeFromEnv()
+	}
 	log.Debug("contrib/database/sql: Registering driver: %s %#v", driverName, cfg)
 	registeredDrivers.add(driverName, driver, cfg)
 }
@@ -111,13 +121,12 @@ type tracedConnector struct {
 	connector  driver.Connector
 	driverName string
 	cfg        *config
+	stop       chan struct{} // closed to stop reporting DB statistics, if any
 }
 
 func (t *tracedConnector) Connect(c context.Context) (driver.Conn, error) {
+	start := time.Now()
 	conn, err := t.connector.Connect(c)
-	if err != nil {
-		return nil, err
-	}
 	tp := &traceParams{
 		driverName: t.driverName,
 		cfg:        t.cfg,
@@ -127,9 +136,27 @@ func (t *tracedConnector) Connect(c context.Context) (driver.Conn, error) {
 	} else if t.cfg.dsn != "" {
 		tp.meta, _ = internal.ParseDSN(t.driverName, t.cfg.dsn)
 	}
+	if t.cfg.connectSpans != nil && *t.cfg.connectSpans {
+		tp.tryTrace(c, queryTypeConnect, "", start, err)
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &tracedConn{conn, tp}, err
 }
 
+// Close stops reporting the statistics of the DB and closes the underlying
+// connector if it implements io.Closer. It is called by sql.DB.Close.
+func (t *tracedConnector) Close() error {
+	if t.stop != nil {
+		close(t.stop)
+	}
+	if c, ok := t.connector.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 func (t *tracedConnector) Driver() driver.Driver {
 	return t.connector.Driver()
 }
@@ -168,12 +195,33 @@ func OpenDB(c driver.Connector, opts ...Option) *sql.DB {
 	if math.IsNaN(cfg.analyticsRate) {
 		cfg.analyticsRate = rc.analyticsRate
 	}
+	if cfg.obfuscate == nil {
+		cfg.obfuscate = rc.obfuscate
+	}
+	if cfg.commentMode == "" {
+		cfg.commentMode = rc.commentMode
+	}
+	if cfg.connectSpans == nil {
+		cfg.connectSpans = rc.connectSpans
+	}
+	if cfg.txSpans == nil {
+		cfg.txSpans = rc.txSpans
+	}
+	if cfg.dbStats == nil {
+		cfg.dbStats = rc.dbStats
+	}
 	tc := &tracedConnector{
 		connector:  c,
 		driverName: name,
 		cfg:        cfg,
 	}
-	return sql.OpenDB(tc)
+	db := sql.OpenDB(tc)
+	if cfg.dbStats != nil && *cfg.dbStats {
+		tc.stop = make(chan struct{})
+		tags := []string{"driver:" + name, "db.service:" + cfg.serviceName}
+		go pollDBStats(db, tags, tc.stop)
+	}
+	return db
 }
 
 // Open returns connection to a DB using a the traced version of the given driver. In order for Open
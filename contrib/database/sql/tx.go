@@ -9,6 +9,8 @@ import (
 	"context"
 	"database/sql/driver"
 	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 var _ driver.Tx = (*tracedTx)(nil)
@@ -17,7 +19,8 @@ var _ driver.Tx = (*tracedTx)(nil)
 type tracedTx struct {
 	driver.Tx
 	*traceParams
-	ctx context.Context
+	ctx   context.Context
+	begin time.Time // zero unless the transaction is traced as a whole
 }
 
 // Commit sends a span at the end of the transaction
@@ -25,6 +28,7 @@ func (t *tracedTx) Commit() (err error) {
 	start := time.Now()
 	err = t.Tx.Commit()
 	t.tryTrace(t.ctx, queryTypeCommit, "", start, err)
+	t.traceTransaction("commit", err)
 	return err
 }
 
@@ -33,5 +37,15 @@ func (t *tracedTx) Rollback() (err error) {
 	start := time.Now()
 	err = t.Tx.Rollback()
 	t.tryTrace(t.ctx, queryTypeRollback, "", start, err)
+	t.traceTransaction("rollback", err)
 	return err
 }
+
+// traceTransaction sends a span covering the whole transaction, which ended with
+// the given outcome, when transactions are traced.
+func (t *tracedTx) traceTransaction(outcome string, err error) {
+	if t.begin.IsZero() {
+		return
+	}
+	t.tryTrace(t.ctx, queryTypeTransaction, "", t.begin, err, tracer.Tag("sql.tx_outcome", outcome))
+}
@@ -15,6 +15,7 @@ import (
 	"net/url"
 	"strconv"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -142,23 +143,27 @@ func (tc Conn) Do(commandName string, args ...interface{}) (reply interface{}, e
 		// See https://godoc.org/github.com/garyburd/redigo/redis#hdr-Pipelining
 		span.SetTag(ext.ResourceName, "redigo.Conn.Flush")
 	}
-	var b bytes.Buffer
-	b.WriteString(commandName)
-	for _, arg := range args {
-		b.WriteString(" ")
-		switch arg := arg.(type) {
-		case string:
-			b.WriteString(arg)
-		case int:
-			b.WriteString(strconv.Itoa(arg))
-		case int32:
-			b.WriteString(strconv.FormatInt(int64(arg), 10))
-		case int64:
-			b.WriteString(strconv.FormatInt(arg, 10))
-		case fmt.Stringer:
-			b.WriteString(arg.String())
+	if tc.config.obfuscate {
+		span.SetTag("redis.raw_command", obfuscate.Redis(append([]interface{}{commandName}, args...)...))
+	} else {
+		var b bytes.Buffer
+		b.WriteString(commandName)
+		for _, arg := range args {
+			b.WriteString(" ")
+			switch arg := arg.(type) {
+			case string:
+				b.WriteString(arg)
+			case int:
+				b.WriteString(strconv.Itoa(arg))
+			case int32:
+				b.WriteString(strconv.FormatInt(int64(arg), 10))
+			case int64:
+				b.WriteString(strconv.FormatInt(arg, 10))
+			case fmt.Stringer:
+				b.WriteString(arg.String())
+			}
 		}
+		span.SetTag("redis.raw_command", b.String())
 	}
-	span.SetTag("redis.raw_command", b.String())
 	return tc.Conn.Do(commandName, args...)
 }
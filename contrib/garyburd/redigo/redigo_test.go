@@ -48,7 +48,7 @@ func TestClient(t *testing.T) {
 	assert.Equal("SET", span.Tag(ext.ResourceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 	assert.Equal("6379", span.Tag(ext.TargetPort))
-	assert.Equal("SET 1 truck", span.Tag("redis.raw_command"))
+	assert.Equal("SET 1 ?", span.Tag("redis.raw_command"))
 	assert.Equal("2", span.Tag("redis.args_length"))
 }
 
@@ -127,7 +127,7 @@ func TestCommandsToSring(t *testing.T) {
 	defer mt.Stop()
 
 	str := stringifyTest{A: 57, B: 8}
-	c, err := Dial("tcp", "127.0.0.1:6379", WithServiceName("my-service"))
+	c, err := Dial("tcp", "127.0.0.1:6379", WithServiceName("my-service"), WithObfuscation(false))
 	assert.Nil(err)
 	c.Do("SADD", "testSet", "a", int(0), int32(1), int64(2), str, context.Background())
 
@@ -6,9 +6,11 @@
 package pg_test
 
 import (
+	"context"
 	"log"
 
 	pgtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/go-pg/pg.v10"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/go-pg/pg/v10"
 )
@@ -29,3 +31,26 @@ func Example() {
 		log.Fatal(err)
 	}
 }
+
+func Example_sqlComment() {
+	conn := pg.Connect(&pg.Options{
+		User:     "go-pg-test",
+		Database: "datadog",
+	})
+	pgtrace.Wrap(conn)
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	defer span.Finish()
+
+	// Prepend a comment carrying the service, environment and version of the
+	// application, as well as the context of the span tracing the query, to the
+	// query, so that it can be correlated from the database.
+	var user struct {
+		Name string
+	}
+	query := pgtrace.CommentQuery(ctx, tracer.SQLInjectionModeFull, "SELECT name FROM users WHERE id = ?", 1)
+	_, err := conn.WithContext(ctx).QueryOne(&user, query)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -17,6 +17,10 @@ import (
 )
 
 // Wrap augments the given DB with tracing.
+//
+// As go-pg formats queries before running its hooks, comments correlating the
+// queries with the application and its traces can not be injected by Wrap. They
+// are injected into the queries wrapped using CommentQuery instead.
 func Wrap(db *pg.DB) {
 	log.Debug("contrib/go-pg/pg.v10: Wrapping Database")
 	db.AddQueryHook(&queryHook{})
@@ -35,6 +39,10 @@ func (h *queryHook) BeforeQuery(ctx context.Context, qe *pg.QueryEvent) (context
 		tracer.SpanType(ext.SpanTypeSQL),
 		tracer.ResourceName(string(query)),
 	}
+	if q, ok := qe.Query.(*commentedQuery); ok && q.spanID != 0 {
+		// the comment injected into the query references this span
+		opts = append(opts, tracer.WithSpanID(q.spanID))
+	}
 	_, ctx = tracer.StartSpanFromContext(ctx, "go-pg", opts...)
 	return ctx, qe.Err
 }
@@ -16,6 +16,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,3 +67,46 @@ func TestSelect(t *testing.T) {
 	assert.Equal("go-pg", spans[0].OperationName())
 	assert.Equal("http.request", spans[1].OperationName())
 }
+
+func TestCommentQuery(t *testing.T) {
+	tracer.Start(tracer.WithService("my-service"), tracer.WithEnv("test"))
+	defer tracer.Stop()
+
+	t.Run("format", func(t *testing.T) {
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		defer span.Finish()
+
+		q := CommentQuery(ctx, tracer.SQLInjectionModeFull, "SELECT ?", 1).(*commentedQuery)
+		b, err := q.AppendQuery(orm.NewFormatter(), nil)
+		require.NoError(t, err)
+		assert.NotZero(t, q.spanID)
+		assert.Regexp(t, fmt.Sprintf(`^/\*dde='test',ddps='my-service',traceparent='00-[0-9a-f]{32}-%016x-01'\*/ SELECT 1$`, q.spanID), string(b))
+
+		tmpl, err := q.AppendTemplate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT ?", string(tmpl))
+	})
+
+	t.Run("service", func(t *testing.T) {
+		b, err := CommentQuery(context.Background(), tracer.SQLInjectionModeService, "SELECT 1").AppendQuery(orm.NewFormatter(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, "/*dde='test',ddps='my-service'*/ SELECT 1", string(b))
+	})
+
+	t.Run("query", func(t *testing.T) {
+		conn := pg.Connect(&pg.Options{
+			User:     "postgres",
+			Database: "postgres",
+		})
+		defer conn.Close()
+		Wrap(conn)
+
+		// pg_stat_activity holds the text of the query which is being run, as it
+		// was received by the database.
+		var sent string
+		query := "SELECT query FROM pg_stat_activity WHERE pid = pg_backend_pid()"
+		_, err := conn.QueryOne(pg.Scan(&sent), CommentQuery(context.Background(), tracer.SQLInjectionModeService, query))
+		require.NoError(t, err)
+		assert.Equal(t, "/*dde='test',ddps='my-service'*/ "+query, sent)
+	})
+}
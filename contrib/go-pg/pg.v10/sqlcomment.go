@@ -0,0 +1,96 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// CommentQuery wraps the given query, which is either a string holding the query,
+// formatted using params, or an orm.QueryAppender, so that a comment is prepended to
+// it when go-pg formats it, before running it. The comment carries the service,
+// environment and version of the application and, when mode is
+// tracer.SQLInjectionModeFull, the context of the span tracing the query, which is a
+// child of the span found in ctx. It allows correlating the query, as seen by the
+// database (e.g. in its slow query logs), with the application and its traces.
+//
+// The returned query must be passed to the Query, QueryOne, Exec or ExecOne methods
+// of a DB augmented using Wrap, along with the same context, e.g.:
+//
+//	db.WithContext(ctx).QueryOne(&user, pgtrace.CommentQuery(ctx, tracer.SQLInjectionModeFull, "SELECT name FROM users WHERE id = ?", id))
+//
+// It must not be used more than once.
+func CommentQuery(ctx context.Context, mode tracer.SQLCommentInjectionMode, query interface{}, params ...interface{}) orm.QueryAppender {
+	return &commentedQuery{ctx: ctx, mode: mode, query: query, params: params}
+}
+
+// commentedQuery implements orm.QueryAppender and orm.TemplateAppender, adding a
+// comment to the query it wraps.
+type commentedQuery struct {
+	ctx    context.Context
+	mode   tracer.SQLCommentInjectionMode
+	query  interface{}
+	params []interface{}
+
+	// spanID holds the ID of the span referenced by the injected comment, if any,
+	// to be used by the span tracing the query.
+	spanID uint64
+}
+
+var (
+	_ orm.QueryAppender    = (*commentedQuery)(nil)
+	_ orm.TemplateAppender = (*commentedQuery)(nil)
+)
+
+// AppendQuery implements orm.QueryAppender.
+func (q *commentedQuery) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	carrier := tracer.SQLCommentCarrier{Mode: q.mode}
+	if span, ok := tracer.SpanFromContext(q.ctx); ok {
+		carrier.Inject(span.Context())
+	} else {
+		carrier.Inject(nil)
+	}
+	q.spanID = carrier.SpanID
+	if carrier.Query != "" {
+		b = append(b, carrier.Query...)
+		b = append(b, ' ')
+	}
+	switch query := q.query.(type) {
+	case orm.QueryAppender:
+		return query.AppendQuery(fmter, b)
+	case string:
+		params := q.params
+		if n := len(params); n > 0 {
+			if model, ok := params[n-1].(orm.TableModel); ok {
+				if f, ok := fmter.(*orm.Formatter); ok {
+					fmter = f.WithTableModel(model)
+					params = params[:n-1]
+				}
+			}
+		}
+		return fmter.FormatQuery(b, query, params...), nil
+	default:
+		return nil, fmt.Errorf("pg: can't append %T", q.query)
+	}
+}
+
+// AppendTemplate implements orm.TemplateAppender. It returns the query without
+// the comment, which is used as the resource name of its span.
+func (q *commentedQuery) AppendTemplate(b []byte) ([]byte, error) {
+	switch query := q.query.(type) {
+	case orm.TemplateAppender:
+		return query.AppendTemplate(b)
+	case string:
+		return append(b, query...), nil
+	default:
+		return nil, fmt.Errorf("pg: can't append %T", q.query)
+	}
+}
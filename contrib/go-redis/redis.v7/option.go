@@ -14,6 +14,7 @@ import (
 type clientConfig struct {
 	serviceName   string
 	analyticsRate float64
+	obfuscate     bool
 }
 
 // ClientOption represents an option that can be used to create or wrap a client.
@@ -21,6 +22,7 @@ type ClientOption func(*clientConfig)
 
 func defaults(cfg *clientConfig) {
 	cfg.serviceName = "redis.client"
+	cfg.obfuscate = true
 	// cfg.analyticsRate = globalconfig.AnalyticsRate()
 	if internal.BoolEnv("DD_TRACE_REDIS_ANALYTICS_ENABLED", false) {
 		cfg.analyticsRate = 1.0
@@ -58,3 +60,12 @@ func WithAnalyticsRate(rate float64) ClientOption {
 		}
 	}
 }
+
+// WithObfuscation specifies whether the commands recorded in the redis.raw_command
+// tag, as well as the resource names of pipelines, are obfuscated, keeping only the
+// name and key of each command. It is enabled by default.
+func WithObfuscation(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.obfuscate = on
+	}
+}
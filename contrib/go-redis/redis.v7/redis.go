@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -102,6 +103,9 @@ func (ddh *datadogHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (con
 	parts := strings.Split(raw, " ")
 	length := len(parts) - 1
 	p := ddh.params
+	if p.config.obfuscate {
+		raw = obfuscate.Redis(cmd.Args()...)
+	}
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeRedis),
 		tracer.ServiceName(p.config.serviceName),
@@ -134,6 +138,9 @@ func (ddh *datadogHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.
 	parts := strings.Split(raw, " ")
 	length := len(parts) - 1
 	p := ddh.params
+	if p.config.obfuscate {
+		raw = obfuscateCommands(cmds)
+	}
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeRedis),
 		tracer.ServiceName(p.config.serviceName),
@@ -174,3 +181,14 @@ func commandsToString(cmds []redis.Cmder) string {
 	}
 	return b.String()
 }
+
+// obfuscateCommands returns an obfuscated representation of a slice of redis Commands,
+// separated by newlines.
+func obfuscateCommands(cmds []redis.Cmder) string {
+	var b bytes.Buffer
+	for _, cmd := range cmds {
+		b.WriteString(obfuscate.Redis(cmd.Args()...))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
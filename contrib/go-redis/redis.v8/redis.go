@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -101,12 +102,16 @@ func additionalTagOptions(client redis.UniversalClient) []ddtrace.StartSpanOptio
 func (ddh *datadogHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
 	raw := cmd.String()
 	length := strings.Count(raw, " ")
+	resource := raw[:strings.IndexByte(raw, ' ')]
 	p := ddh.params
+	if p.config.obfuscate {
+		raw = obfuscate.Redis(cmd.Args()...)
+	}
 	opts := make([]ddtrace.StartSpanOption, 0, 5+len(ddh.additionalTags)+1) // 5 options below + for additionalTags + for analyticsRate
 	opts = append(opts,
 		tracer.SpanType(ext.SpanTypeRedis),
 		tracer.ServiceName(p.config.serviceName),
-		tracer.ResourceName(raw[:strings.IndexByte(raw, ' ')]),
+		tracer.ResourceName(resource),
 		tracer.Tag("redis.raw_command", raw),
 		tracer.Tag("redis.args_length", strconv.Itoa(length)),
 	)
@@ -133,12 +138,16 @@ func (ddh *datadogHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error
 func (ddh *datadogHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
 	raw := commandsToString(cmds)
 	length := strings.Count(raw, " ")
+	resource := raw[:strings.IndexByte(raw, ' ')]
 	p := ddh.params
+	if p.config.obfuscate {
+		raw = obfuscateCommands(cmds)
+	}
 	opts := make([]ddtrace.StartSpanOption, 0, 7+len(ddh.additionalTags)+1) // 7 options below + for additionalTags + for analyticsRate
 	opts = append(opts,
 		tracer.SpanType(ext.SpanTypeRedis),
 		tracer.ServiceName(p.config.serviceName),
-		tracer.ResourceName(raw[:strings.IndexByte(raw, ' ')]),
+		tracer.ResourceName(resource),
 		tracer.Tag("redis.raw_command", raw),
 		tracer.Tag("redis.args_length", strconv.Itoa(length)),
 		tracer.Tag(ext.ResourceName, raw),
@@ -175,3 +184,14 @@ func commandsToString(cmds []redis.Cmder) string {
 	}
 	return b.String()
 }
+
+// obfuscateCommands returns an obfuscated representation of a slice of redis Commands,
+// separated by newlines.
+func obfuscateCommands(cmds []redis.Cmder) string {
+	var b bytes.Buffer
+	for _, cmd := range cmds {
+		b.WriteString(obfuscate.Redis(cmd.Args()...))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -81,10 +81,25 @@ func TestClient(t *testing.T) {
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 	assert.Equal("6379", span.Tag(ext.TargetPort))
-	assert.Equal("set test_key test_value: ", span.Tag("redis.raw_command"))
+	assert.Equal("set test_key ?", span.Tag("redis.raw_command"))
 	assert.Equal("3", span.Tag("redis.args_length"))
 }
 
+func TestObfuscationDisabled(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithObfuscation(false))
+	client.Set(ctx, "test_key", "test_value", 0)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("set test_key test_value: ", spans[0].Tag("redis.raw_command"))
+}
+
 func TestWrapClient(t *testing.T) {
 	simpleClientOpts := &redis.UniversalOptions{Addrs: []string{"127.0.0.1:6379"}}
 	simpleClient := redis.NewUniversalClient(simpleClientOpts)
@@ -139,7 +154,7 @@ func TestWrapClient(t *testing.T) {
 			assert.Equal("redis.command", span.OperationName())
 			assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 			assert.Equal("my-redis", span.Tag(ext.ServiceName))
-			assert.Equal("set test_key test_value: ", span.Tag("redis.raw_command"))
+			assert.Equal("set test_key ?", span.Tag("redis.raw_command"))
 			assert.Equal("3", span.Tag("redis.args_length"))
 		})
 	}
@@ -225,7 +240,7 @@ func TestPipeline(t *testing.T) {
 	assert.Equal("redis.command", span.OperationName())
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
-	assert.Equal("expire pipeline_counter 3600: false\n", span.Tag(ext.ResourceName))
+	assert.Equal("expire pipeline_counter ?\n", span.Tag(ext.ResourceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 	assert.Equal("6379", span.Tag(ext.TargetPort))
 	assert.Equal("1", span.Tag("redis.pipeline_length"))
@@ -244,7 +259,7 @@ func TestPipeline(t *testing.T) {
 	assert.Equal("redis.command", span.OperationName())
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
-	assert.Equal("expire pipeline_counter 3600: false\nexpire pipeline_counter_1 60: false\n", span.Tag(ext.ResourceName))
+	assert.Equal("expire pipeline_counter ?\nexpire pipeline_counter_1 ?\n", span.Tag(ext.ResourceName))
 	assert.Equal("2", span.Tag("redis.pipeline_length"))
 }
 
@@ -304,10 +319,10 @@ func TestMultipleCommands(t *testing.T) {
 	for i := 0; i < 4; i++ {
 		commands[i] = spans[i].Tag("redis.raw_command").(string)
 	}
-	assert.Contains(commands, "set test_key test_value: ")
-	assert.Contains(commands, "get test_key: ")
-	assert.Contains(commands, "incr int_key: 0")
-	assert.Contains(commands, "client list: ")
+	assert.Contains(commands, "set test_key ?")
+	assert.Contains(commands, "get test_key")
+	assert.Contains(commands, "incr int_key")
+	assert.Contains(commands, "client list")
 }
 
 func TestError(t *testing.T) {
@@ -330,7 +345,7 @@ func TestError(t *testing.T) {
 		assert.Equal(err, span.Tag(ext.Error))
 		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 		assert.Equal("6378", span.Tag(ext.TargetPort))
-		assert.Equal("get key: ", span.Tag("redis.raw_command"))
+		assert.Equal("get key", span.Tag("redis.raw_command"))
 	})
 
 	t.Run("nil", func(t *testing.T) {
@@ -352,7 +367,7 @@ func TestError(t *testing.T) {
 		assert.Empty(span.Tag(ext.Error))
 		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 		assert.Equal("6379", span.Tag(ext.TargetPort))
-		assert.Equal("get non_existent_key: ", span.Tag("redis.raw_command"))
+		assert.Equal("get non_existent_key", span.Tag("redis.raw_command"))
 	})
 }
 func TestAnalyticsSettings(t *testing.T) {
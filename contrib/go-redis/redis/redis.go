@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -129,7 +130,11 @@ func (c *Pipeliner) execWithContext(ctx context.Context) ([]redis.Cmder, error)
 	}
 	span, _ := tracer.StartSpanFromContext(ctx, "redis.command", opts...)
 	cmds, err := c.Pipeliner.Exec()
-	span.SetTag(ext.ResourceName, commandsToString(cmds))
+	if p.config.obfuscate {
+		span.SetTag(ext.ResourceName, obfuscateCommands(cmds))
+	} else {
+		span.SetTag(ext.ResourceName, commandsToString(cmds))
+	}
 	span.SetTag("redis.pipeline_length", strconv.Itoa(len(cmds)))
 	var finishOpts []ddtrace.FinishOption
 	if err != redis.Nil {
@@ -184,6 +189,9 @@ func createWrapperFromClient(tc *Client) func(oldProcess func(cmd redis.Cmder) e
 			parts := strings.Split(raw, " ")
 			length := len(parts) - 1
 			p := tc.params
+			if p.config.obfuscate {
+				raw = obfuscate.Redis(cmd.Args()...)
+			}
 			opts := []ddtrace.StartSpanOption{
 				tracer.SpanType(ext.SpanTypeRedis),
 				tracer.ServiceName(p.config.serviceName),
@@ -233,3 +241,14 @@ func cmderToString(cmd redis.Cmder) string {
 	}
 	return ""
 }
+
+// obfuscateCommands returns an obfuscated representation of a slice of redis Commands,
+// separated by newlines.
+func obfuscateCommands(cmds []redis.Cmder) string {
+	var b bytes.Buffer
+	for _, cmd := range cmds {
+		b.WriteString(obfuscate.Redis(cmd.Args()...))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
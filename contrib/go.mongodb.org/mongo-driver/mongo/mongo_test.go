@@ -70,7 +70,9 @@ func Test(t *testing.T) {
 	assert.Equal(t, "mongo.insert", s.Tag(ext.ResourceName))
 	assert.Equal(t, hostname, s.Tag(ext.PeerHostname))
 	assert.Equal(t, port, s.Tag(ext.PeerPort))
-	assert.Contains(t, s.Tag(ext.DBStatement), `"test-item":"test-value"`)
+	assert.Contains(t, s.Tag(ext.DBStatement), `"insert":"test-collection"`)
+	assert.Contains(t, s.Tag(ext.DBStatement), `"test-item":"?"`)
+	assert.NotContains(t, s.Tag(ext.DBStatement), "test-value")
 	assert.Equal(t, "test-database", s.Tag(ext.DBInstance))
 	assert.Equal(t, "mongo", s.Tag(ext.DBType))
 }
@@ -131,3 +133,44 @@ func TestAnalyticsSettings(t *testing.T) {
 		assertRate(t, mt, 0.23, WithAnalyticsRate(0.23))
 	})
 }
+
+func TestObfuscation(t *testing.T) {
+	statement := func(t *testing.T, mt mocktracer.Tracer, opts ...Option) string {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+
+		addr := fmt.Sprintf("mongodb://localhost:27017/?connect=direct")
+		mongopts := options.Client()
+		mongopts.Monitor = NewMonitor(opts...)
+		mongopts.ApplyURI(addr)
+		client, err := mongo.Connect(ctx, mongopts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.
+			Database("test-database").
+			Collection("test-collection").
+			InsertOne(ctx, bson.D{{Key: "test-item", Value: "test-value"}})
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		return spans[0].Tag(ext.DBStatement).(string)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		stmt := statement(t, mt)
+		assert.Contains(t, stmt, `"test-item":"?"`)
+		assert.Contains(t, stmt, `"$db":"test-database"`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		stmt := statement(t, mt, WithObfuscation(false))
+		assert.Contains(t, stmt, `"test-item":"test-value"`)
+	})
+}
@@ -14,6 +14,7 @@ import (
 type config struct {
 	serviceName   string
 	analyticsRate float64
+	obfuscate     bool
 }
 
 // Option represents an option that can be passed to Dial.
@@ -21,6 +22,7 @@ type Option func(*config)
 
 func defaults(cfg *config) {
 	cfg.serviceName = "mongo"
+	cfg.obfuscate = true
 	// cfg.analyticsRate = globalconfig.AnalyticsRate()
 	if internal.BoolEnv("DD_TRACE_MONGO_ANALYTICS_ENABLED", false) {
 		cfg.analyticsRate = 1.0
@@ -60,3 +62,12 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithObfuscation specifies whether the commands recorded in the db.statement tag
+// are obfuscated, replacing all the values they hold, except for the collection
+// and database names, with "?". It is enabled by default.
+func WithObfuscation(on bool) Option {
+	return func(cfg *config) {
+		cfg.obfuscate = on
+	}
+}
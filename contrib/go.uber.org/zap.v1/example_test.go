@@ -0,0 +1,28 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package zap_test
+
+import (
+	"context"
+
+	zaptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/go.uber.org/zap.v1"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Example() {
+	logger := zap.NewExample(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zaptrace.WrapCore(c, zaptrace.WithErrorTags())
+	}))
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	defer span.Finish()
+
+	// entries logged with a context holding a span are correlated with its trace
+	logger.Info("handling request", zaptrace.Context(ctx))
+}
@@ -0,0 +1,166 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package zap provides a core correlating the entries of the go.uber.org/zap package
+// (https://github.com/uber-go/zap) with traces.
+package zap // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/go.uber.org/zap.v1"
+
+import (
+	"context"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Context returns a field passing ctx to the cores returned by WrapCore. As zap
+// loggers do not carry contexts, it should be added to the entries, or to the
+// loggers, which need to be correlated with the span held by ctx:
+//
+//	logger.Info("handling request", zaptrace.Context(ctx))
+//	logger.With(zaptrace.Context(ctx)).Info("handling request")
+//
+// The field is ignored by encoders, and by cores which are not wrapped.
+func Context(ctx context.Context) zap.Field {
+	return zap.Field{Key: "dd.context", Type: zapcore.SkipType, Interface: ctx}
+}
+
+// WrapCore returns a core adding the IDs of the active span, along with the service,
+// environment and version of the program, to the entries written to c with a field
+// returned by Context holding a span.
+func WrapCore(c zapcore.Core, opts ...Option) zapcore.Core {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &core{Core: c, cfg: cfg}
+}
+
+// core implements zapcore.Core, correlating entries with the span found in their
+// fields or in those of the logger.
+type core struct {
+	zapcore.Core
+	cfg  *config
+	span ddtrace.Span // span found in the fields of the logger, if any
+}
+
+// spanFromFields returns the span held by the context of the last Context field in
+// fields, if any, along with the remaining fields.
+func spanFromFields(fields []zapcore.Field) (ddtrace.Span, []zapcore.Field) {
+	var (
+		span  ddtrace.Span
+		found bool
+	)
+	for i := len(fields) - 1; i >= 0; i-- {
+		ctx, ok := fields[i].Interface.(context.Context)
+		if !ok || fields[i].Type != zapcore.SkipType {
+			continue
+		}
+		if !found {
+			if s, ok := tracer.SpanFromContext(ctx); ok {
+				span = s
+			}
+			found = true
+		}
+		fields = append(fields[:i:i], fields[i+1:]...)
+	}
+	return span, fields
+}
+
+// correlationFields returns the fields correlating an entry with span.
+func correlationFields(span ddtrace.Span) []zapcore.Field {
+	lc := tracer.NewLogCorrelation(span)
+	fields := []zapcore.Field{
+		zap.String(ext.LogKeyTraceID, strconv.FormatUint(lc.TraceID, 10)),
+		zap.String(ext.LogKeySpanID, strconv.FormatUint(lc.SpanID, 10)),
+	}
+	if lc.Service != "" {
+		fields = append(fields, zap.String(ext.LogKeyService, lc.Service))
+	}
+	if lc.Env != "" {
+		fields = append(fields, zap.String(ext.LogKeyEnv, lc.Env))
+	}
+	if lc.Version != "" {
+		fields = append(fields, zap.String(ext.LogKeyVersion, lc.Version))
+	}
+	return fields
+}
+
+// With implements zapcore.Core.
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	span, fields := spanFromFields(fields)
+	if span == nil {
+		return &core{Core: c.Core.With(fields), cfg: c.cfg, span: c.span}
+	}
+	return &core{Core: c.Core.With(append(fields, correlationFields(span)...)), cfg: c.cfg, span: span}
+}
+
+// Check implements zapcore.Core. The wrapped core checks ent, so that its level,
+// sampling or tee behaviors apply, and the cores it registers to write ent are
+// wrapped so that they receive the correlation fields.
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	downstream := c.Core.Check(ent, nil)
+	if downstream == nil {
+		return ce
+	}
+	cc := &checkedCore{core: c, downstream: downstream}
+	ce = ce.AddCore(ent, cc)
+	cc.upstream = ce
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.correlate(ent, fields))
+}
+
+// correlate returns fields along with the fields correlating ent with its span, if
+// any, whose error tags are set according to the configuration.
+func (c *core) correlate(ent zapcore.Entry, fields []zapcore.Field) []zapcore.Field {
+	span, fields := spanFromFields(fields)
+	if span != nil {
+		fields = append(fields, correlationFields(span)...)
+	} else {
+		span = c.span
+	}
+	if span != nil && c.cfg.errorTags && ent.Level >= zapcore.ErrorLevel {
+		setErrorTags(span, ent, fields)
+	}
+	return fields
+}
+
+// checkedCore writes an entry to the cores registered by the wrapped core when
+// checking it, in downstream, along with the correlation fields.
+type checkedCore struct {
+	*core
+	downstream *zapcore.CheckedEntry
+	upstream   *zapcore.CheckedEntry // the entry checked by the logger
+}
+
+// Write implements zapcore.Core.
+func (c *checkedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// report write errors as the logger does
+	c.downstream.ErrorOutput = c.upstream.ErrorOutput
+	c.downstream.Write(c.correlate(ent, fields)...)
+	return nil
+}
+
+// setErrorTags sets the error tags of span from the last error field in fields, or
+// from the message of ent if there is none.
+func setErrorTags(span ddtrace.Span, ent zapcore.Entry, fields []zapcore.Field) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if err, ok := fields[i].Interface.(error); ok && fields[i].Type == zapcore.ErrorType {
+			span.SetTag(ext.Error, err)
+			return
+		}
+	}
+	span.SetTag(ext.Error, true)
+	span.SetTag(ext.ErrorMsg, ent.Message)
+}
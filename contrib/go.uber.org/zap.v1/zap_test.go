@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package zap
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newLogger returns a logger recording its entries in the returned observer.
+func newLogger(opts ...Option) (*zap.Logger, *observer.ObservedLogs) {
+	c, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(WrapCore(c, opts...)), logs
+}
+
+func TestWrapCore(t *testing.T) {
+	t.Run("entry", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, logs := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.Info("hello", zap.Int("n", 1), Context(ctx))
+
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(map[string]interface{}{
+			"n":               int64(1),
+			ext.LogKeyTraceID: strconv.FormatUint(span.Context().TraceID(), 10),
+			ext.LogKeySpanID:  strconv.FormatUint(span.Context().SpanID(), 10),
+		}, fields)
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, logs := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.With(Context(ctx)).Info("hello")
+
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), fields[ext.LogKeySpanID])
+		assert.NotContains(fields, "dd.context")
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		logger, logs := newLogger()
+		logger.Info("no context")
+		logger.Info("no span", Context(context.Background()))
+		for _, e := range logs.All() {
+			assert.Empty(t, e.ContextMap())
+		}
+	})
+
+	t.Run("error-tags", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger(WithErrorTags())
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		ms := span.(mocktracer.Span)
+
+		logger.Warn("not an error", Context(ctx))
+		assert.Nil(ms.Tag(ext.Error))
+		logger.With(Context(ctx)).Error("query failed")
+		assert.Equal(true, ms.Tag(ext.Error))
+		assert.Equal("query failed", ms.Tag(ext.ErrorMsg))
+
+		err := errors.New("broken")
+		logger.Error("query failed", zap.Error(err), Context(ctx))
+		assert.Equal(err, ms.Tag(ext.Error))
+	})
+
+	t.Run("error-tags-disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.Error("query failed", Context(ctx))
+		assert.Nil(t, span.(mocktracer.Span).Tag(ext.Error))
+	})
+}
+
+func TestWrapCoreCheck(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	spanID := strconv.FormatUint(span.Context().SpanID(), 10)
+
+	t.Run("sampler", func(t *testing.T) {
+		c, logs := observer.New(zapcore.DebugLevel)
+		// only the first entry with a given message is logged each second
+		logger := zap.New(WrapCore(zapcore.NewSamplerWithOptions(c, time.Second, 1, 0)))
+		for i := 0; i < 3; i++ {
+			logger.Info("hello", Context(ctx))
+		}
+		assert.Len(t, logs.All(), 1)
+		assert.Equal(t, spanID, logs.All()[0].ContextMap()[ext.LogKeySpanID])
+	})
+
+	t.Run("tee", func(t *testing.T) {
+		debug, debugLogs := observer.New(zapcore.DebugLevel)
+		warn, warnLogs := observer.New(zapcore.WarnLevel)
+		logger := zap.New(WrapCore(zapcore.NewTee(debug, warn)))
+		logger.Info("info", Context(ctx))
+		logger.Warn("warn", Context(ctx))
+		assert.Len(t, debugLogs.All(), 2)
+		if assert.Len(t, warnLogs.All(), 1) {
+			assert.Equal(t, "warn", warnLogs.All()[0].Message)
+			assert.Equal(t, spanID, warnLogs.All()[0].ContextMap()[ext.LogKeySpanID])
+		}
+	})
+
+	t.Run("level", func(t *testing.T) {
+		c, logs := observer.New(zapcore.DebugLevel)
+		filtered, err := zapcore.NewIncreaseLevelCore(c, zapcore.ErrorLevel)
+		assert.NoError(t, err)
+		logger := zap.New(WrapCore(filtered))
+		logger.Warn("warn", Context(ctx))
+		logger.Error("error", Context(ctx))
+		assert.Len(t, logs.All(), 1)
+	})
+}
+
+func TestContextUnwrapped(t *testing.T) {
+	// the field is ignored by cores which are not wrapped
+	c, logs := observer.New(zapcore.DebugLevel)
+	zap.New(c).Info("hello", Context(context.Background()))
+	assert.Empty(t, logs.All()[0].ContextMap())
+}
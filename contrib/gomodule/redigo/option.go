@@ -14,6 +14,7 @@ import (
 type dialConfig struct {
 	serviceName   string
 	analyticsRate float64
+	obfuscate     bool
 }
 
 // DialOption represents an option that can be passed to Dial.
@@ -21,6 +22,7 @@ type DialOption func(*dialConfig)
 
 func defaults(cfg *dialConfig) {
 	cfg.serviceName = "redis.conn"
+	cfg.obfuscate = true
 	// cfg.analyticsRate = globalconfig.AnalyticsRate()
 	if internal.BoolEnv("DD_TRACE_REDIGO_ANALYTICS_ENABLED", false) {
 		cfg.analyticsRate = 1.0
@@ -58,3 +60,11 @@ func WithAnalyticsRate(rate float64) DialOption {
 		}
 	}
 }
+
+// WithObfuscation specifies whether the commands recorded in the redis.raw_command
+// tag are obfuscated, keeping only their name and key. It is enabled by default.
+func WithObfuscation(on bool) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.obfuscate = on
+	}
+}
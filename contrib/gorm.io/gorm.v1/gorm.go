@@ -26,7 +26,9 @@ const (
 )
 
 // Open opens a new (traced) database connection. The used driver must be formerly registered
-// using (gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql).Register.
+// using (gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql).Register. Comments correlating
+// the queries with the application and its traces are injected by that package, when it is
+// configured to using its WithSQLCommentInjection option.
 func Open(dialector gorm.Dialector, cfg *gorm.Config, opts ...Option) (*gorm.DB, error) {
 	db, err := gorm.Open(dialector, cfg)
 	if err != nil {
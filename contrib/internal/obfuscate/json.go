@@ -0,0 +1,101 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package obfuscate
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JSON returns the given JSON document with all its values replaced by "?",
+// keeping only its structure and the names of its fields. The values of the
+// fields named in keep, including all the values nested within them, are left
+// as they are. Multiple documents, such as the ones found in the bodies of
+// Elasticsearch bulk requests, are separated by newlines. If s is not valid
+// JSON (e.g. because it was truncated), the obfuscated part which could be read
+// is returned.
+func JSON(s string, keep ...string) string {
+	keepSet := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		keepSet[k] = true
+	}
+	var b strings.Builder
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	for dec.More() {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		if err := obfuscateJSONValue(dec, &b, keepSet, false); err != nil {
+			break
+		}
+	}
+	return b.String()
+}
+
+// obfuscateJSONValue reads the next value from dec and writes it to b, with all
+// its values replaced by "?" unless keep is true or the value of a field is
+// found in keepSet.
+func obfuscateJSONValue(dec *json.Decoder, b *strings.Builder, keepSet map[string]bool, keep bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		b.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			writeJSON(b, key)
+			b.WriteByte(':')
+			if err := obfuscateJSONValue(dec, b, keepSet, keep || keepSet[key]); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		b.WriteByte('}')
+	case json.Delim('['):
+		b.WriteByte('[')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := obfuscateJSONValue(dec, b, keepSet, keep); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		b.WriteByte(']')
+	default:
+		if keep {
+			writeJSON(b, tok)
+		} else {
+			b.WriteString(`"?"`)
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the JSON encoding of the scalar v to b.
+func writeJSON(b *strings.Builder, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		b.WriteString(`"?"`)
+		return
+	}
+	b.Write(out)
+}
@@ -0,0 +1,47 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package obfuscate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+		keep    []string
+	}{
+		{
+			in:  `{"query":{"match":{"user":"alice"}},"size":10,"tags":["a",true,null]}`,
+			out: `{"query":{"match":{"user":"?"}},"size":"?","tags":["?","?","?"]}`,
+		},
+		{
+			in:   `{"insert":"users","documents":[{"name":"alice","_id":{"$oid":"5f1"}}],"$db":"test","lsid":{"id":1}}`,
+			out:  `{"insert":"users","documents":[{"name":"?","_id":{"$oid":"?"}}],"$db":"test","lsid":{"id":1}}`,
+			keep: []string{"insert", "$db", "lsid"},
+		},
+		{
+			in:  "{\"index\":{\"_id\":\"1\"}}\n{\"user\":\"alice\"}\n",
+			out: "{\"index\":{\"_id\":\"?\"}}\n{\"user\":\"?\"}",
+		},
+		{
+			in:  `{"query":{"match":{"user":"ali`,
+			out: `{"query":{"match":{"user":`,
+		},
+		{
+			in:  `[]`,
+			out: `[]`,
+		},
+		{
+			in:  ``,
+			out: ``,
+		},
+	} {
+		assert.Equal(t, tt.out, JSON(tt.in, tt.keep...), tt.in)
+	}
+}
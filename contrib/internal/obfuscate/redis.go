@@ -0,0 +1,56 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package obfuscate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxRedisArgLen specifies the maximum length of the Redis argument which is
+// kept by the Redis function. Longer arguments are truncated.
+const maxRedisArgLen = 100
+
+// Redis returns a string representation of the Redis command made up of the
+// given arguments, the first of which is the name of the command. Only the first
+// argument following the name, which is usually the key, is kept; it is truncated
+// to 100 bytes. All other arguments are replaced by "?". Arguments of the AUTH
+// command are always replaced.
+func Redis(args ...interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	name := redisArg(args[0])
+	b.WriteString(name)
+	for i, arg := range args[1:] {
+		b.WriteByte(' ')
+		if i > 0 || strings.EqualFold(name, "auth") {
+			b.WriteByte('?')
+			continue
+		}
+		s := redisArg(arg)
+		if len(s) > maxRedisArgLen {
+			s = s[:maxRedisArgLen] + "..."
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// redisArg returns the string representation of the Redis argument v.
+func redisArg(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,51 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package obfuscate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis(t *testing.T) {
+	for _, tt := range []struct {
+		in  []interface{}
+		out string
+	}{
+		{
+			in:  nil,
+			out: "",
+		},
+		{
+			in:  []interface{}{"ping"},
+			out: "ping",
+		},
+		{
+			in:  []interface{}{"set", "test_key", "test_value", "ex", 3600},
+			out: "set test_key ? ? ?",
+		},
+		{
+			in:  []interface{}{"GET", []byte("key")},
+			out: "GET key",
+		},
+		{
+			in:  []interface{}{"AUTH", "user", "password"},
+			out: "AUTH ? ?",
+		},
+		{
+			in:  []interface{}{"expire", 12, 60},
+			out: "expire 12 ?",
+		},
+		{
+			in:  []interface{}{"get", strings.Repeat("k", 150)},
+			out: "get " + strings.Repeat("k", 100) + "...",
+		},
+	} {
+		assert.Equal(t, tt.out, Redis(tt.in...))
+	}
+}
@@ -0,0 +1,216 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package obfuscate removes sensitive data, such as literals and user-provided
+// values, from the statements and commands recorded on spans by integrations, so
+// that it does not leave the host.
+package obfuscate // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// sqlListRegexp matches parenthesized lists of placeholders, such as "(?, ?, ?)".
+	sqlListRegexp = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	// sqlTuplesRegexp matches lists of single placeholder tuples, such as "(?), (?)".
+	sqlTuplesRegexp = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+)
+
+// SQLDialect specifies the SQL syntax of the queries passed to SQLWithDialect.
+type SQLDialect int
+
+const (
+	// SQLDialectDefault treats double-quoted text as string literals and "#" as
+	// the start of a comment, as MySQL does by default. As it never keeps quoted
+	// text, it is safe to use with any database.
+	SQLDialectDefault SQLDialect = iota
+	// SQLDialectANSI treats double-quoted text as identifiers, following the SQL
+	// standard, as PostgreSQL does, and "#" as an operator.
+	SQLDialectANSI
+)
+
+// SQL returns the given query with all its literals (strings, numbers and
+// dollar-quoted strings) replaced by "?", its comments removed and its runs of
+// whitespace collapsed into a single space. Lists of literals, such as the ones
+// found in IN clauses, are collapsed into a single "(?)". Identifiers and bind
+// parameters (e.g. "$1") are kept. Double-quoted text is considered to be a
+// string literal, so it is replaced too; see SQLWithDialect.
+func SQL(query string) string {
+	return SQLWithDialect(query, SQLDialectDefault)
+}
+
+// SQLWithDialect is like SQL, but follows the syntax of the given dialect.
+func SQLWithDialect(query string, dialect SQLDialect) string {
+	ansi := dialect == SQLDialectANSI
+	var (
+		b     strings.Builder
+		space bool // whether whitespace precedes the current token
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case isSQLSpace(c):
+			space = true
+			i++
+			continue
+		case (c == '-' && strings.HasPrefix(query[i:], "--")) || (c == '#' && !ansi):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(query)
+			}
+			space = true
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case c == '\'' || (c == '"' && !ansi):
+			i = skipQuoted(query, i, c, true)
+			b.WriteByte('?')
+		case c == '"' || c == '`':
+			// quoted identifier
+			j := skipQuoted(query, i, c, false)
+			b.WriteString(query[i:j])
+			i = j
+		case c == '$':
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			if j > i+1 {
+				// bind parameter, e.g. "$1"
+				b.WriteString(query[i:j])
+				i = j
+				break
+			}
+			if end := skipDollarQuoted(query, i); end > i {
+				b.WriteByte('?')
+				i = end
+				break
+			}
+			b.WriteByte(c)
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			i = skipNumber(query, i)
+			b.WriteByte('?')
+		case isIdentChar(c):
+			j := i + 1
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			if j == i+1 && j < len(query) && query[j] == '\'' && strings.IndexByte("bBeEnNxX", c) >= 0 {
+				// prefixed string literal, e.g. X'1F' or E'\n'
+				i = skipQuoted(query, j, '\'', true)
+				b.WriteByte('?')
+				break
+			}
+			b.WriteString(query[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	out := sqlListRegexp.ReplaceAllString(b.String(), "(?)")
+	return sqlTuplesRegexp.ReplaceAllString(out, "(?)")
+}
+
+// skipQuoted returns the index following the end of the string quoted by q
+// which starts at index i of s. Quotes may be escaped by doubling them or, when
+// escapes is set, using a backslash.
+func skipQuoted(s string, i int, q byte, escapes bool) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case q:
+			if j+1 < len(s) && s[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// skipDollarQuoted returns the index following the end of the dollar-quoted
+// string (e.g. $tag$...$tag$) which starts at index i of s, or i if there is none.
+func skipDollarQuoted(s string, i int) int {
+	j := i + 1
+	for j < len(s) && s[j] != '$' {
+		if !isIdentChar(s[j]) {
+			return i
+		}
+		j++
+	}
+	if j == len(s) {
+		return i
+	}
+	tag := s[i : j+1]
+	end := strings.Index(s[j+1:], tag)
+	if end < 0 {
+		return len(s)
+	}
+	return j + 1 + end + len(tag)
+}
+
+// skipNumber returns the index following the end of the numeric literal which
+// starts at index i of s.
+func skipNumber(s string, i int) int {
+	if strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0X") {
+		i += 2
+		for i < len(s) && isHexDigit(s[i]) {
+			i++
+		}
+		return i
+	}
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+		i++
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for i = j; i < len(s) && isDigit(s[i]); i++ {
+			}
+		}
+	}
+	return i
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// isIdentChar reports whether c may be part of an identifier or keyword. Bytes
+// of multi-byte UTF-8 characters are considered to be part of identifiers.
+func isIdentChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || isDigit(c) || c == '_' || c == '$' || c >= 0x80
+}
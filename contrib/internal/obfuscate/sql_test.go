@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package obfuscate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQL(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{
+			in:  "SELECT id, name FROM city LIMIT 5",
+			out: "SELECT id, name FROM city LIMIT ?",
+		},
+		{
+			in:  "INSERT INTO city(name) VALUES('New York')",
+			out: "INSERT INTO city(name) VALUES(?)",
+		},
+		{
+			in:  "SELECT * FROM users WHERE email = 'o''brien@example.com' AND age > -21.5e3",
+			out: "SELECT * FROM users WHERE email = ? AND age > -?",
+		},
+		{
+			in:  "SELECT * FROM t WHERE id IN (1, 2, 3) AND name IN ( 'a','b' )",
+			out: "SELECT * FROM t WHERE id IN (?) AND name IN (?)",
+		},
+		{
+			in:  "INSERT INTO t (a) VALUES (1), (2), (3)",
+			out: "INSERT INTO t (a) VALUES (?)",
+		},
+		{
+			in:  "SELECT `col1` FROM t2 WHERE x = $1 AND y = ? AND email = \"a@b.c\" AND s = \"x\\\"y\"",
+			out: "SELECT `col1` FROM t2 WHERE x = $1 AND y = ? AND email = ? AND s = ?",
+		},
+		{
+			in:  "SELECT *\n  FROM t -- secret comment\n  WHERE /* another */ k = 'v' # 1\n  AND a = 1",
+			out: "SELECT * FROM t WHERE k = ? AND a = ?",
+		},
+		{
+			in:  "SELECT $$it's secret$$, $tag$also $$ secret$tag$, X'1F', E'a\\'b', 0xFF, .5",
+			out: "SELECT ?, ?, ?, ?, ?, ?",
+		},
+		{
+			in:  "SELECT 'unterminated",
+			out: "SELECT ?",
+		},
+	} {
+		assert.Equal(t, tt.out, SQL(tt.in), tt.in)
+	}
+}
+
+func TestSQLWithDialect(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{
+			in:  "SELECT \"col1\", `col2` FROM \"T\"\"2\" WHERE x = $1 AND y = 'a@b.c'",
+			out: "SELECT \"col1\", `col2` FROM \"T\"\"2\" WHERE x = $1 AND y = ?",
+		},
+		{
+			in:  "SELECT a # 5 FROM t -- secret comment",
+			out: "SELECT a # ? FROM t",
+		},
+	} {
+		assert.Equal(t, tt.out, SQLWithDialect(tt.in, SQLDialectANSI), tt.in)
+	}
+}
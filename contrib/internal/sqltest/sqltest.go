@@ -174,7 +174,17 @@ func testBeginRollback(cfg *Config) func(*testing.T) {
 func testExec(cfg *Config) func(*testing.T) {
 	return func(t *testing.T) {
 		assert := assert.New(t)
-		query := fmt.Sprintf("INSERT INTO %s(name) VALUES('New York')", cfg.TableName)
+		var query, resource string
+		switch cfg.DriverName {
+		case "postgres", "pgx":
+			// double-quoted text is an identifier, which is not obfuscated
+			query = fmt.Sprintf(`INSERT INTO %s("name") VALUES('New York')`, cfg.TableName)
+			resource = fmt.Sprintf(`INSERT INTO %s("name") VALUES(?)`, cfg.TableName)
+		case "mysql":
+			// double-quoted text is a string literal, which is obfuscated
+			query = fmt.Sprintf(`INSERT INTO %s(name) VALUES("New York")`, cfg.TableName)
+			resource = fmt.Sprintf("INSERT INTO %s(name) VALUES(?)", cfg.TableName)
+		}
 
 		parent, ctx := tracer.StartSpanFromContext(context.Background(), "test.parent",
 			tracer.ServiceName("test"),
@@ -196,7 +206,7 @@ func testExec(cfg *Config) func(*testing.T) {
 
 		var span mocktracer.Span
 		for _, s := range spans {
-			if s.OperationName() == cfg.ExpectName && s.Tag(ext.ResourceName) == query {
+			if s.OperationName() == cfg.ExpectName && s.Tag(ext.ResourceName) == resource {
 				span = s
 			}
 		}
@@ -10,6 +10,10 @@
 // For more information on registering and why this needs to happen, please check the
 // github.com/DataDog/dd-trace-go/contrib/database/sql package.
 //
+// Comments correlating the queries with the application and its traces can be
+// injected into them by registering the driver with the WithSQLCommentInjection
+// option of that package.
+//
 package sqlx // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/jmoiron/sqlx"
 
 import (
@@ -0,0 +1,28 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.21
+// +build go1.21
+
+package slog_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	slogtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/log/slog"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func Example() {
+	logger := slog.New(slogtrace.WrapHandler(slog.NewJSONHandler(os.Stdout, nil), slogtrace.WithErrorTags()))
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	defer span.Finish()
+
+	// records logged with a context holding a span are correlated with its trace
+	logger.InfoContext(ctx, "handling request")
+}
@@ -0,0 +1,27 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.21
+// +build go1.21
+
+package slog
+
+type config struct {
+	errorTags bool
+}
+
+// Option represents an option that can be passed to WrapHandler.
+type Option func(*config)
+
+func defaults(cfg *config) {}
+
+// WithErrorTags marks the active span as having an error when a record is logged
+// at the error level or above, setting the error tags of the span from the record's
+// error attribute, or from its message if it has none.
+func WithErrorTags() Option {
+	return func(cfg *config) {
+		cfg.errorTags = true
+	}
+}
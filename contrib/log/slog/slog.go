@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.21
+// +build go1.21
+
+// Package slog provides a handler correlating the records of the log/slog package
+// (https://pkg.go.dev/log/slog) with traces.
+package slog // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/log/slog"
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// WrapHandler returns a handler adding the IDs of the active span, along with the
+// service, environment and version of the program, to the records logged with a
+// context holding a span, such as using slog.InfoContext, before passing them to h.
+func WrapHandler(h slog.Handler, opts ...Option) slog.Handler {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &handler{base: h, wrapped: h, cfg: cfg}
+}
+
+// handler implements slog.Handler. The correlation attributes are added to the
+// records, which places them at the top level. When the logger has groups, they
+// would be nested in the groups instead, so they are applied to the base handler
+// before the groups and attributes of the logger. The resulting handler is cached
+// and reused for the following records correlated with the same span.
+type handler struct {
+	base    slog.Handler                      // handler passed to WrapHandler
+	ops     []func(slog.Handler) slog.Handler // groups and attributes added to the logger, in order
+	wrapped slog.Handler                      // base with ops applied
+	grouped bool                              // whether ops contains a group
+	derived atomic.Value                      // *derivedHandler, when grouped
+	cfg     *config
+}
+
+// derivedHandler holds the handler built for the records correlated using lc, when
+// the logger has groups.
+type derivedHandler struct {
+	lc tracer.LogCorrelation
+	h  slog.Handler
+}
+
+// Enabled implements slog.Handler.
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.wrapped.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return h.wrapped.Handle(ctx, r)
+	}
+	if h.cfg.errorTags && r.Level >= slog.LevelError {
+		setErrorTags(span, r)
+	}
+	lc := tracer.NewLogCorrelation(span)
+	if !h.grouped {
+		r = r.Clone()
+		r.AddAttrs(correlationAttrs(lc)...)
+		return h.wrapped.Handle(ctx, r)
+	}
+	if d, ok := h.derived.Load().(*derivedHandler); ok && d.lc == lc {
+		return d.h.Handle(ctx, r)
+	}
+	target := h.base.WithAttrs(correlationAttrs(lc))
+	for _, op := range h.ops {
+		target = op(target)
+	}
+	h.derived.Store(&derivedHandler{lc: lc, h: target})
+	return target.Handle(ctx, r)
+}
+
+// correlationAttrs returns the attributes correlating a record with a span.
+func correlationAttrs(lc tracer.LogCorrelation) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String(ext.LogKeyTraceID, strconv.FormatUint(lc.TraceID, 10)),
+		slog.String(ext.LogKeySpanID, strconv.FormatUint(lc.SpanID, 10)),
+	}
+	if lc.Service != "" {
+		attrs = append(attrs, slog.String(ext.LogKeyService, lc.Service))
+	}
+	if lc.Env != "" {
+		attrs = append(attrs, slog.String(ext.LogKeyEnv, lc.Env))
+	}
+	if lc.Version != "" {
+		attrs = append(attrs, slog.String(ext.LogKeyVersion, lc.Version))
+	}
+	return attrs
+}
+
+// with returns a copy of h with op applied. group reports whether op adds a group.
+func (h *handler) with(op func(slog.Handler) slog.Handler, group bool) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{
+		base:    h.base,
+		ops:     append(ops, op),
+		wrapped: op(h.wrapped),
+		grouped: h.grouped || group,
+		cfg:     h.cfg,
+	}
+}
+
+// WithAttrs implements slog.Handler.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) }, false)
+}
+
+// WithGroup implements slog.Handler.
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) }, true)
+}
+
+// setErrorTags sets the error tags of span from the last error attribute of r, or
+// from its message if it has none.
+func setErrorTags(span ddtrace.Span, r slog.Record) {
+	var err error
+	r.Attrs(func(a slog.Attr) bool {
+		if e, ok := a.Value.Resolve().Any().(error); ok {
+			err = e
+		}
+		return true
+	})
+	if err != nil {
+		span.SetTag(ext.Error, err)
+		return
+	}
+	span.SetTag(ext.Error, true)
+	span.SetTag(ext.ErrorMsg, r.Message)
+}
@@ -0,0 +1,157 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.21
+// +build go1.21
+
+package slog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newLogger returns a logger writing JSON records to the returned buffer.
+func newLogger(opts ...Option) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(WrapHandler(slog.NewJSONHandler(&buf, nil), opts...)), &buf
+}
+
+// lastRecord decodes the last record written to buf.
+func lastRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var rec map[string]interface{}
+	if err := json.Unmarshal(lines[len(lines)-1], &rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// countingHandler counts the calls to WithAttrs.
+type countingHandler struct {
+	slog.Handler
+	withAttrs int
+}
+
+func (h *countingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.withAttrs++
+	return h.Handler.WithAttrs(attrs)
+}
+
+func TestWrapHandler(t *testing.T) {
+	t.Run("span", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, buf := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.InfoContext(ctx, "hello")
+
+		rec := lastRecord(t, buf)
+		assert.Equal("hello", rec["msg"])
+		assert.Equal(strconv.FormatUint(span.Context().TraceID(), 10), rec[ext.LogKeyTraceID])
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), rec[ext.LogKeySpanID])
+	})
+
+	t.Run("attrs", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		var buf bytes.Buffer
+		base := &countingHandler{Handler: slog.NewJSONHandler(&buf, nil)}
+		logger := slog.New(WrapHandler(base)).With("a", 1)
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.InfoContext(ctx, "first")
+		logger.InfoContext(ctx, "second")
+
+		rec := lastRecord(t, &buf)
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), rec[ext.LogKeySpanID])
+		assert.Equal(1., rec["a"])
+		assert.Equal(1, base.withAttrs, "the logger attributes are only formatted once")
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, buf := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.With("a", 1).WithGroup("request").With("b", 2).InfoContext(ctx, "hello", "c", 3)
+
+		rec := lastRecord(t, buf)
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), rec[ext.LogKeySpanID])
+		assert.Equal(1., rec["a"])
+		assert.Equal(map[string]interface{}{"b": 2., "c": 3.}, rec["request"])
+
+		logger.WithGroup("request").Info("no span")
+		assert.NotContains(lastRecord(t, buf), ext.LogKeySpanID)
+	})
+
+	t.Run("groups-cached", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		var buf bytes.Buffer
+		base := &countingHandler{Handler: slog.NewJSONHandler(&buf, nil)}
+		logger := slog.New(WrapHandler(base)).WithGroup("request").With("a", 1)
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.InfoContext(ctx, "first")
+		logger.InfoContext(ctx, "second")
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), lastRecord(t, &buf)[ext.LogKeySpanID])
+		assert.Equal(1, base.withAttrs, "the handler should be derived once per span")
+
+		child, ctx := tracer.StartSpanFromContext(ctx, "db.query")
+		logger.InfoContext(ctx, "third")
+		assert.Equal(strconv.FormatUint(child.Context().SpanID(), 10), lastRecord(t, &buf)[ext.LogKeySpanID])
+		assert.Equal(2, base.withAttrs)
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.Info("no context")
+		assert.NotContains(t, lastRecord(t, buf), ext.LogKeyTraceID)
+		logger.InfoContext(context.Background(), "no span")
+		assert.NotContains(t, lastRecord(t, buf), ext.LogKeyTraceID)
+	})
+
+	t.Run("error-tags", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger(WithErrorTags())
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		ms := span.(mocktracer.Span)
+
+		logger.WarnContext(ctx, "not an error")
+		assert.Nil(ms.Tag(ext.Error))
+		logger.ErrorContext(ctx, "query failed")
+		assert.Equal(true, ms.Tag(ext.Error))
+		assert.Equal("query failed", ms.Tag(ext.ErrorMsg))
+
+		err := errors.New("broken")
+		logger.ErrorContext(ctx, "query failed", "error", err)
+		assert.Equal(err, ms.Tag(ext.Error))
+	})
+
+	t.Run("error-tags-disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.ErrorContext(ctx, "query failed")
+		assert.Nil(t, span.(mocktracer.Span).Tag(ext.Error))
+	})
+}
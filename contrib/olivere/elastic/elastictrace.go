@@ -19,6 +19,7 @@ import (
 	"regexp"
 	"strconv"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/obfuscate"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -66,6 +67,9 @@ func (t *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	contentEncoding := req.Header.Get("Content-Encoding")
 	snip, rc, err := peek(req.Body, contentEncoding, int(req.ContentLength), bodyCutoff)
 	if err == nil {
+		if t.config.obfuscate {
+			snip = obfuscate.JSON(snip)
+		}
 		span.SetTag("elasticsearch.body", snip)
 	}
 	req.Body = rc
@@ -116,7 +116,7 @@ func TestClientErrorCutoffV3(t *testing.T) {
 	}()
 	bodyCutoff = 10
 
-	tc := NewHTTPClient(WithServiceName("my-es-service"))
+	tc := NewHTTPClient(WithServiceName("my-es-service"), WithObfuscation(false))
 	client, err := elasticv5.NewClient(
 		elasticv5.SetURL("http://127.0.0.1:9200"),
 		elasticv5.SetHttpClient(tc),
@@ -146,7 +146,7 @@ func TestClientErrorCutoffV5(t *testing.T) {
 	}()
 	bodyCutoff = 10
 
-	tc := NewHTTPClient(WithServiceName("my-es-service"))
+	tc := NewHTTPClient(WithServiceName("my-es-service"), WithObfuscation(false))
 	client, err := elasticv5.NewClient(
 		elasticv5.SetURL("http://127.0.0.1:9201"),
 		elasticv5.SetHttpClient(tc),
@@ -262,7 +262,7 @@ func checkPUTTrace(assert *assert.Assertions, mt mocktracer.Tracer) {
 	assert.Equal("PUT /twitter/tweet/?", span.Tag(ext.ResourceName))
 	assert.Equal("/twitter/tweet/1", span.Tag("elasticsearch.url"))
 	assert.Equal("PUT", span.Tag("elasticsearch.method"))
-	assert.Equal(`{"user": "test", "message": "hello"}`, span.Tag("elasticsearch.body"))
+	assert.Equal(`{"user":"?","message":"?"}`, span.Tag("elasticsearch.body"))
 }
 
 func checkGETTrace(assert *assert.Assertions, mt mocktracer.Tracer) {
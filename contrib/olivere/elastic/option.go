@@ -17,6 +17,7 @@ type clientConfig struct {
 	transport     *http.Transport
 	analyticsRate float64
 	resourceNamer func(url, method string) string
+	obfuscate     bool
 }
 
 // ClientOption represents an option that can be used when creating a client.
@@ -26,6 +27,7 @@ func defaults(cfg *clientConfig) {
 	cfg.serviceName = "elastic.client"
 	cfg.transport = http.DefaultTransport.(*http.Transport)
 	cfg.resourceNamer = quantize
+	cfg.obfuscate = true
 	// cfg.analyticsRate = globalconfig.AnalyticsRate()
 	if internal.BoolEnv("DD_TRACE_ELASTIC_ANALYTICS_ENABLED", false) {
 		cfg.analyticsRate = 1.0
@@ -80,3 +82,12 @@ func WithResourceNamer(namer func(url, method string) string) ClientOption {
 		cfg.resourceNamer = namer
 	}
 }
+
+// WithObfuscation specifies whether the request bodies recorded in the
+// elasticsearch.body tag are obfuscated, replacing all the values they hold
+// with "?". It is enabled by default.
+func WithObfuscation(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.obfuscate = on
+	}
+}
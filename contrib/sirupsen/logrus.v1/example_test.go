@@ -0,0 +1,25 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package logrus_test
+
+import (
+	"context"
+
+	logrustrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/sirupsen/logrus.v1"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Example() {
+	logrus.AddHook(logrustrace.NewHook(logrustrace.WithErrorTags()))
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	defer span.Finish()
+
+	// entries logged with a context holding a span are correlated with its trace
+	logrus.WithContext(ctx).Info("handling request")
+}
@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package logrus provides a hook correlating the entries of the sirupsen/logrus package
+// (https://github.com/sirupsen/logrus) with traces.
+package logrus // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/sirupsen/logrus.v1"
+
+import (
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook adding the IDs of the active span, along with the service,
+// environment and version of the program, to the entries logged with a context
+// holding a span, such as using logrus.WithContext.
+type Hook struct {
+	cfg *config
+}
+
+var _ logrus.Hook = (*Hook)(nil)
+
+// NewHook returns a new Hook, which should be added to loggers using AddHook.
+func NewHook(opts ...Option) *Hook {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &Hook{cfg: cfg}
+}
+
+// Levels implements logrus.Hook.
+func (h *Hook) Levels() []logrus.Level { return logrus.AllLevels }
+
+// Fire implements logrus.Hook.
+func (h *Hook) Fire(e *logrus.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	span, ok := tracer.SpanFromContext(e.Context)
+	if !ok {
+		return nil
+	}
+	lc := tracer.NewLogCorrelation(span)
+	e.Data[ext.LogKeyTraceID] = strconv.FormatUint(lc.TraceID, 10)
+	e.Data[ext.LogKeySpanID] = strconv.FormatUint(lc.SpanID, 10)
+	if lc.Service != "" {
+		e.Data[ext.LogKeyService] = lc.Service
+	}
+	if lc.Env != "" {
+		e.Data[ext.LogKeyEnv] = lc.Env
+	}
+	if lc.Version != "" {
+		e.Data[ext.LogKeyVersion] = lc.Version
+	}
+	if h.cfg.errorTags && e.Level <= logrus.ErrorLevel {
+		if err, ok := e.Data[logrus.ErrorKey].(error); ok {
+			span.SetTag(ext.Error, err)
+		} else {
+			span.SetTag(ext.Error, true)
+			span.SetTag(ext.ErrorMsg, e.Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package logrus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLogger returns a logger writing JSON entries to the returned buffer.
+func newLogger(opts ...Option) (*logrus.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(NewHook(opts...))
+	return logger, &buf
+}
+
+// lastEntry decodes the last entry written to buf.
+func lastEntry(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(lines[len(lines)-1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestHook(t *testing.T) {
+	os.Setenv("DD_ENV", "test-env")
+	defer os.Unsetenv("DD_ENV")
+	os.Setenv("DD_VERSION", "1.2.3")
+	defer os.Unsetenv("DD_VERSION")
+
+	t.Run("span", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, buf := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.WithContext(ctx).Info("hello")
+		span.Finish()
+
+		entry := lastEntry(t, buf)
+		assert.Equal("hello", entry["msg"])
+		assert.Equal(strconv.FormatUint(span.Context().TraceID(), 10), entry[ext.LogKeyTraceID])
+		assert.Equal(strconv.FormatUint(span.Context().SpanID(), 10), entry[ext.LogKeySpanID])
+		assert.Equal("test-env", entry[ext.LogKeyEnv])
+		assert.Equal("1.2.3", entry[ext.LogKeyVersion])
+		assert.Nil(mt.FinishedSpans()[0].Tag(ext.Error))
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.Info("no context")
+		assert.NotContains(t, lastEntry(t, buf), ext.LogKeyTraceID)
+		logger.WithContext(context.Background()).Info("no span")
+		assert.NotContains(t, lastEntry(t, buf), ext.LogKeyTraceID)
+	})
+
+	t.Run("error-tags", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger(WithErrorTags())
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.WithContext(ctx).Warn("not an error")
+		assert.Nil(span.(mocktracer.Span).Tag(ext.Error))
+		logger.WithContext(ctx).Error("query failed")
+		assert.Equal(true, span.(mocktracer.Span).Tag(ext.Error))
+		assert.Equal("query failed", span.(mocktracer.Span).Tag(ext.ErrorMsg))
+
+		err := errors.New("broken")
+		logger.WithContext(ctx).WithError(err).Error("query failed")
+		assert.Equal(err, span.(mocktracer.Span).Tag(ext.Error))
+	})
+
+	t.Run("error-tags-disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		logger, _ := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.WithContext(ctx).Error("query failed")
+		assert.Nil(t, span.(mocktracer.Span).Tag(ext.Error))
+	})
+}
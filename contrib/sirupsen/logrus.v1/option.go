@@ -0,0 +1,24 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package logrus
+
+type config struct {
+	errorTags bool
+}
+
+// Option represents an option that can be passed to NewHook.
+type Option func(*config)
+
+func defaults(cfg *config) {}
+
+// WithErrorTags marks the active span as having an error when an entry is logged
+// at the error level or above, setting the error tags of the span from the entry's
+// error field, or from its message if it has none.
+func WithErrorTags() Option {
+	return func(cfg *config) {
+		cfg.errorTags = true
+	}
+}
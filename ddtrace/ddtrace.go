@@ -59,6 +59,40 @@ type Span interface {
 	Context() SpanContext
 }
 
+// SpanWithEvents represents a Span which supports events. Callers should check
+// for it using a type assertion.
+type SpanWithEvents interface {
+	Span
+
+	// AddEvent attaches a timestamped event with the given name, such as a log
+	// entry, to the span. Events added after the span has finished are ignored.
+	AddEvent(name string, opts ...SpanEventOption)
+}
+
+// SpanWithLinks represents a Span which supports adding links after it was
+// started. Callers should check for it using a type assertion. Links known when
+// starting the span should be set using StartSpanConfig.Links instead.
+type SpanWithLinks interface {
+	Span
+
+	// AddLink records a link from the span to the span having the given context,
+	// which may belong to another trace, described by the given attributes. Links
+	// added after the span has finished are ignored.
+	AddLink(ctx SpanContext, attributes map[string]string)
+}
+
+// SpanWithTraceTags represents a Span which supports setting tags on the whole
+// trace it is part of, such as a tenant or a user ID known deep down the call
+// stack. Callers should check for it using a type assertion.
+type SpanWithTraceTags interface {
+	Span
+
+	// SetTraceTag sets a tag on the trace which the span is part of. Trace-level
+	// tags are added to the local root span of the trace when it is sent. Tags set
+	// after the local root span has finished are ignored.
+	SetTraceTag(key string, value interface{})
+}
+
 // SpanContext represents a span state that can propagate to descendant spans
 // and across process boundaries. It contains all the information needed to
 // spawn a direct descendant of the span that it belongs to. It can be used
@@ -76,6 +110,19 @@ type SpanContext interface {
 	ForeachBaggageItem(handler func(k, v string) bool)
 }
 
+// SpanContextW3C represents a SpanContext with an additional method to allow
+// access of the 128-bit trace id of the span, if present.
+type SpanContextW3C interface {
+	SpanContext
+
+	// TraceID128 returns the hex-encoded 128-bit trace ID that this context is carrying.
+	// The string will be exactly 32 bytes and may include leading zeroes.
+	TraceID128() string
+
+	// TraceID128Bytes returns the raw bytes of the 128-bit trace ID that this context is carrying.
+	TraceID128Bytes() [16]byte
+}
+
 // StartSpanOption is a configuration option that can be used with a Tracer's StartSpan method.
 type StartSpanOption func(cfg *StartSpanConfig)
 
@@ -101,6 +148,27 @@ type FinishConfig struct {
 
 	// SkipStackFrames specifies the offset at which to start reporting stack frames from the stack.
 	SkipStackFrames uint
+
+	// ErrorDetailsDepth specifies the maximum number of errors inspected in the chain
+	// of errors wrapped by Error. Implementations should use a default value when
+	// it is 0.
+	ErrorDetailsDepth uint
+}
+
+// SpanEventOption is a configuration option that can be used with a Span's AddEvent method.
+type SpanEventOption func(cfg *SpanEventConfig)
+
+// SpanEventConfig holds the configuration for adding an event to a span. It is usually
+// passed around by reference to one or more SpanEventOption functions which shape it
+// into its final form.
+type SpanEventConfig struct {
+	// Time holds the time at which the event occurred. Implementations should use
+	// the current time when Time.IsZero().
+	Time time.Time
+
+	// Attributes holds a set of key/value pairs describing the event. Values should
+	// be strings, booleans, numbers or slices of those.
+	Attributes map[string]interface{}
 }
 
 // StartSpanConfig holds the configuration for starting a new span. It is usually passed
@@ -122,6 +190,11 @@ type StartSpanConfig struct {
 	// Force-set the SpanID, rather than use a random number. If no Parent SpanContext is present,
 	// then this will also set the TraceID to the same value.
 	SpanID uint64
+
+	// Links holds the contexts of the spans which the new span should be linked to,
+	// in addition to its parent. Linked spans may belong to other traces, such as
+	// those of the messages processed together in a batch.
+	Links []SpanContext
 }
 
 // Logger implementations are able to log given messages that the tracer might output.
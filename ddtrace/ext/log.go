@@ -0,0 +1,20 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package ext
+
+// Keys of the fields added to log entries in order to correlate them with traces.
+const (
+	// LogKeyTraceID holds the ID of the trace which was active when the entry was logged.
+	LogKeyTraceID = "dd.trace_id"
+	// LogKeySpanID holds the ID of the span which was active when the entry was logged.
+	LogKeySpanID = "dd.span_id"
+	// LogKeyService holds the name of the service which logged the entry.
+	LogKeyService = "dd.service"
+	// LogKeyEnv holds the environment of the service which logged the entry.
+	LogKeyEnv = "dd.env"
+	// LogKeyVersion holds the version of the service which logged the entry.
+	LogKeyVersion = "dd.version"
+)
@@ -64,6 +64,10 @@ const (
 	// ErrorDetails holds details about an error which implements a formatter.
 	ErrorDetails = "error.details"
 
+	// ErrorChain holds the types and messages of an error and of the errors it
+	// wraps, one per line.
+	ErrorChain = "error.chain"
+
 	// Environment specifies the environment to use with a trace.
 	Environment = "env"
 
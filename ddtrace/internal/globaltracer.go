@@ -65,7 +65,12 @@ func (NoopTracer) Inject(context ddtrace.SpanContext, carrier interface{}) error
 // Stop implements ddtrace.Tracer.
 func (NoopTracer) Stop() {}
 
-var _ ddtrace.Span = (*NoopSpan)(nil)
+var (
+	_ ddtrace.Span              = (*NoopSpan)(nil)
+	_ ddtrace.SpanWithEvents    = (*NoopSpan)(nil)
+	_ ddtrace.SpanWithLinks     = (*NoopSpan)(nil)
+	_ ddtrace.SpanWithTraceTags = (*NoopSpan)(nil)
+)
 
 // NoopSpan is an implementation of ddtrace.Span that is a no-op.
 type NoopSpan struct{}
@@ -82,6 +87,15 @@ func (NoopSpan) BaggageItem(key string) string { return "" }
 // SetBaggageItem implements ddtrace.Span.
 func (NoopSpan) SetBaggageItem(key, val string) {}
 
+// AddEvent implements ddtrace.SpanWithEvents.
+func (NoopSpan) AddEvent(name string, opts ...ddtrace.SpanEventOption) {}
+
+// AddLink implements ddtrace.SpanWithLinks.
+func (NoopSpan) AddLink(ctx ddtrace.SpanContext, attributes map[string]string) {}
+
+// SetTraceTag implements ddtrace.SpanWithTraceTags.
+func (NoopSpan) SetTraceTag(key string, value interface{}) {}
+
 // Finish implements ddtrace.Span.
 func (NoopSpan) Finish(opts ...ddtrace.FinishOption) {}
 
@@ -14,8 +14,12 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 )
 
-var _ ddtrace.Span = (*mockspan)(nil)
-var _ Span = (*mockspan)(nil)
+var (
+	_ ddtrace.Span           = (*mockspan)(nil)
+	_ ddtrace.SpanWithEvents = (*mockspan)(nil)
+	_ ddtrace.SpanWithLinks  = (*mockspan)(nil)
+	_ Span                   = (*mockspan)(nil)
+)
 
 // Span is an interface that allows querying a span returned by the mock tracer.
 type Span interface {
@@ -43,6 +47,12 @@ type Span interface {
 	// Tags returns a copy of all the tags in this span.
 	Tags() map[string]interface{}
 
+	// Events returns a copy of the events added to this span, in order.
+	Events() []SpanEvent
+
+	// Links returns a copy of the links recorded on this span, in order.
+	Links() []SpanLink
+
 	// Context returns the span's SpanContext.
 	Context() ddtrace.SpanContext
 
@@ -50,6 +60,31 @@ type Span interface {
 	fmt.Stringer
 }
 
+// SpanEvent holds an event added to a span using AddEvent.
+type SpanEvent struct {
+	// Name holds the name of the event.
+	Name string
+
+	// Time holds the time at which the event occurred.
+	Time time.Time
+
+	// Attributes holds the attributes of the event.
+	Attributes map[string]interface{}
+}
+
+// SpanLink holds a link from a span to another span, recorded using the
+// WithSpanLinks start option or AddLink.
+type SpanLink struct {
+	// TraceID holds the trace ID of the linked span.
+	TraceID uint64
+
+	// SpanID holds the ID of the linked span.
+	SpanID uint64
+
+	// Attributes holds the attributes of the link.
+	Attributes map[string]string
+}
+
 func newSpan(t *mocktracer, operationName string, cfg *ddtrace.StartSpanConfig) *mockspan {
 	if cfg.Tags == nil {
 		cfg.Tags = make(map[string]interface{})
@@ -92,6 +127,9 @@ func newSpan(t *mocktracer, operationName string, cfg *ddtrace.StartSpanConfig)
 	for k, v := range cfg.Tags {
 		s.SetTag(k, v)
 	}
+	for _, ctx := range cfg.Links {
+		s.AddLink(ctx, nil)
+	}
 	return s
 }
 
@@ -99,6 +137,8 @@ type mockspan struct {
 	sync.RWMutex // guards below fields
 	name         string
 	tags         map[string]interface{}
+	events       []SpanEvent
+	links        []SpanLink
 	finishTime   time.Time
 	finished     bool
 
@@ -129,6 +169,54 @@ func (s *mockspan) SetTag(key string, value interface{}) {
 	s.tags[key] = value
 }
 
+// AddEvent adds an event with the given name to the span.
+func (s *mockspan) AddEvent(name string, opts ...ddtrace.SpanEventOption) {
+	var cfg ddtrace.SpanEventConfig
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+	if cfg.Time.IsZero() {
+		cfg.Time = time.Now()
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		return
+	}
+	s.events = append(s.events, SpanEvent{Name: name, Time: cfg.Time, Attributes: cfg.Attributes})
+}
+
+func (s *mockspan) Events() []SpanEvent {
+	s.RLock()
+	defer s.RUnlock()
+	// copy
+	cp := make([]SpanEvent, len(s.events))
+	copy(cp, s.events)
+	return cp
+}
+
+// AddLink links the span to the span having the given context.
+func (s *mockspan) AddLink(ctx ddtrace.SpanContext, attributes map[string]string) {
+	if ctx == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		return
+	}
+	s.links = append(s.links, SpanLink{TraceID: ctx.TraceID(), SpanID: ctx.SpanID(), Attributes: attributes})
+}
+
+func (s *mockspan) Links() []SpanLink {
+	s.RLock()
+	defer s.RUnlock()
+	// copy
+	cp := make([]SpanLink, len(s.links))
+	copy(cp, s.links)
+	return cp
+}
+
 func (s *mockspan) FinishTime() time.Time {
 	s.RLock()
 	defer s.RUnlock()
@@ -220,13 +308,15 @@ func (s *mockspan) String() string {
 	return fmt.Sprintf(`
 name: %s
 tags: %#v
+events: %#v
+links: %#v
 start: %s
 finish: %s
 id: %d
 parent: %d
 trace: %d
 baggage: %#v
-`, s.name, s.tags, s.startTime, s.finishTime, sc.spanID, s.parentID, sc.traceID, sc.baggage)
+`, s.name, s.tags, s.events, s.links, s.startTime, s.finishTime, sc.spanID, s.parentID, sc.traceID, sc.baggage)
 }
 
 // Context returns the SpanContext of this Span.
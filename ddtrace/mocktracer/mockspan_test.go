@@ -118,6 +118,40 @@ func TestSpanFinishTime(t *testing.T) {
 	assert.Equal(finishTime, s.FinishTime())
 }
 
+func TestSpanAddEvent(t *testing.T) {
+	s := basicSpan("http.request")
+	eventTime := time.Now().Add(-time.Second)
+	attrs := map[string]interface{}{"attempt": 2}
+	s.AddEvent("retry", tracer.EventTime(eventTime), tracer.EventAttributes(attrs))
+	s.AddEvent("done")
+	s.Finish()
+	s.AddEvent("late")
+
+	assert := assert.New(t)
+	events := s.Events()
+	assert.Len(events, 2)
+	assert.Equal(SpanEvent{Name: "retry", Time: eventTime, Attributes: attrs}, events[0])
+	assert.Equal("done", events[1].Name)
+	assert.False(events[1].Time.IsZero())
+	assert.Nil(events[1].Attributes)
+}
+
+func TestSpanLinks(t *testing.T) {
+	first, second := basicSpan("produce"), basicSpan("produce")
+	s := newSpan(&mocktracer{}, "consume", &ddtrace.StartSpanConfig{
+		Links: []ddtrace.SpanContext{first.Context()},
+	})
+	attrs := map[string]string{"reason": "batch"}
+	s.AddLink(second.Context(), attrs)
+	s.Finish()
+	s.AddLink(first.Context(), nil)
+
+	assert.Equal(t, []SpanLink{
+		{TraceID: first.TraceID(), SpanID: first.SpanID()},
+		{TraceID: second.TraceID(), SpanID: second.SpanID(), Attributes: attrs},
+	}, s.Links())
+}
+
 func TestSpanOperationName(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
 		s := basicSpan("http.request")
@@ -7,6 +7,7 @@ package opentracer
 
 import (
 	"fmt"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -24,42 +25,86 @@ type span struct {
 	*opentracer
 }
 
-func (s *span) Context() opentracing.SpanContext                      { return s.Span.Context() }
-func (s *span) Finish()                                               { s.Span.Finish() }
-func (s *span) Tracer() opentracing.Tracer                            { return s.opentracer }
-func (s *span) LogEvent(event string)                                 { /* deprecated */ }
-func (s *span) LogEventWithPayload(event string, payload interface{}) { /* deprecated */ }
-func (s *span) Log(data opentracing.LogData)                          { /* deprecated */ }
+func (s *span) Context() opentracing.SpanContext { return s.Span.Context() }
+func (s *span) Finish()                          { s.Span.Finish() }
+func (s *span) Tracer() opentracing.Tracer       { return s.opentracer }
+
+// LogEvent is deprecated: use LogFields or LogKV.
+func (s *span) LogEvent(event string) {
+	s.logFields(time.Time{}, log.String("event", event))
+}
+
+// LogEventWithPayload is deprecated: use LogFields or LogKV.
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.logFields(time.Time{}, log.String("event", event), log.Object("payload", payload))
+}
+
+// Log is deprecated: use LogFields or LogKV.
+func (s *span) Log(data opentracing.LogData) {
+	lr := data.ToLogRecord()
+	s.logFields(lr.Timestamp, lr.Fields...)
+}
 
 func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
 	for _, lr := range opts.LogRecords {
 		if len(lr.Fields) > 0 {
-			s.LogFields(lr.Fields...)
+			s.logFields(lr.Timestamp, lr.Fields...)
 		}
 	}
 	s.Span.Finish(tracer.FinishTime(opts.FinishTime))
 }
 
 func (s *span) LogFields(fields ...log.Field) {
-	// catch standard opentracing keys and adjust to internal ones as per spec:
-	// https://github.com/opentracing/specification/blob/master/semantic_conventions.md#log-fields-table
+	s.logFields(time.Time{}, fields...)
+}
+
+// logFields adds an event holding the given fields to the span, occurring at time t,
+// or now if t is zero. The event is named after the "event" field, or "log" if there
+// is none. Error logs also set the error tags, as per the spec:
+// https://github.com/opentracing/specification/blob/master/semantic_conventions.md#log-fields-table
+func (s *span) logFields(t time.Time, fields ...log.Field) {
+	var (
+		name       = "log"
+		isError    bool
+		err        error
+		msg, stack string
+		attrs      = make(map[string]interface{}, len(fields))
+	)
 	for _, f := range fields {
 		switch f.Key() {
 		case "event":
-			if v, ok := f.Value().(string); ok && v == "error" {
-				s.SetTag("error", true)
+			name = fmt.Sprint(f.Value())
+			if name == "error" {
+				isError = true
 			}
+			continue
 		case "error", "error.object":
-			if err, ok := f.Value().(error); ok {
-				s.SetTag("error", err)
+			if e, ok := f.Value().(error); ok {
+				isError, err = true, e
 			}
 		case "message":
-			s.SetTag(ext.ErrorMsg, fmt.Sprint(f.Value()))
+			msg = fmt.Sprint(f.Value())
 		case "stack":
-			s.SetTag(ext.ErrorStack, fmt.Sprint(f.Value()))
-		default:
-			// not implemented
+			stack = fmt.Sprint(f.Value())
 		}
+		attrs[f.Key()] = f.Value()
+	}
+	if es, ok := s.Span.(ddtrace.SpanWithEvents); ok {
+		es.AddEvent(name, tracer.EventTime(t), tracer.EventAttributes(attrs))
+	}
+	if !isError {
+		return
+	}
+	if err != nil {
+		s.Span.SetTag(ext.Error, err)
+	} else {
+		s.Span.SetTag(ext.Error, true)
+	}
+	if msg != "" {
+		s.Span.SetTag(ext.ErrorMsg, msg)
+	}
+	if stack != "" {
+		s.Span.SetTag(ext.ErrorStack, stack)
 	}
 }
 
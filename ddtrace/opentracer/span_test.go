@@ -0,0 +1,95 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package opentracer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSpan starts the mock tracer and returns a span wrapping one of its spans,
+// along with the latter. The returned function stops the mock tracer.
+func mockSpan() (*span, mocktracer.Span, func()) {
+	mt := mocktracer.Start()
+	s := tracer.StartSpan("test.operation")
+	return &span{Span: s}, s.(mocktracer.Span), mt.Stop
+}
+
+func TestSpanLogFields(t *testing.T) {
+	t.Run("event", func(t *testing.T) {
+		assert := assert.New(t)
+		s, ms, stop := mockSpan()
+		defer stop()
+		s.LogFields(log.String("event", "cache.miss"), log.String("message", "not found"), log.Int("size", 3))
+		s.LogKV("key", "users")
+
+		events := ms.Events()
+		assert.Len(events, 2)
+		assert.Equal("cache.miss", events[0].Name)
+		assert.Equal(map[string]interface{}{"message": "not found", "size": 3}, events[0].Attributes)
+		assert.Equal("log", events[1].Name)
+		assert.Equal(map[string]interface{}{"key": "users"}, events[1].Attributes)
+		// non-error logs leave the tags untouched
+		assert.Nil(ms.Tag(ext.Error))
+		assert.Nil(ms.Tag(ext.ErrorMsg))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+		s, ms, stop := mockSpan()
+		defer stop()
+		err := errors.New("broken")
+		s.LogFields(log.String("event", "error"), log.Error(err), log.String("message", "query failed"), log.String("stack", "main.go:1"))
+
+		events := ms.Events()
+		assert.Len(events, 1)
+		assert.Equal("error", events[0].Name)
+		assert.Equal(err, events[0].Attributes["error.object"])
+		assert.Equal(err, ms.Tag(ext.Error))
+		assert.Equal("query failed", ms.Tag(ext.ErrorMsg))
+		assert.Equal("main.go:1", ms.Tag(ext.ErrorStack))
+	})
+
+	t.Run("finish", func(t *testing.T) {
+		assert := assert.New(t)
+		s, ms, stop := mockSpan()
+		defer stop()
+		logTime := time.Now().Add(-time.Second)
+		s.FinishWithOptions(opentracing.FinishOptions{
+			LogRecords: []opentracing.LogRecord{
+				{Timestamp: logTime, Fields: []log.Field{log.String("event", "flushed")}},
+			},
+		})
+
+		events := ms.Events()
+		assert.Len(events, 1)
+		assert.Equal("flushed", events[0].Name)
+		assert.Equal(logTime, events[0].Time)
+	})
+
+	t.Run("deprecated", func(t *testing.T) {
+		assert := assert.New(t)
+		s, ms, stop := mockSpan()
+		defer stop()
+		s.LogEvent("started")
+		s.LogEventWithPayload("received", 42)
+
+		events := ms.Events()
+		assert.Len(events, 2)
+		assert.Equal("started", events[0].Name)
+		assert.Equal("received", events[1].Name)
+		assert.Equal(map[string]interface{}{"payload": 42}, events[1].Attributes)
+	})
+}
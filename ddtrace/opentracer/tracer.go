@@ -48,13 +48,22 @@ func (t *opentracer) StartSpan(operationName string, options ...opentracing.Star
 		o.Apply(&sso)
 	}
 	opts := []ddtrace.StartSpanOption{tracer.StartTime(sso.StartTime)}
+	var parented bool
 	for _, ref := range sso.References {
-		if v, ok := ref.ReferencedContext.(ddtrace.SpanContext); ok {
-			// opentracing.ChildOfRef and opentracing.FollowsFromRef will both be represented as
-			// children because Datadog APM does not have a concept of FollowsFrom references.
-			opts = append(opts, tracer.ChildOf(v))
-			break // can only have one parent
+		v, ok := ref.ReferencedContext.(ddtrace.SpanContext)
+		if !ok {
+			continue
 		}
+		if parented {
+			// a span can only have one parent; it is linked to the
+			// spans of any further references
+			opts = append(opts, tracer.WithSpanLinks(v))
+			continue
+		}
+		// opentracing.ChildOfRef and opentracing.FollowsFromRef will both be represented as
+		// children because Datadog APM does not have a concept of FollowsFrom references.
+		opts = append(opts, tracer.ChildOf(v))
+		parented = true
 	}
 	for k, v := range sso.Tags {
 		opts = append(opts, tracer.Tag(k, v))
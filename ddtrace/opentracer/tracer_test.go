@@ -11,6 +11,7 @@ import (
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/opentracing/opentracing-go"
@@ -37,3 +38,20 @@ func TestSpanWithContext(t *testing.T) {
 	assert.True(ok)
 	assert.Equal(got, want.(*span).Span)
 }
+
+func TestStartSpanReferences(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	ot := &opentracer{Tracer: internal.GetGlobalTracer()}
+	parent := ot.StartSpan("parent")
+	other := ot.StartSpan("other")
+	s := ot.StartSpan("child", opentracing.ChildOf(parent.Context()), opentracing.FollowsFrom(other.Context()))
+
+	ms := s.(*span).Span.(mocktracer.Span)
+	assert.Equal(parent.(*span).Span.Context().SpanID(), ms.ParentID())
+	links := ms.Links()
+	if assert.Len(links, 1) {
+		assert.Equal(other.(*span).Span.Context().SpanID(), links[0].SpanID)
+	}
+}
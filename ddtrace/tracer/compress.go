@@ -0,0 +1,47 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// encodingGzip is the content encoding which may be used to compress the payloads
+// sent to the agent.
+const encodingGzip = "gzip"
+
+// validEncoding reports whether enc is a supported content encoding.
+func validEncoding(enc string) bool {
+	return enc == encodingGzip
+}
+
+// gzipWriters holds reusable gzip writers.
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// compress returns the contents of r compressed using the given content encoding.
+func compress(enc string, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	switch enc {
+	case encodingGzip:
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(&buf)
+		if _, err := io.Copy(w, r); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", enc)
+}
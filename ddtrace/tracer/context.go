@@ -49,3 +49,15 @@ func StartSpanFromContext(ctx context.Context, operationName string, opts ...Sta
 	s := StartSpan(operationName, opts...)
 	return s, ContextWithSpan(ctx, s)
 }
+
+// SetTraceTag sets a tag on the trace of the span contained in the given context,
+// making it available on the local root span of the trace once it is sent. It
+// does nothing if the context holds no span implementing ddtrace.SpanWithTraceTags.
+func SetTraceTag(ctx context.Context, key string, value interface{}) {
+	if ctx == nil {
+		return
+	}
+	if s, ok := ctx.Value(activeSpanKey).(ddtrace.SpanWithTraceTags); ok {
+		s.SetTraceTag(key, value)
+	}
+}
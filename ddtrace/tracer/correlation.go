@@ -0,0 +1,42 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"os"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
+)
+
+// LogCorrelation holds the information which should be added to the entries logged
+// while a span is active in order to correlate them with its trace. The fields are
+// usually named after the ext.LogKey* constants.
+type LogCorrelation struct {
+	// TraceID and SpanID hold the IDs of the active span.
+	TraceID, SpanID uint64
+
+	// Service, Env and Version hold the unified service tags of the program.
+	// They are empty when not configured.
+	Service, Env, Version string
+}
+
+// NewLogCorrelation returns the information correlating the entries logged while s
+// is active with its trace. It is used by the log integrations, and can be used to
+// correlate the entries of loggers which have none.
+func NewLogCorrelation(s ddtrace.Span) LogCorrelation {
+	lc := LogCorrelation{Service: globalconfig.ServiceName()}
+	if ctx := s.Context(); ctx != nil {
+		lc.TraceID, lc.SpanID = ctx.TraceID(), ctx.SpanID()
+	}
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+		lc.Env, lc.Version = t.config.env, t.config.version
+	} else {
+		lc.Env, lc.Version = os.Getenv("DD_ENV"), os.Getenv("DD_VERSION")
+	}
+	return lc
+}
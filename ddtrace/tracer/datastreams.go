@@ -0,0 +1,45 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
+)
+
+// dataStreamsTransport sends the stats computed at the checkpoints of the data
+// pipelines (see package internal/datastreams) to the agent, on behalf of the
+// started tracer.
+type dataStreamsTransport struct {
+	transport *httpTransport
+	env       string
+	service   string
+}
+
+var _ datastreams.Transport = (*dataStreamsTransport)(nil)
+
+// SendPipelineStats implements datastreams.Transport.
+func (t *dataStreamsTransport) SendPipelineStats(p *datastreams.StatsPayload) error {
+	p.Env = t.env
+	p.Service = t.service
+	p.TracerVersion = version.Tag
+	p.Lang = "go"
+	return t.transport.sendPipelineStats(p)
+}
+
+// startDataStreams sets up the sending of the data streams stats to the agent,
+// if the tracer sends its payloads to one.
+func (t *tracer) startDataStreams() {
+	tr, ok := t.config.transport.(*httpTransport)
+	if !ok || t.config.logToStdout || t.config.otlpEndpoint != "" {
+		return
+	}
+	datastreams.SetTransport(&dataStreamsTransport{
+		transport: tr,
+		env:       t.config.env,
+		service:   t.config.serviceName,
+	})
+}
@@ -0,0 +1,53 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestDataStreamsTransport(t *testing.T) {
+	assert := assert.New(t)
+	var got datastreams.StatsPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/v0.1/pipeline_stats", r.URL.Path)
+		assert.Equal("go", r.Header.Get("Datadog-Meta-Lang"))
+		zr, err := gzip.NewReader(r.Body)
+		if !assert.NoError(err) {
+			return
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(zr)
+		assert.NoError(msgp.Decode(&buf, &got))
+	}))
+	defer srv.Close()
+
+	dt := &dataStreamsTransport{
+		transport: newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient),
+		env:       "prod",
+		service:   "billing",
+	}
+	p := &datastreams.StatsPayload{Stats: []datastreams.StatsBucket{{Start: 10, Duration: 10}}}
+	assert.NoError(dt.SendPipelineStats(p))
+	assert.Equal(datastreams.StatsPayload{
+		Env:           "prod",
+		Service:       "billing",
+		Stats:         []datastreams.StatsBucket{{Start: 10, Duration: 10}},
+		TracerVersion: version.Tag,
+		Lang:          "go",
+	}, got)
+}
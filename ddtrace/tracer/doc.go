@@ -21,8 +21,10 @@
 //   tracer.Start(tracer.WithSampler(s))
 //
 // More precise control of sampling rates can be configured using sampling rules.
-// This can be applied based on span name, service or both, and is used to determine
-// the sampling rate to apply.
+// This can be applied based on span name, service, resource and tags, and is used to
+// determine the sampling rate to apply. Rules are matched against the root span of each
+// trace, once when it starts and again when it finishes, unless the sampling decision
+// was propagated to another service in the meantime.
 //   rules := []tracer.SamplingRule{
 //         // sample 10% of traces with the span name "web.request"
 //         tracer.NameRule("web.request", 0.1),
@@ -33,6 +35,14 @@
 //         tracer.NameServiceRule("db.query", "postgres.db", 0.3),
 //         // sample 100% of traces when service and name match these regular expressions
 //         {Service: regexp.MustCompile("^test-"), Name: regexp.MustCompile("http\\..*"), Rate: 1.0},
+//         // sample 1% of health checks, and all the checkout requests of premium customers,
+//         // using glob patterns where "*" matches any sequence of characters and "?" any
+//         // single character
+//         tracer.TagsResourceRule(nil, "GET /health*", "", "", 0.01),
+//         tracer.TagsResourceRule(map[string]string{"customer.tier": "premium"}, "POST /checkout", "", "web-*", 1.0),
+//         // sample all other traces of "web-frontend", but no more than 10 per second,
+//         // regardless of the global rate limit
+//         {Service: regexp.MustCompile("^web-frontend$"), Rate: 1.0, MaxPerSecond: 10},
 //   }
 //   tracer.Start(tracer.WithSamplingRules(rules))
 //   defer tracer.Stop()
@@ -40,8 +50,11 @@
 // Sampling rules can also be configured at runtime using the DD_TRACE_SAMPLING_RULES
 // environment variable. When set, it overrides rules set by tracer.WithSamplingRules.
 // The value is a JSON array of objects. Each object must have a "sample_rate", and the
-// "name" and "service" fields are optional.
+// "name", "service", "resource" and "tags" fields are optional glob patterns, as in
+// tracer.TagsResourceRule. The optional "max_per_second" field limits the number of
+// traces sampled per second by the rule, in place of DD_TRACE_RATE_LIMIT.
 //    export DD_TRACE_SAMPLING_RULES='[{"name": "web.request", "sample_rate": 1.0}]'
+//    export DD_TRACE_SAMPLING_RULES='[{"resource": "POST /checkout", "tags": {"http.status_code": "5??"}, "sample_rate": 1.0}]'
 //
 // All spans created by the tracer contain a context hereby referred to as the span
 // context. Note that this is different from Go's context. The span context is used
@@ -75,6 +75,7 @@ func logStartup(t *tracer) {
 		tags[k] = fmt.Sprintf("%v", v)
 	}
 
+	sampling := t.rulesSampling.config()
 	info := startupInfo{
 		Date:                  time.Now().Format(time.RFC3339),
 		OSName:                osName(),
@@ -87,8 +88,8 @@ func logStartup(t *tracer) {
 		AgentURL:              t.config.transport.endpoint(),
 		Debug:                 t.config.debug,
 		AnalyticsEnabled:      !math.IsNaN(globalconfig.AnalyticsRate()),
-		SampleRate:            fmt.Sprintf("%f", t.rulesSampling.globalRate),
-		SamplingRules:         t.rulesSampling.rules,
+		SampleRate:            fmt.Sprintf("%f", sampling.SampleRate),
+		SamplingRules:         sampling.Rules,
 		Tags:                  tags,
 		RuntimeMetricsEnabled: t.config.runtimeMetrics,
 		HealthMetricsEnabled:  t.config.runtimeMetrics,
@@ -101,7 +102,7 @@ func logStartup(t *tracer) {
 	if _, err := samplingRulesFromEnv(); err != nil {
 		info.SamplingRulesError = fmt.Sprintf("%s", err)
 	}
-	if !t.config.logToStdout {
+	if !t.config.logToStdout && t.config.otlpEndpoint == "" {
 		if err := checkEndpoint(t.config.transport.endpoint()); err != nil {
 			info.AgentError = fmt.Sprintf("%s", err)
 			log.Warn("DIAGNOSTICS Unable to reach agent intake: %s", err)
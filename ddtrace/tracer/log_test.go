@@ -92,7 +92,7 @@ func TestLogSamplingRules(t *testing.T) {
 	defer stop()
 
 	assert.Len(tp.Lines(), 2)
-	assert.Contains(tp.Lines()[0], "WARN: at index 4: ignoring rule {Service: Name: Rate:9.10}: rate is out of [0.0, 1.0] range")
+	assert.Contains(tp.Lines()[0], "WARN: at index 4: ignoring rule {Service: Name: Resource: Tags:map[] Rate:9.10 MaxPerSecond:0}: rate is out of [0.0, 1.0] range")
 	assert.Regexp(`Datadog Tracer v[0-9]+\.[0-9]+\.[0-9]+ WARN: DIAGNOSTICS Error\(s\) parsing DD_TRACE_SAMPLING_RULES: found errors:\n\tat index 1: rate not provided\n\tat index 3: rate not provided$`, tp.Lines()[1])
 }
 
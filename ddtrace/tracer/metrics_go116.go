@@ -0,0 +1,252 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.16
+// +build go1.16
+
+package tracer
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// runtimeMetricsPrefix prefixes the names of the metrics reported from the
+// runtime/metrics package.
+const runtimeMetricsPrefix = "runtime.go.metrics."
+
+// maxHistogramSamples specifies the maximum number of values reported per
+// interval for each histogram. Beyond it, the values are spread over the
+// quantiles of the observations, which preserves their distribution but
+// not their count.
+const maxHistogramSamples = 100
+
+// reportRuntimeMetrics periodically reports go runtime metrics at
+// the given interval, using the runtime/metrics package. Unless disabled,
+// the metrics obtained using runtime.ReadMemStats are reported too.
+func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
+	c := newRuntimeMetricsCollector(t.config.statsd)
+	var legacy *memStatsCollector
+	if t.config.legacyRuntimeMetrics {
+		legacy = newMemStatsCollector(t.config.statsd)
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			log.Debug("Reporting runtime metrics...")
+			c.report(now)
+			if legacy != nil {
+				legacy.report()
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// runtimeMetricsCollector reports the metrics of the runtime/metrics package.
+// Unlike runtime.ReadMemStats, reading them doesn't stop the world.
+//
+// Scalar metrics are reported as gauges, named after the metric, e.g.
+// "/gc/heap/goal:bytes" is reported as "runtime.go.metrics.gc_heap_goal.bytes".
+// Cumulative integer metrics, such as "/gc/cycles/total:gc-cycles", are reported
+// as counts of the increase observed during each interval. Cumulative float
+// metrics, such as CPU times, are reported as their per-second rate of increase,
+// with the ".rate" suffix. Histograms of durations, such as GC pauses and scheduler latencies, are
+// reported as distributions of the values observed during each interval.
+// Other histograms, such as allocations by size class, are reported as the
+// per-second rate of each bucket, tagged with its upper bound.
+type runtimeMetricsCollector struct {
+	statsd     statsdClient
+	samples    []metrics.Sample
+	names      []string // names[i] is the statsd name of samples[i]
+	cumulative []bool   // cumulative[i] reports whether samples[i] is cumulative
+
+	// prev holds the histograms read at the previous report, by sample index,
+	// to compute the values observed since. Likewise, prevUint64 and prevFloat64
+	// hold the values of the cumulative scalar metrics.
+	prev        map[int]*metrics.Float64Histogram
+	prevUint64  map[int]uint64
+	prevFloat64 map[int]float64
+	prevTime    time.Time
+}
+
+// newRuntimeMetricsCollector returns a collector reporting the supported runtime
+// metrics to statsd.
+func newRuntimeMetricsCollector(statsd statsdClient) *runtimeMetricsCollector {
+	c := &runtimeMetricsCollector{
+		statsd:      statsd,
+		prev:        make(map[int]*metrics.Float64Histogram),
+		prevUint64:  make(map[int]uint64),
+		prevFloat64: make(map[int]float64),
+		prevTime:    time.Now(),
+	}
+	for _, d := range metrics.All() {
+		if strings.HasPrefix(d.Name, "/godebug/") {
+			// counts of non-default GODEBUG behaviors; too many and
+			// rarely of interest
+			continue
+		}
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.names = append(c.names, runtimeMetricName(d.Name))
+		c.cumulative = append(c.cumulative, d.Cumulative)
+	}
+	// read once to establish the baseline of the histograms and counters
+	metrics.Read(c.samples)
+	for i, s := range c.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			c.prevUint64[i] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			c.prevFloat64[i] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			c.prev[i] = copyHistogram(s.Value.Float64Histogram())
+		}
+	}
+	return c
+}
+
+// runtimeMetricName returns the statsd name of the runtime/metrics metric name.
+func runtimeMetricName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	name = strings.NewReplacer("/", "_", "-", "_", ":", ".", "*", "").Replace(name)
+	return runtimeMetricsPrefix + name
+}
+
+// copyHistogram returns a copy of h, whose contents are otherwise reused by
+// the next metrics.Read call.
+func copyHistogram(h *metrics.Float64Histogram) *metrics.Float64Histogram {
+	return &metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: h.Buckets, // immutable
+	}
+}
+
+// report reads and reports the runtime metrics at time now.
+func (c *runtimeMetricsCollector) report(now time.Time) {
+	metrics.Read(c.samples)
+	elapsed := now.Sub(c.prevTime).Seconds()
+	c.prevTime = now
+
+	c.statsd.Gauge("runtime.go.num_cpu", float64(runtime.NumCPU()), nil, 1)
+	c.statsd.Gauge("runtime.go.num_goroutine", float64(runtime.NumGoroutine()), nil, 1)
+	c.statsd.Gauge("runtime.go.num_cgo_call", float64(runtime.NumCgoCall()), nil, 1)
+	for i, s := range c.samples {
+		name := c.names[i]
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			if !c.cumulative[i] {
+				c.statsd.Gauge(name, float64(v), nil, 1)
+				continue
+			}
+			if prev := c.prevUint64[i]; v >= prev {
+				c.statsd.Count(name, int64(v-prev), nil, 1)
+			}
+			c.prevUint64[i] = v
+		case metrics.KindFloat64:
+			v := s.Value.Float64()
+			if !c.cumulative[i] {
+				c.statsd.Gauge(name, v, nil, 1)
+				continue
+			}
+			if prev := c.prevFloat64[i]; v >= prev && elapsed > 0 {
+				c.statsd.Gauge(name+".rate", (v-prev)/elapsed, nil, 1)
+			}
+			c.prevFloat64[i] = v
+		case metrics.KindFloat64Histogram:
+			h := copyHistogram(s.Value.Float64Histogram())
+			delta := histogramDelta(h, c.prev[i])
+			c.prev[i] = h
+			if strings.HasSuffix(s.Name, ":seconds") {
+				c.reportDistribution(name, h.Buckets, delta)
+			} else if elapsed > 0 {
+				c.reportBucketRates(name, h.Buckets, delta, elapsed)
+			}
+		}
+	}
+}
+
+// histogramDelta returns the number of values observed in each bucket of h since
+// prev was read.
+func histogramDelta(h, prev *metrics.Float64Histogram) []uint64 {
+	delta := make([]uint64, len(h.Counts))
+	copy(delta, h.Counts)
+	if prev != nil && len(prev.Counts) == len(h.Counts) {
+		for i, n := range prev.Counts {
+			if delta[i] >= n {
+				delta[i] -= n
+			}
+		}
+	}
+	return delta
+}
+
+// bucketValue returns the value representing the bucket i of a histogram with the
+// given boundaries, which is its midpoint unless it is unbounded.
+func bucketValue(buckets []float64, i int) float64 {
+	lo, hi := buckets[i], buckets[i+1]
+	switch {
+	case math.IsInf(lo, -1):
+		return hi
+	case math.IsInf(hi, 1):
+		return lo
+	}
+	return (lo + hi) / 2
+}
+
+// reportDistribution reports the values counted in each bucket by counts as a
+// distribution. At most maxHistogramSamples values are reported.
+func (c *runtimeMetricsCollector) reportDistribution(name string, buckets []float64, counts []uint64) {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+	if total <= maxHistogramSamples {
+		for i, n := range counts {
+			for ; n > 0; n-- {
+				c.statsd.Distribution(name, bucketValue(buckets, i), nil, 1)
+			}
+		}
+		return
+	}
+	// report the values found at evenly spaced quantiles
+	i, seen := 0, counts[0]
+	for k := 0; k < maxHistogramSamples; k++ {
+		rank := uint64((float64(k) + 0.5) / maxHistogramSamples * float64(total))
+		for seen <= rank && i < len(counts)-1 {
+			i++
+			seen += counts[i]
+		}
+		c.statsd.Distribution(name, bucketValue(buckets, i), nil, 1)
+	}
+}
+
+// reportBucketRates reports the per-second rate of the values counted in each
+// bucket by counts over the given number of seconds, tagged with the upper bound
+// of the bucket.
+func (c *runtimeMetricsCollector) reportBucketRates(name string, buckets []float64, counts []uint64, seconds float64) {
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		bound := "inf"
+		if hi := buckets[i+1]; !math.IsInf(hi, 1) {
+			bound = strconv.FormatFloat(hi, 'f', -1, 64)
+		}
+		c.statsd.Gauge(name+".rate", float64(n)/seconds, []string{"upper_bound:" + bound}, 1)
+	}
+}
@@ -0,0 +1,153 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.16
+// +build go1.16
+
+package tracer
+
+import (
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportRuntimeMetrics(t *testing.T) {
+	report := func(opts ...StartOption) []string {
+		var tg testStatsdClient
+		trc := newUnstartedTracer(append(opts, withStatsdClient(&tg))...)
+		trc.wg.Add(1)
+		go func() {
+			defer trc.wg.Done()
+			trc.reportRuntimeMetrics(time.Millisecond)
+		}()
+		err := tg.Wait(35, 1*time.Second)
+		close(trc.stop)
+		trc.wg.Wait()
+		assert.NoError(t, err)
+		return tg.CallNames()
+	}
+
+	t.Run("default", func(t *testing.T) {
+		calls := report()
+		assert := assert.New(t)
+		assert.Contains(calls, "runtime.go.num_cpu")
+		assert.Contains(calls, "runtime.go.metrics.gc_heap_goal.bytes")
+		assert.Contains(calls, "runtime.go.metrics.sched_goroutines.goroutines")
+		assert.NotContains(calls, "runtime.go.mem_stats.alloc")
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		calls := report(WithLegacyRuntimeMetrics(true))
+		assert := assert.New(t)
+		assert.Contains(calls, "runtime.go.metrics.gc_heap_goal.bytes")
+		assert.Contains(calls, "runtime.go.mem_stats.alloc")
+		assert.Contains(calls, "runtime.go.gc_stats.pause_quantiles.75p")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert.False(t, newConfig().legacyRuntimeMetrics)
+		os.Setenv("DD_RUNTIME_METRICS_LEGACY_ENABLED", "true")
+		defer os.Unsetenv("DD_RUNTIME_METRICS_LEGACY_ENABLED")
+		assert.True(t, newConfig().legacyRuntimeMetrics)
+	})
+}
+
+func TestRuntimeMetricsCollector(t *testing.T) {
+	assert := assert.New(t)
+	var tg testStatsdClient
+	c := newRuntimeMetricsCollector(&tg)
+
+	var sink [][]byte
+	for i := 0; i < 1000; i++ {
+		sink = append(sink, make([]byte, 64))
+	}
+	runtime.GC()
+	runtime.KeepAlive(sink)
+	c.report(time.Now().Add(time.Second))
+
+	var pauses int
+	for _, call := range tg.DistributionCalls() {
+		assert.True(strings.HasSuffix(call.name, ".seconds"), call.name)
+		if strings.Contains(call.name, "pauses") {
+			pauses++
+			assert.True(call.floatVal >= 0)
+		}
+	}
+	assert.NotZero(pauses)
+
+	var allocs bool
+	for _, call := range tg.GaugeCalls() {
+		if call.name == "runtime.go.metrics.gc_heap_allocs_by_size.bytes.rate" {
+			allocs = true
+			assert.Len(call.tags, 1)
+			assert.True(strings.HasPrefix(call.tags[0], "upper_bound:"))
+		}
+	}
+	assert.True(allocs)
+
+	// cumulative metrics report their increase
+	assert.True(tg.Counts()["runtime.go.metrics.gc_cycles_total.gc_cycles"] >= 1)
+	for _, call := range tg.GaugeCalls() {
+		assert.NotEqual("runtime.go.metrics.gc_cycles_total.gc_cycles", call.name)
+		assert.NotEqual("runtime.go.metrics.cpu_classes_gc_total.cpu_seconds", call.name)
+	}
+	assert.Contains(tg.CallNames(), "runtime.go.metrics.cpu_classes_gc_total.cpu_seconds.rate")
+
+	// histograms only report what was observed since the previous report
+	tg.Reset()
+	c.report(time.Now().Add(2 * time.Second))
+	for _, call := range tg.DistributionCalls() {
+		assert.NotContains(call.name, "gc_pauses")
+	}
+}
+
+func TestRuntimeMetricName(t *testing.T) {
+	for in, out := range map[string]string{
+		"/gc/heap/goal:bytes":               "runtime.go.metrics.gc_heap_goal.bytes",
+		"/sched/latencies:seconds":          "runtime.go.metrics.sched_latencies.seconds",
+		"/gc/heap/allocs-by-size:bytes":     "runtime.go.metrics.gc_heap_allocs_by_size.bytes",
+		"/cpu/classes/gc/total:cpu-seconds": "runtime.go.metrics.cpu_classes_gc_total.cpu_seconds",
+	} {
+		assert.Equal(t, out, runtimeMetricName(in))
+	}
+}
+
+func TestReportDistribution(t *testing.T) {
+	buckets := []float64{0, 1, 2, 3}
+	t.Run("all", func(t *testing.T) {
+		var tg testStatsdClient
+		c := &runtimeMetricsCollector{statsd: &tg}
+		c.reportDistribution("d", buckets, []uint64{1, 0, 2})
+		var vals []float64
+		for _, call := range tg.DistributionCalls() {
+			vals = append(vals, call.floatVal)
+		}
+		assert.Equal(t, []float64{0.5, 2.5, 2.5}, vals)
+	})
+
+	t.Run("quantiles", func(t *testing.T) {
+		var tg testStatsdClient
+		c := &runtimeMetricsCollector{statsd: &tg}
+		c.reportDistribution("d", buckets, []uint64{9000, 0, 1000})
+		counts := make(map[float64]int)
+		for _, call := range tg.DistributionCalls() {
+			counts[call.floatVal]++
+		}
+		assert.Equal(t, map[float64]int{0.5: 90, 2.5: 10}, counts)
+	})
+}
+
+func TestHistogramDelta(t *testing.T) {
+	prev := &metrics.Float64Histogram{Counts: []uint64{1, 2, 3}}
+	h := &metrics.Float64Histogram{Counts: []uint64{1, 5, 4}}
+	assert.Equal(t, []uint64{0, 3, 1}, histogramDelta(h, prev))
+	assert.Equal(t, []uint64{1, 5, 4}, histogramDelta(h, nil))
+}
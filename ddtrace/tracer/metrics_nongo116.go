@@ -0,0 +1,33 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build !go1.16
+// +build !go1.16
+
+package tracer
+
+import (
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// reportRuntimeMetrics periodically reports go runtime metrics at
+// the given interval. The runtime/metrics package is not available,
+// so runtime.MemStats are used.
+func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
+	c := newMemStatsCollector(t.config.statsd)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			log.Debug("Reporting runtime metrics...")
+			c.report()
+		case <-t.stop:
+			return
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -82,6 +83,10 @@ type config struct {
 	// runtimeMetrics specifies whether collection of runtime metrics is enabled.
 	runtimeMetrics bool
 
+	// legacyRuntimeMetrics specifies whether the runtime metrics obtained using
+	// runtime.ReadMemStats are reported along with the runtime/metrics ones.
+	legacyRuntimeMetrics bool
+
 	// dogstatsdAddr specifies the address to connect for sending metrics to the
 	// Datadog Agent. If not set, it defaults to "localhost:8125" or to the
 	// combination of the environment variables DD_AGENT_HOST and DD_DOGSTATSD_PORT.
@@ -94,6 +99,14 @@ type config struct {
 	// to spans.
 	samplingRules []SamplingRule
 
+	// spanSamplingRules contains user-defined rules determining the spans to keep
+	// from the traces which are not sampled.
+	spanSamplingRules []SamplingRule
+
+	// samplingConfigFile specifies the path of a file holding sampling settings,
+	// which are applied each time the file changes.
+	samplingConfigFile string
+
 	// tickChan specifies a channel which will receive the time every time the tracer must flush.
 	// It defaults to time.Ticker; replaced in tests.
 	tickChan <-chan time.Time
@@ -101,6 +114,48 @@ type config struct {
 	// noDebugStack disables the collection of debug stack traces globally. No traces reporting
 	// errors will record a stack trace when this option is set.
 	noDebugStack bool
+
+	// traceID128BitEnabled specifies whether new traces should be started with
+	// 128-bit trace IDs instead of 64-bit ones.
+	traceID128BitEnabled bool
+
+	// otlpEndpoint specifies the URL of an OpenTelemetry Collector's OTLP/HTTP
+	// traces endpoint. When set, traces are sent there instead of to the agent.
+	otlpEndpoint string
+
+	// spillDir specifies the directory in which payloads that failed to be sent
+	// to the agent are stored, to be replayed later. Spilling is disabled when empty.
+	spillDir string
+
+	// spillMaxSize specifies the maximum total size in bytes of the spilled payloads.
+	spillMaxSize int64
+
+	// spillMaxAge specifies the maximum age of a spilled payload.
+	spillMaxAge time.Duration
+
+	// compression specifies the content encoding ("gzip") used to compress
+	// payloads sent to the agent, if the agent supports it.
+	compression string
+
+	// sendAttempts specifies the maximum number of attempts made to deliver a
+	// payload to the agent.
+	sendAttempts int
+
+	// partialFlushEnabled specifies whether the finished spans of a trace which
+	// is not yet complete may be sent in chunks.
+	partialFlushEnabled bool
+
+	// partialFlushMinSpans specifies the number of finished spans which triggers
+	// a partial flush of a trace that is not yet complete.
+	partialFlushMinSpans int
+
+	// baggageMaxItems specifies the maximum number of baggage items a span
+	// context may hold.
+	baggageMaxItems int
+
+	// baggageMaxBytes specifies the maximum total size in bytes of the keys
+	// and values of the baggage items a span context may hold.
+	baggageMaxBytes int
 }
 
 // HasFeature reports whether feature f is enabled.
@@ -109,6 +164,18 @@ func (c *config) HasFeature(f string) bool {
 	return ok
 }
 
+// defaultPartialFlushMinSpans is the default number of finished spans which
+// triggers a partial flush, when enabled.
+const defaultPartialFlushMinSpans = 1000
+
+const (
+	// defaultBaggageMaxItems is the default maximum number of baggage items.
+	defaultBaggageMaxItems = 64
+
+	// defaultBaggageMaxBytes is the default maximum total size of the baggage items.
+	defaultBaggageMaxBytes = 8192
+)
+
 // StartOption represents a function that can be provided as a parameter to Start.
 type StartOption func(*config)
 
@@ -185,7 +252,46 @@ func newConfig(opts ...StartOption) *config {
 	}
 	c.logStartup = internal.BoolEnv("DD_TRACE_STARTUP_LOGS", true)
 	c.runtimeMetrics = internal.BoolEnv("DD_RUNTIME_METRICS_ENABLED", false)
+	c.legacyRuntimeMetrics = internal.BoolEnv("DD_RUNTIME_METRICS_LEGACY_ENABLED", false)
 	c.debug = internal.BoolEnv("DD_TRACE_DEBUG", false)
+	c.traceID128BitEnabled = internal.BoolEnv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED", false)
+	c.partialFlushEnabled = internal.BoolEnv("DD_TRACE_PARTIAL_FLUSH_ENABLED", false)
+	c.partialFlushMinSpans = defaultPartialFlushMinSpans
+	if v := os.Getenv("DD_TRACE_PARTIAL_FLUSH_MIN_SPANS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.partialFlushMinSpans = n
+		} else {
+			log.Warn("Invalid value for DD_TRACE_PARTIAL_FLUSH_MIN_SPANS (%q), using default of %d", v, defaultPartialFlushMinSpans)
+		}
+	}
+	c.baggageMaxItems = defaultBaggageMaxItems
+	if v := os.Getenv("DD_TRACE_BAGGAGE_MAX_ITEMS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.baggageMaxItems = n
+		} else {
+			log.Warn("Invalid value for DD_TRACE_BAGGAGE_MAX_ITEMS (%q), using default of %d", v, defaultBaggageMaxItems)
+		}
+	}
+	c.baggageMaxBytes = defaultBaggageMaxBytes
+	if v := os.Getenv("DD_TRACE_BAGGAGE_MAX_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.baggageMaxBytes = n
+		} else {
+			log.Warn("Invalid value for DD_TRACE_BAGGAGE_MAX_BYTES (%q), using default of %d", v, defaultBaggageMaxBytes)
+		}
+	}
+	if v := os.Getenv("DD_TRACE_COMPRESSION"); v != "" {
+		WithCompression(v)(c)
+	}
+	c.samplingConfigFile = os.Getenv("DD_TRACE_SAMPLING_CONFIG_FILE")
+	c.sendAttempts = defaultSendAttempts
+	if v := os.Getenv("DD_TRACE_SEND_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.sendAttempts = n
+		} else {
+			log.Warn("Invalid value for DD_TRACE_SEND_MAX_ATTEMPTS (%q), using default of %d", v, defaultSendAttempts)
+		}
+	}
 	for _, fn := range opts {
 		fn(c)
 	}
@@ -215,7 +321,9 @@ func newConfig(opts ...StartOption) *config {
 		}
 	}
 	if c.transport == nil {
-		c.transport = newHTTPTransport(c.agentAddr, c.httpClient)
+		t := newHTTPTransport(c.agentAddr, c.httpClient)
+		t.maxAttempts = c.sendAttempts
+		c.transport = t
 	}
 	if c.propagator == nil {
 		c.propagator = NewPropagator(nil)
@@ -303,6 +411,49 @@ func WithDebugStack(enabled bool) StartOption {
 	}
 }
 
+// With128BitTraceIDs specifies whether new traces should be started with 128-bit
+// trace IDs. The lower 64 bits remain available through SpanContext.TraceID, while
+// the full ID can be obtained via the ddtrace.SpanContextW3C interface. It is disabled
+// by default and can also be enabled using DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED.
+func With128BitTraceIDs(enabled bool) StartOption {
+	return func(c *config) {
+		c.traceID128BitEnabled = enabled
+	}
+}
+
+// WithPartialFlushing enables flushing of partially finished traces. Once minSpans
+// spans of a trace have finished, they are sent to the agent even if the rest of the
+// trace (e.g. the root span) is still running. This is useful for long-running
+// traces, which would otherwise only be visible once they complete and risk being
+// dropped when growing too large. A minSpans value lower than 1 keeps the current
+// threshold, which defaults to 1000. It may also be enabled by setting
+// DD_TRACE_PARTIAL_FLUSH_ENABLED and DD_TRACE_PARTIAL_FLUSH_MIN_SPANS.
+func WithPartialFlushing(minSpans int) StartOption {
+	return func(c *config) {
+		c.partialFlushEnabled = true
+		if minSpans > 0 {
+			c.partialFlushMinSpans = minSpans
+		}
+	}
+}
+
+// WithBaggageLimits limits the baggage carried by span contexts to maxItems items,
+// having keys and values of at most maxBytes bytes in total. Baggage items which
+// would exceed the limits are dropped and counted in the tracer's health metrics.
+// Values lower than 1 keep the current limits, which default to 64 items and
+// 8192 bytes. They may also be set using DD_TRACE_BAGGAGE_MAX_ITEMS and
+// DD_TRACE_BAGGAGE_MAX_BYTES.
+func WithBaggageLimits(maxItems, maxBytes int) StartOption {
+	return func(c *config) {
+		if maxItems > 0 {
+			c.baggageMaxItems = maxItems
+		}
+		if maxBytes > 0 {
+			c.baggageMaxBytes = maxBytes
+		}
+	}
+}
+
 // WithDebugMode enables debug mode on the tracer, resulting in more verbose logging.
 func WithDebugMode(enabled bool) StartOption {
 	return func(c *config) {
@@ -317,6 +468,59 @@ func WithLambdaMode(enabled bool) StartOption {
 	}
 }
 
+// WithOTLPExporter configures the tracer to send traces to an OpenTelemetry Collector
+// using the OTLP/HTTP protocol with protobuf encoding, instead of sending them to the
+// Datadog Agent. The endpoint is the full URL of the collector's traces endpoint, such
+// as "http://localhost:4318/v1/traces". The HTTP client set using WithHTTPClient is
+// used to reach the collector, if any.
+func WithOTLPExporter(endpoint string) StartOption {
+	return func(c *config) {
+		c.otlpEndpoint = endpoint
+	}
+}
+
+// WithSpillDirectory enables a persistent queue for traces which could not be sent to
+// the agent, for example during agent restarts. Failed payloads are written to dir and
+// replayed with an exponential backoff once the agent can be reached again. Payloads
+// are evicted, oldest first, once their total size exceeds maxSize bytes or when they
+// are older than maxAge. Zero values for maxSize and maxAge default to 64MB and one hour.
+func WithSpillDirectory(dir string, maxSize int64, maxAge time.Duration) StartOption {
+	return func(c *config) {
+		c.spillDir = dir
+		c.spillMaxSize = maxSize
+		c.spillMaxAge = maxAge
+	}
+}
+
+// WithCompression compresses the trace and stats payloads sent to the agent using
+// the given content encoding, which must be "gzip". The agent is queried
+// for the encodings it accepts at startup, and payloads are sent uncompressed when
+// it does not advertise support for the requested one. It may also be enabled by
+// setting DD_TRACE_COMPRESSION.
+func WithCompression(encoding string) StartOption {
+	return func(c *config) {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && !validEncoding(encoding) {
+			log.Warn("Unsupported compression %q, payloads will be sent uncompressed", encoding)
+			encoding = ""
+		}
+		c.compression = encoding
+	}
+}
+
+// WithSendAttempts sets the maximum number of attempts made to deliver a payload to
+// the agent. Connection errors, rate limiting (429) and server errors (5xx) are
+// retried with a capped exponential backoff, until the tracer is stopped. The default
+// of 3 attempts may also be changed by setting DD_TRACE_SEND_MAX_ATTEMPTS. A value
+// of 1 disables retries.
+func WithSendAttempts(n int) StartOption {
+	return func(c *config) {
+		if n > 0 {
+			c.sendAttempts = n
+		}
+	}
+}
+
 // WithPropagator sets an alternative propagator to be used by the tracer.
 func WithPropagator(p Propagator) StartOption {
 	return func(c *config) {
@@ -434,12 +638,31 @@ func WithAnalyticsRate(rate float64) StartOption {
 }
 
 // WithRuntimeMetrics enables automatic collection of runtime metrics every 10 seconds.
+// They are read from the runtime/metrics package without stopping the world and
+// reported with the "runtime.go.metrics." prefix, including histograms of GC pauses
+// and scheduler latencies as distributions. The metrics previously reported with
+// the "runtime.go.mem_stats." and "runtime.go.gc_stats." prefixes can be reported
+// too; see WithLegacyRuntimeMetrics. On Go versions older than 1.16, which lack
+// the runtime/metrics package, only the latter are reported.
 func WithRuntimeMetrics() StartOption {
 	return func(cfg *config) {
 		cfg.runtimeMetrics = true
 	}
 }
 
+// WithLegacyRuntimeMetrics specifies whether the runtime metrics reported with the
+// "runtime.go.mem_stats." and "runtime.go.gc_stats." prefixes, which are read using
+// runtime.ReadMemStats and stop the world, are reported along with the ones read
+// from the runtime/metrics package. It is disabled by default and can also be set
+// using the DD_RUNTIME_METRICS_LEGACY_ENABLED environment variable. This option is
+// in effect when WithRuntimeMetrics is enabled, on Go 1.16 and newer; older
+// versions always report these metrics.
+func WithLegacyRuntimeMetrics(enabled bool) StartOption {
+	return func(cfg *config) {
+		cfg.legacyRuntimeMetrics = enabled
+	}
+}
+
 // WithDogstatsdAddress specifies the address to connect to for sending metrics
 // to the Datadog Agent. If not set, it defaults to "localhost:8125" or to the
 // combination of the environment variables DD_AGENT_HOST and DD_DOGSTATSD_PORT.
@@ -458,6 +681,43 @@ func WithSamplingRules(rules []SamplingRule) StartOption {
 	}
 }
 
+// WithSpanSamplingRules specifies single-span sampling rules. They are matched
+// against each span of the traces which are not sampled, in order, and the spans
+// sampled by the first matching rule are kept and sent to the agent on their own.
+// The rate of a rule applies to the spans it matches, and MaxPerSecond limits the
+// number of spans it keeps per second. Rules may be created using SpanNameServiceRule,
+// SpanNameServiceMPSRule or TagsResourceRule.
+//
+// Rules can also be set using the DD_SPAN_SAMPLING_RULES environment variable, which
+// overrides this option. It uses the format of DD_TRACE_SAMPLING_RULES, in which the
+// "sample_rate" field defaults to 1 and the "max_per_second" field may be set, e.g.:
+//
+//	[{"service": "db", "name": "sql.query", "max_per_second": 50}]
+func WithSpanSamplingRules(rules []SamplingRule) StartOption {
+	return func(cfg *config) {
+		cfg.spanSamplingRules = rules
+	}
+}
+
+// WithSamplingConfigFile specifies the path of a JSON file holding the sampling rules,
+// sample rate and rate limit to apply. The file is read when the tracer starts and
+// checked for changes every 10 seconds, each change replacing the settings of the
+// running tracer, as with UpdateSamplingConfig. Invalid files are reported and ignored.
+// The file holds an object such as:
+//
+//	{
+//		"sample_rate": 0.5,
+//		"rate_limit": 50,
+//		"rules": [{"service": "web", "name": "http.request", "sample_rate": 1.0}]
+//	}
+//
+// It may also be set using DD_TRACE_SAMPLING_CONFIG_FILE.
+func WithSamplingConfigFile(path string) StartOption {
+	return func(cfg *config) {
+		cfg.samplingConfigFile = path
+	}
+}
+
 // WithServiceVersion specifies the version of the service that is running. This will
 // be included in spans from this service in the "version" tag.
 func WithServiceVersion(version string) StartOption {
@@ -527,6 +787,16 @@ func ChildOf(ctx ddtrace.SpanContext) StartSpanOption {
 	}
 }
 
+// WithSpanLinks links the created span to the spans having the given contexts,
+// which may belong to other traces. This is useful when a span has several
+// causes, such as the processing of a batch of messages sent from different
+// traces, in which case at most one of them can be its parent.
+func WithSpanLinks(ctxs ...ddtrace.SpanContext) StartSpanOption {
+	return func(cfg *ddtrace.StartSpanConfig) {
+		cfg.Links = append(cfg.Links, ctxs...)
+	}
+}
+
 // StartTime sets a custom time as the start time for the created span. By
 // default a span is started using the creation time.
 func StartTime(t time.Time) StartSpanOption {
@@ -576,6 +846,19 @@ func NoDebugStack() FinishOption {
 	}
 }
 
+// WithErrorDetails limits to depth the number of errors inspected in the chain of
+// errors wrapped by the error given to WithError, including itself. The types and
+// messages of the inspected errors are recorded in the error.chain tag, and the
+// stack trace held by the innermost of them, such as those of the errors created
+// using github.com/pkg/errors, is preferred to the one of the place where the span
+// is finished. A depth of 1 only inspects the given error. By default, up to 8
+// errors are inspected.
+func WithErrorDetails(depth uint) FinishOption {
+	return func(cfg *ddtrace.FinishConfig) {
+		cfg.ErrorDetailsDepth = depth
+	}
+}
+
 // StackFrames limits the number of stack frames included into erroneous spans to n, starting from skip.
 func StackFrames(n, skip uint) FinishOption {
 	if n == 0 {
@@ -586,3 +869,24 @@ func StackFrames(n, skip uint) FinishOption {
 		cfg.SkipStackFrames = skip
 	}
 }
+
+// SpanEventOption is a configuration option for AddEvent. It is aliased in order
+// to help godoc group all the functions returning it together. It is considered
+// more correct to refer to it as the type as the origin, ddtrace.SpanEventOption.
+type SpanEventOption = ddtrace.SpanEventOption
+
+// EventTime sets the given time as the time at which a span event occurred. By
+// default, the current time is used.
+func EventTime(t time.Time) SpanEventOption {
+	return func(cfg *ddtrace.SpanEventConfig) {
+		cfg.Time = t
+	}
+}
+
+// EventAttributes sets the attributes of a span event. Values should be strings,
+// booleans, numbers or slices of those; other values are converted to strings.
+func EventAttributes(attrs map[string]interface{}) SpanEventOption {
+	return func(cfg *ddtrace.SpanEventConfig) {
+		cfg.Attributes = attrs
+	}
+}
@@ -0,0 +1,419 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
+)
+
+// otlpMaxBufferedSpans is the number of buffered spans which triggers a flush
+// of the otlpTraceWriter.
+const otlpMaxBufferedSpans = 1000
+
+// otlpTraceWriter converts traces into OTLP protobuf messages and sends them to an
+// OpenTelemetry Collector using the OTLP/HTTP protocol. See:
+// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#otlphttp
+type otlpTraceWriter struct {
+	// config holds the tracer configuration
+	config *config
+
+	// client is the HTTP client used to reach the collector
+	client *http.Client
+
+	// spans holds the spans which have not yet been sent
+	spans []*span
+
+	// count holds the number of traces in spans
+	count int
+
+	// droppedP0Traces and droppedP0Spans count the unsampled traces and spans
+	// which were dropped since the last flush
+	droppedP0Traces, droppedP0Spans int64
+
+	// climit limits the number of concurrent outgoing connections
+	climit chan struct{}
+
+	// wg waits for all uploads to finish
+	wg sync.WaitGroup
+}
+
+var _ traceWriter = (*otlpTraceWriter)(nil)
+
+func newOTLPTraceWriter(c *config) *otlpTraceWriter {
+	client := c.httpClient
+	if client == nil {
+		client = defaultClient
+	}
+	return &otlpTraceWriter{
+		config: c,
+		client: client,
+		climit: make(chan struct{}, concurrentConnectionLimit),
+	}
+}
+
+func (h *otlpTraceWriter) add(trace []*span) {
+	if len(trace) == 0 {
+		return
+	}
+	if p, ok := trace[0].context.samplingPriority(); ok && p <= 0 {
+		// there is no agent to drop unsampled traces; only the spans kept
+		// by single-span sampling rules are exported
+		h.droppedP0Traces++
+		kept := make([]*span, 0, len(trace))
+		for _, s := range trace {
+			if _, ok := s.Metrics[keySpanSamplingMechanism]; ok {
+				kept = append(kept, s)
+			}
+		}
+		h.droppedP0Spans += int64(len(trace) - len(kept))
+		if len(kept) == 0 {
+			return
+		}
+		trace = kept
+	}
+	h.spans = append(h.spans, trace...)
+	h.count++
+	if len(h.spans) >= otlpMaxBufferedSpans {
+		h.config.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:size"}, 1)
+		h.flush()
+	}
+}
+
+func (h *otlpTraceWriter) stop() {
+	h.config.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:shutdown"}, 1)
+	h.flush()
+	h.wg.Wait()
+}
+
+// flush sends any currently buffered spans to the collector.
+func (h *otlpTraceWriter) flush() {
+	if h.droppedP0Traces > 0 || h.droppedP0Spans > 0 {
+		h.config.statsd.Count("datadog.tracer.dropped_p0_traces", h.droppedP0Traces, nil, 1)
+		h.config.statsd.Count("datadog.tracer.dropped_p0_spans", h.droppedP0Spans, nil, 1)
+		h.droppedP0Traces, h.droppedP0Spans = 0, 0
+	}
+	if len(h.spans) == 0 {
+		return
+	}
+	h.wg.Add(1)
+	h.climit <- struct{}{}
+	go func(spans []*span, count int) {
+		defer func(start time.Time) {
+			<-h.climit
+			h.wg.Done()
+			h.config.statsd.Timing("datadog.tracer.flush_duration", time.Since(start), nil, 1)
+		}(time.Now())
+		body := encodeOTLPRequest(h.config, spans)
+		log.Debug("Sending OTLP payload: size: %d traces: %d\n", len(body), count)
+		if err := h.send(body); err != nil {
+			h.config.statsd.Count("datadog.tracer.traces_dropped", int64(count), []string{"reason:send_failed"}, 1)
+			log.Error("lost %d traces: %v", count, err)
+			return
+		}
+		h.config.statsd.Count("datadog.tracer.flush_bytes", int64(len(body)), nil, 1)
+		h.config.statsd.Count("datadog.tracer.flush_traces", int64(count), nil, 1)
+	}(h.spans, h.count)
+	h.spans = nil
+	h.count = 0
+}
+
+// send posts the given encoded ExportTraceServiceRequest to the collector.
+func (h *otlpTraceWriter) send(body []byte) error {
+	req, err := http.NewRequest("POST", h.config.otlpEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code < 200 || code >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1000))
+		txt := http.StatusText(code)
+		if len(msg) > 0 {
+			return fmt.Errorf("%s (Status: %s)", msg, txt)
+		}
+		return fmt.Errorf("%s", txt)
+	}
+	return nil
+}
+
+// OTLP span kinds, as defined in opentelemetry/proto/trace/v1/trace.proto.
+const (
+	otlpSpanKindUnspecified = 0
+	otlpSpanKindInternal    = 1
+	otlpSpanKindServer      = 2
+	otlpSpanKindClient      = 3
+	otlpSpanKindProducer    = 4
+	otlpSpanKindConsumer    = 5
+)
+
+// otlpStatusCodeError is the status code of a span which has an error.
+const otlpStatusCodeError = 2
+
+// otlpSpanKind returns the OTLP span kind of s. It is taken from the "span.kind"
+// tag when set, and otherwise derived from the span type.
+func otlpSpanKind(s *span) uint64 {
+	switch s.Meta["span.kind"] {
+	case "server":
+		return otlpSpanKindServer
+	case "client":
+		return otlpSpanKindClient
+	case "producer":
+		return otlpSpanKindProducer
+	case "consumer":
+		return otlpSpanKindConsumer
+	case "internal":
+		return otlpSpanKindInternal
+	}
+	switch s.Type {
+	case ext.SpanTypeWeb:
+		return otlpSpanKindServer
+	case ext.SpanTypeHTTP:
+		return otlpSpanKindClient
+	case "":
+		return otlpSpanKindInternal
+	}
+	return otlpSpanKindUnspecified
+}
+
+// encodeOTLPRequest encodes the given spans as an ExportTraceServiceRequest
+// protobuf message. Spans are grouped into one ResourceSpans per service.
+func encodeOTLPRequest(c *config, spans []*span) []byte {
+	byService := make(map[string][]*span)
+	for _, s := range spans {
+		byService[s.Service] = append(byService[s.Service], s)
+	}
+	services := make([]string, 0, len(byService))
+	for svc := range byService {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+
+	var req protoBuffer
+	for _, svc := range services {
+		var resource, scope, scopeSpans, resourceSpans protoBuffer
+
+		// Resource
+		resource.appendKeyValueString(1, "service.name", svc)
+		if c.env != "" {
+			resource.appendKeyValueString(1, "deployment.environment", c.env)
+		}
+		if c.version != "" && svc == c.serviceName {
+			resource.appendKeyValueString(1, "service.version", c.version)
+		}
+		resource.appendKeyValueString(1, "telemetry.sdk.name", "datadog")
+		resource.appendKeyValueString(1, "telemetry.sdk.language", "go")
+		resource.appendKeyValueString(1, "telemetry.sdk.version", version.Tag)
+
+		// InstrumentationScope
+		scope.appendString(1, "gopkg.in/DataDog/dd-trace-go.v1")
+		scope.appendString(2, version.Tag)
+
+		// ScopeSpans
+		scopeSpans.appendMessage(1, &scope)
+		for _, s := range byService[svc] {
+			scopeSpans.appendMessage(2, encodeOTLPSpan(s))
+		}
+
+		// ResourceSpans
+		resourceSpans.appendMessage(1, &resource)
+		resourceSpans.appendMessage(2, &scopeSpans)
+
+		req.appendMessage(1, &resourceSpans)
+	}
+	return req.Bytes()
+}
+
+// encodeOTLPSpan encodes s as an OTLP Span protobuf message.
+func encodeOTLPSpan(s *span) *protoBuffer {
+	var buf protoBuffer
+	var traceID [16]byte
+	if s.context != nil {
+		binary.BigEndian.PutUint64(traceID[:8], s.context.traceIDHigh)
+	}
+	binary.BigEndian.PutUint64(traceID[8:], s.TraceID)
+	buf.appendBytes(1, traceID[:])
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], s.SpanID)
+	buf.appendBytes(2, id[:])
+	if s.ParentID != 0 {
+		binary.BigEndian.PutUint64(id[:], s.ParentID)
+		buf.appendBytes(4, id[:])
+	}
+	buf.appendString(5, s.Name)
+	if kind := otlpSpanKind(s); kind != otlpSpanKindUnspecified {
+		buf.appendVarint(6, kind)
+	}
+	buf.appendFixed64(7, uint64(s.Start))
+	buf.appendFixed64(8, uint64(s.Start+s.Duration))
+
+	buf.appendKeyValueString(9, "resource.name", s.Resource)
+	if s.Type != "" {
+		buf.appendKeyValueString(9, "span.type", s.Type)
+	}
+	for k, v := range s.Meta {
+		buf.appendKeyValueString(9, k, v)
+	}
+	for k, v := range s.Metrics {
+		buf.appendKeyValueDouble(9, k, v)
+	}
+	for _, e := range s.Events {
+		var event protoBuffer
+		event.appendFixed64(1, e.TimeUnixNano)
+		event.appendString(2, e.Name)
+		for k, v := range e.Attributes {
+			event.appendKeyValue(3, k, v)
+		}
+		buf.appendMessage(11, &event)
+	}
+	for _, l := range s.Links {
+		var link protoBuffer
+		var traceID [16]byte
+		binary.BigEndian.PutUint64(traceID[:8], l.TraceIDHigh)
+		binary.BigEndian.PutUint64(traceID[8:], l.TraceID)
+		link.appendBytes(1, traceID[:])
+		binary.BigEndian.PutUint64(id[:], l.SpanID)
+		link.appendBytes(2, id[:])
+		for k, v := range l.Attributes {
+			link.appendKeyValueString(4, k, v)
+		}
+		buf.appendMessage(13, &link)
+	}
+	if s.Error != 0 {
+		var status protoBuffer
+		if msg := s.Meta[ext.ErrorMsg]; msg != "" {
+			status.appendString(2, msg)
+		}
+		status.appendVarint(3, otlpStatusCodeError)
+		buf.appendMessage(15, &status)
+	}
+	return &buf
+}
+
+// Protocol buffer wire types, as described in
+// https://developers.google.com/protocol-buffers/docs/encoding#structure
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+// protoBuffer is a minimal protocol buffer encoder, supporting only the field
+// types needed to produce OTLP trace messages.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) appendRawVarint(v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	b.Write(scratch[:n])
+}
+
+func (b *protoBuffer) appendTag(field, wireType int) {
+	b.appendRawVarint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) appendVarint(field int, v uint64) {
+	b.appendTag(field, protoWireVarint)
+	b.appendRawVarint(v)
+}
+
+func (b *protoBuffer) appendFixed64(field int, v uint64) {
+	var scratch [8]byte
+	binary.LittleEndian.PutUint64(scratch[:], v)
+	b.appendTag(field, protoWireFixed64)
+	b.Write(scratch[:])
+}
+
+func (b *protoBuffer) appendBytes(field int, v []byte) {
+	b.appendTag(field, protoWireBytes)
+	b.appendRawVarint(uint64(len(v)))
+	b.Write(v)
+}
+
+func (b *protoBuffer) appendString(field int, v string) {
+	b.appendTag(field, protoWireBytes)
+	b.appendRawVarint(uint64(len(v)))
+	b.WriteString(v)
+}
+
+func (b *protoBuffer) appendMessage(field int, m *protoBuffer) {
+	b.appendBytes(field, m.Bytes())
+}
+
+// appendKeyValueString appends a KeyValue message holding a string AnyValue.
+func (b *protoBuffer) appendKeyValueString(field int, k, v string) {
+	var value, kv protoBuffer
+	value.appendString(1, v)
+	kv.appendString(1, k)
+	kv.appendMessage(2, &value)
+	b.appendMessage(field, &kv)
+}
+
+// appendKeyValueDouble appends a KeyValue message holding a double AnyValue.
+func (b *protoBuffer) appendKeyValueDouble(field int, k string, v float64) {
+	var value, kv protoBuffer
+	value.appendFixed64(4, math.Float64bits(v))
+	kv.appendString(1, k)
+	kv.appendMessage(2, &value)
+	b.appendMessage(field, &kv)
+}
+
+// appendAnyValue appends an AnyValue message holding v, which is one of the
+// types allowed in span event attributes.
+func (b *protoBuffer) appendAnyValue(field int, v interface{}) {
+	var value protoBuffer
+	switch v := v.(type) {
+	case string:
+		value.appendString(1, v)
+	case bool:
+		var n uint64
+		if v {
+			n = 1
+		}
+		value.appendVarint(2, n)
+	case int64:
+		value.appendVarint(3, uint64(v))
+	case float64:
+		value.appendFixed64(4, math.Float64bits(v))
+	case []interface{}:
+		var array protoBuffer
+		for _, elem := range v {
+			array.appendAnyValue(1, elem)
+		}
+		value.appendMessage(5, &array)
+	default:
+		value.appendString(1, fmt.Sprint(v))
+	}
+	b.appendMessage(field, &value)
+}
+
+// appendKeyValue appends a KeyValue message holding v.
+func (b *protoBuffer) appendKeyValue(field int, k string, v interface{}) {
+	var kv protoBuffer
+	kv.appendString(1, k)
+	kv.appendAnyValue(2, v)
+	b.appendMessage(field, &kv)
+}
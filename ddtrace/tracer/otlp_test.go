@@ -0,0 +1,303 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// protoField holds a single decoded protocol buffer field.
+type protoField struct {
+	num   int
+	value uint64 // varint and fixed64 fields
+	bytes []byte // length-delimited fields
+}
+
+// decodeProto decodes the top-level fields of the protobuf message b.
+func decodeProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad tag")
+		}
+		b = b[n:]
+		f := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case protoWireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("bad varint")
+			}
+			b = b[n:]
+		case protoWireFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("bad fixed64")
+			}
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case protoWireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("bad length")
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return nil, errors.New("unsupported wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// protoMessage provides convenient access to the fields of a decoded message.
+type protoMessage []protoField
+
+func mustDecodeProto(t *testing.T, b []byte) protoMessage {
+	fields, err := decodeProto(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+// all returns all fields with the given number.
+func (m protoMessage) all(num int) []protoField {
+	var out []protoField
+	for _, f := range m {
+		if f.num == num {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// get returns the last field with the given number.
+func (m protoMessage) get(num int) protoField {
+	var out protoField
+	for _, f := range m {
+		if f.num == num {
+			out = f
+		}
+	}
+	return out
+}
+
+// attributes decodes the KeyValue fields with the given number into a map
+// holding string, bool, int64 or float64 values.
+func (m protoMessage) attributes(t *testing.T, num int) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	for _, f := range m.all(num) {
+		kv := mustDecodeProto(t, f.bytes)
+		value := mustDecodeProto(t, kv.get(2).bytes)
+		switch v := value[0]; v.num {
+		case 1:
+			attrs[string(kv.get(1).bytes)] = string(v.bytes)
+		case 2:
+			attrs[string(kv.get(1).bytes)] = v.value != 0
+		case 3:
+			attrs[string(kv.get(1).bytes)] = int64(v.value)
+		case 4:
+			attrs[string(kv.get(1).bytes)] = math.Float64frombits(v.value)
+		default:
+			t.Fatalf("unexpected AnyValue field %d", v.num)
+		}
+	}
+	return attrs
+}
+
+// otlpCollector is an in-process OTLP/HTTP collector which records the received requests.
+type otlpCollector struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	bodies [][]byte
+	status int
+}
+
+func newOTLPCollector() *otlpCollector {
+	c := &otlpCollector{status: http.StatusOK}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		c.bodies = append(c.bodies, body)
+		w.WriteHeader(c.status)
+	}))
+	return c
+}
+
+func (c *otlpCollector) Bodies() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bodies
+}
+
+func TestOTLPTraceWriter(t *testing.T) {
+	t.Run("export", func(t *testing.T) {
+		assert := assert.New(t)
+		collector := newOTLPCollector()
+		defer collector.Close()
+
+		tracer, _, _, stop := startTestTracer(t,
+			WithOTLPExporter(collector.URL+"/v1/traces"),
+			WithService("otlp-service"),
+			WithEnv("testenv"),
+			WithServiceVersion("1.2.3"),
+			With128BitTraceIDs(true),
+		)
+		root := tracer.StartSpan("web.request", ResourceName("GET /"), SpanType(ext.SpanTypeWeb)).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context()), ServiceName("db-service"), Tag("rows", 3)).(*span)
+		child.Finish(WithError(errors.New("broken")))
+		eventTime := time.Now().Add(-time.Second)
+		root.AddEvent("cache.miss", EventTime(eventTime), EventAttributes(map[string]interface{}{
+			"key":   "users",
+			"size":  3,
+			"stale": true,
+		}))
+		linked := tracer.StartSpan("upstream").(*span)
+		root.AddLink(linked.Context(), map[string]string{"reason": "retry"})
+		root.Finish()
+		stop()
+
+		bodies := collector.Bodies()
+		assert.Len(bodies, 1)
+		req := mustDecodeProto(t, bodies[0])
+		rss := req.all(1)
+		assert.Len(rss, 2, "one ResourceSpans per service")
+
+		spans := make(map[string]protoMessage)
+		for _, rs := range rss {
+			rs := mustDecodeProto(t, rs.bytes)
+			resource := mustDecodeProto(t, rs.get(1).bytes)
+			rattrs := resource.attributes(t, 1)
+			assert.Equal("testenv", rattrs["deployment.environment"])
+			assert.Equal("go", rattrs["telemetry.sdk.language"])
+			svc := rattrs["service.name"].(string)
+			if svc == "otlp-service" {
+				assert.Equal("1.2.3", rattrs["service.version"])
+			} else {
+				assert.NotContains(rattrs, "service.version")
+			}
+			ss := mustDecodeProto(t, rs.get(2).bytes)
+			scope := mustDecodeProto(t, ss.get(1).bytes)
+			assert.Equal("gopkg.in/DataDog/dd-trace-go.v1", string(scope.get(1).bytes))
+			for _, sp := range ss.all(2) {
+				spans[svc] = mustDecodeProto(t, sp.bytes)
+			}
+		}
+
+		rootpb, childpb := spans["otlp-service"], spans["db-service"]
+		assert.Equal(root.context.TraceID128Bytes(), func() (b [16]byte) { copy(b[:], rootpb.get(1).bytes); return }())
+		assert.Equal(rootpb.get(1).bytes, childpb.get(1).bytes)
+		assert.Equal(root.SpanID, binary.BigEndian.Uint64(rootpb.get(2).bytes))
+		assert.Nil(rootpb.get(4).bytes)
+		assert.Equal(root.SpanID, binary.BigEndian.Uint64(childpb.get(4).bytes))
+		assert.Equal("web.request", string(rootpb.get(5).bytes))
+		assert.EqualValues(otlpSpanKindServer, rootpb.get(6).value)
+		assert.EqualValues(root.Start, rootpb.get(7).value)
+		assert.EqualValues(root.Start+root.Duration, rootpb.get(8).value)
+
+		rattrs := rootpb.attributes(t, 9)
+		assert.Equal("GET /", rattrs["resource.name"])
+		assert.Equal("web", rattrs["span.type"])
+		assert.Equal("testenv", rattrs[ext.Environment])
+		assert.Equal(1., rattrs[keyTopLevel])
+
+		cattrs := childpb.attributes(t, 9)
+		assert.Equal(3., cattrs["rows"])
+		assert.Equal("broken", cattrs[ext.ErrorMsg])
+		status := mustDecodeProto(t, childpb.get(15).bytes)
+		assert.Equal("broken", string(status.get(2).bytes))
+		assert.EqualValues(otlpStatusCodeError, status.get(3).value)
+		assert.Len(rootpb.all(15), 0)
+
+		assert.Len(childpb.all(11), 0)
+		events := rootpb.all(11)
+		if assert.Len(events, 1) {
+			event := mustDecodeProto(t, events[0].bytes)
+			assert.EqualValues(eventTime.UnixNano(), event.get(1).value)
+			assert.Equal("cache.miss", string(event.get(2).bytes))
+			assert.Equal(map[string]interface{}{
+				"key":   "users",
+				"size":  int64(3),
+				"stale": true,
+			}, event.attributes(t, 3))
+		}
+
+		links := rootpb.all(13)
+		if assert.Len(links, 1) {
+			link := mustDecodeProto(t, links[0].bytes)
+			assert.Equal(linked.context.TraceID128Bytes(), func() (b [16]byte) { copy(b[:], link.get(1).bytes); return }())
+			assert.Equal(linked.SpanID, binary.BigEndian.Uint64(link.get(2).bytes))
+			assert.Equal(map[string]interface{}{"reason": "retry"}, link.attributes(t, 4))
+		}
+	})
+
+	t.Run("p0", func(t *testing.T) {
+		assert := assert.New(t)
+		collector := newOTLPCollector()
+		defer collector.Close()
+
+		var tg testStatsdClient
+		tracer, _, _, stop := startTestTracer(t,
+			WithOTLPExporter(collector.URL+"/v1/traces"),
+			WithSpanSamplingRules([]SamplingRule{SpanNameServiceRule("kept", "", 1)}),
+			withStatsdClient(&tg),
+		)
+		root := tracer.StartSpan("dropped", Tag(ext.SamplingPriority, ext.PriorityUserReject))
+		tracer.StartSpan("kept", ChildOf(root.Context())).Finish()
+		tracer.StartSpan("other", ChildOf(root.Context())).Finish()
+		root.Finish()
+		stop()
+
+		bodies := collector.Bodies()
+		if assert.Len(bodies, 1) {
+			req := mustDecodeProto(t, bodies[0])
+			rs := mustDecodeProto(t, req.get(1).bytes)
+			ss := mustDecodeProto(t, rs.get(2).bytes)
+			spans := ss.all(2)
+			if assert.Len(spans, 1) {
+				assert.Equal("kept", string(mustDecodeProto(t, spans[0].bytes).get(5).bytes))
+			}
+		}
+		counts := tg.Counts()
+		assert.EqualValues(1, counts["datadog.tracer.dropped_p0_traces"])
+		assert.EqualValues(2, counts["datadog.tracer.dropped_p0_spans"])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		collector := newOTLPCollector()
+		defer collector.Close()
+		collector.status = http.StatusServiceUnavailable
+
+		var tg testStatsdClient
+		c := newConfig(WithOTLPExporter(collector.URL+"/v1/traces"), withStatsdClient(&tg))
+		w := newOTLPTraceWriter(c)
+		w.add([]*span{makeSpan(0)})
+		w.stop()
+
+		assert.Len(t, collector.Bodies(), 1)
+		assert.Contains(t, tg.CallNames(), "datadog.tracer.traces_dropped")
+	})
+}
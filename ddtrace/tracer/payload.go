@@ -35,7 +35,7 @@ type payload struct {
 	// and the number of items contained in the stream.
 	header []byte
 
-	// off specifies the current read position on the header.
+	// off specifies the position in header at which the array header starts.
 	off int
 
 	// count specifies the number of items in the stream.
@@ -44,6 +44,15 @@ type payload struct {
 	// buf holds the sequence of msgpack-encoded items.
 	buf bytes.Buffer
 
+	// reader reads the contents of the stream, leaving them intact so that
+	// the payload can be read again after a rewind.
+	reader io.Reader
+
+	// strings holds the string table of a payload using the v0.5 format, in
+	// which spans reference strings by their index in the table. It is nil
+	// when using the v0.4 format.
+	strings *stringTable
+
 	// closed specifies the notification channel for each Close call.
 	closed chan struct{}
 }
@@ -60,9 +69,23 @@ func newPayload() *payload {
 	return p
 }
 
+// newPayloadV05 returns a ready to use payload encoding traces using the v0.5
+// format, understood by the agent's /v0.5/traces endpoint.
+func newPayloadV05() *payload {
+	p := newPayload()
+	p.strings = newStringTable()
+	return p
+}
+
 // push pushes a new item into the stream.
 func (p *payload) push(t spanList) error {
-	if err := msgp.Encode(&p.buf, t); err != nil {
+	var err error
+	if p.strings != nil {
+		err = msgp.Encode(&p.buf, spanListV05{trace: t, strings: p.strings})
+	} else {
+		err = msgp.Encode(&p.buf, t)
+	}
+	if err != nil {
 		return err
 	}
 	atomic.AddUint64(&p.count, 1)
@@ -75,10 +98,13 @@ func (p *payload) itemCount() int {
 	return int(atomic.LoadUint64(&p.count))
 }
 
-// size returns the payload size in bytes. After the first read the value becomes
-// inaccurate by up to 8 bytes.
+// size returns the payload size in bytes.
 func (p *payload) size() int {
-	return p.buf.Len() + len(p.header) - p.off
+	n := p.buf.Len() + len(p.header) - p.off
+	if p.strings != nil {
+		n += 1 + p.strings.msgsize()
+	}
+	return n
 }
 
 // reset resets the internal buffer, counter and read offset.
@@ -86,6 +112,10 @@ func (p *payload) reset() {
 	p.off = 8
 	atomic.StoreUint64(&p.count, 0)
 	p.buf.Reset()
+	p.reader = nil
+	if p.strings != nil {
+		p.strings = newStringTable()
+	}
 	select {
 	case <-p.closed:
 		// ensure there is room
@@ -135,11 +165,29 @@ func (p *payload) waitClose() { <-p.closed }
 
 // Read implements io.Reader. It reads from the msgpack-encoded stream.
 func (p *payload) Read(b []byte) (n int, err error) {
-	if p.off < len(p.header) {
-		// reading header
-		n = copy(b, p.header[p.off:])
-		p.off += n
-		return n, nil
+	if p.reader == nil {
+		var prefix []byte
+		if p.strings != nil {
+			// the v0.5 format is an array holding the string table,
+			// followed by the traces
+			prefix = p.strings.appendMsg([]byte{msgpackArrayFix + 2})
+		}
+		p.reader = io.MultiReader(
+			bytes.NewReader(prefix),
+			bytes.NewReader(p.header[p.off:]),
+			bytes.NewReader(p.buf.Bytes()),
+		)
+	}
+	return p.reader.Read(b)
+}
+
+// rewind moves the read position back to the beginning of the stream, so that
+// the payload can be read again, for example to retry a failed upload.
+func (p *payload) rewind() {
+	p.reader = nil
+	select {
+	case <-p.closed:
+		// discard the Close call of the previous read
+	default:
 	}
-	return p.buf.Read(b)
 }
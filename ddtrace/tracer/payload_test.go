@@ -57,6 +57,22 @@ func TestPayloadIntegrity(t *testing.T) {
 	}
 }
 
+// TestPayloadRewind tests that a payload can be read again after rewinding it.
+func TestPayloadRewind(t *testing.T) {
+	assert := assert.New(t)
+	p := newPayload()
+	for i := 0; i < 20; i++ {
+		p.push(newSpanList(i%5 + 1))
+	}
+	first, err := ioutil.ReadAll(p)
+	assert.NoError(err)
+	p.rewind()
+	second, err := ioutil.ReadAll(p)
+	assert.NoError(err)
+	assert.Equal(first, second)
+	assert.NotEmpty(first)
+}
+
 // TestPayloadDecode ensures that whatever we push into the payload can
 // be decoded by the codec.
 func TestPayloadDecode(t *testing.T) {
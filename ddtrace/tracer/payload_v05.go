@@ -0,0 +1,202 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import "github.com/tinylib/msgp/msgp"
+
+// This file implements the v0.5 trace encoding, used by the agent's /v0.5/traces
+// endpoint. Instead of repeating them in every span, strings are stored once in a
+// table shared by the whole payload and spans reference them by their index. The
+// payload is encoded as an array of two elements:
+//
+//	[
+//		[string, ...],                // the string table
+//		[[span, ...], ...],           // the traces
+//	]
+//
+// where each span is an array of 12 elements:
+//
+//	[
+//		service   uint32,             // string table index
+//		name      uint32,             // string table index
+//		resource  uint32,             // string table index
+//		trace_id  uint64,
+//		span_id   uint64,
+//		parent_id uint64,
+//		start     int64,
+//		duration  int64,
+//		error     int32,
+//		meta      map[uint32]uint32,  // string table indexes
+//		metrics   map[uint32]float64, // keys are string table indexes
+//		type      uint32,             // string table index
+//	]
+//
+// The first entry of the string table is always the empty string. Span events
+// and links, which have no field of their own, are sent as JSON in the "events"
+// and "_dd.span_links" meta entries.
+
+// stringTable holds the strings referenced by the spans of a v0.5 payload, in the
+// order in which they were first added.
+//
+// stringTable is not safe for concurrent use.
+type stringTable struct {
+	// index maps each string to its position in strings.
+	index map[string]uint32
+
+	// strings holds the table entries.
+	strings []string
+
+	// size holds the total encoded size of the entries in bytes.
+	size int
+}
+
+// newStringTable returns a new string table holding only the empty string.
+func newStringTable() *stringTable {
+	t := &stringTable{index: make(map[string]uint32)}
+	t.add("")
+	return t
+}
+
+// add returns the index of s in the table, adding it when not present.
+func (t *stringTable) add(s string) uint32 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	i := uint32(len(t.strings))
+	t.index[s] = i
+	t.strings = append(t.strings, s)
+	t.size += msgp.StringPrefixSize + len(s)
+	return i
+}
+
+// msgsize returns an upper bound of the size of the encoded table in bytes.
+func (t *stringTable) msgsize() int {
+	return msgp.ArrayHeaderSize + t.size
+}
+
+// appendMsg appends the msgpack encoding of the table to b.
+func (t *stringTable) appendMsg(b []byte) []byte {
+	b = msgp.AppendArrayHeader(b, uint32(len(t.strings)))
+	for _, s := range t.strings {
+		b = msgp.AppendString(b, s)
+	}
+	return b
+}
+
+// readStringTable decodes a string table from the beginning of b, returning the
+// remaining bytes.
+func readStringTable(b []byte) (*stringTable, []byte, error) {
+	n, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &stringTable{index: make(map[string]uint32, n)}
+	for i := uint32(0); i < n; i++ {
+		var s string
+		if s, b, err = msgp.ReadStringBytes(b); err != nil {
+			return nil, nil, err
+		}
+		t.add(s)
+	}
+	if len(t.strings) == 0 || t.strings[0] != "" {
+		return nil, nil, msgp.ErrShortBytes
+	}
+	return t, b, nil
+}
+
+// spanListV05 encodes a trace using the v0.5 format, adding the strings it
+// references to a string table.
+type spanListV05 struct {
+	trace   spanList
+	strings *stringTable
+}
+
+var _ msgp.Encodable = spanListV05{}
+
+// EncodeMsg implements msgp.Encodable.
+func (l spanListV05) EncodeMsg(w *msgp.Writer) error {
+	if err := w.WriteArrayHeader(uint32(len(l.trace))); err != nil {
+		return err
+	}
+	for _, s := range l.trace {
+		if err := encodeSpanV05(w, s, l.strings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSpanV05 writes the v0.5 encoding of s to w, adding the strings it
+// references to t.
+func encodeSpanV05(w *msgp.Writer, s *span, t *stringTable) error {
+	err := w.WriteArrayHeader(12)
+	if err != nil {
+		return err
+	}
+	for _, str := range []string{s.Service, s.Name, s.Resource} {
+		if err = w.WriteUint32(t.add(str)); err != nil {
+			return err
+		}
+	}
+	for _, id := range []uint64{s.TraceID, s.SpanID, s.ParentID} {
+		if err = w.WriteUint64(id); err != nil {
+			return err
+		}
+	}
+	if err = w.WriteInt64(s.Start); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(s.Duration); err != nil {
+		return err
+	}
+	if err = w.WriteInt32(s.Error); err != nil {
+		return err
+	}
+	// the v0.5 format has no fields for span events and links; they are
+	// sent as JSON in the meta instead
+	var extra [][2]string
+	if len(s.Events) > 0 {
+		if v := eventsJSON(s.Events); v != "" {
+			extra = append(extra, [2]string{"events", v})
+		}
+	}
+	if len(s.Links) > 0 {
+		if v := linksJSON(s.Links); v != "" {
+			extra = append(extra, [2]string{keySpanLinks, v})
+		}
+	}
+	if err = w.WriteMapHeader(uint32(len(s.Meta) + len(extra))); err != nil {
+		return err
+	}
+	for k, v := range s.Meta {
+		if err = w.WriteUint32(t.add(k)); err != nil {
+			return err
+		}
+		if err = w.WriteUint32(t.add(v)); err != nil {
+			return err
+		}
+	}
+	for _, kv := range extra {
+		if err = w.WriteUint32(t.add(kv[0])); err != nil {
+			return err
+		}
+		if err = w.WriteUint32(t.add(kv[1])); err != nil {
+			return err
+		}
+	}
+	if err = w.WriteMapHeader(uint32(len(s.Metrics))); err != nil {
+		return err
+	}
+	for k, v := range s.Metrics {
+		if err = w.WriteUint32(t.add(k)); err != nil {
+			return err
+		}
+		if err = w.WriteFloat64(v); err != nil {
+			return err
+		}
+	}
+	return w.WriteUint32(t.add(s.Type))
+}
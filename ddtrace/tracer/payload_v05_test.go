@@ -0,0 +1,248 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// decodeV05 decodes a payload encoded using the v0.5 format.
+func decodeV05(r io.Reader) (spanLists, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	n, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("payload has %d elements, expected 2", n)
+	}
+	table, b, err := readStringTable(b)
+	if err != nil {
+		return nil, err
+	}
+	str := func(b []byte) (string, []byte, error) {
+		i, b, err := msgp.ReadUint32Bytes(b)
+		if err != nil {
+			return "", nil, err
+		}
+		if int(i) >= len(table.strings) {
+			return "", nil, errors.New("string index out of range")
+		}
+		return table.strings[i], b, nil
+	}
+	ntraces, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	traces := make(spanLists, ntraces)
+	for i := range traces {
+		var nspans uint32
+		if nspans, b, err = msgp.ReadArrayHeaderBytes(b); err != nil {
+			return nil, err
+		}
+		for j := uint32(0); j < nspans; j++ {
+			var nfields uint32
+			if nfields, b, err = msgp.ReadArrayHeaderBytes(b); err != nil {
+				return nil, err
+			}
+			if nfields != 12 {
+				return nil, fmt.Errorf("span has %d fields, expected 12", nfields)
+			}
+			s := &span{}
+			for _, f := range []*string{&s.Service, &s.Name, &s.Resource} {
+				if *f, b, err = str(b); err != nil {
+					return nil, err
+				}
+			}
+			for _, f := range []*uint64{&s.TraceID, &s.SpanID, &s.ParentID} {
+				if *f, b, err = msgp.ReadUint64Bytes(b); err != nil {
+					return nil, err
+				}
+			}
+			for _, f := range []*int64{&s.Start, &s.Duration} {
+				if *f, b, err = msgp.ReadInt64Bytes(b); err != nil {
+					return nil, err
+				}
+			}
+			if s.Error, b, err = msgp.ReadInt32Bytes(b); err != nil {
+				return nil, err
+			}
+			var sz uint32
+			if sz, b, err = msgp.ReadMapHeaderBytes(b); err != nil {
+				return nil, err
+			}
+			s.Meta = make(map[string]string, sz)
+			for ; sz > 0; sz-- {
+				var k, v string
+				if k, b, err = str(b); err != nil {
+					return nil, err
+				}
+				if v, b, err = str(b); err != nil {
+					return nil, err
+				}
+				s.Meta[k] = v
+			}
+			if sz, b, err = msgp.ReadMapHeaderBytes(b); err != nil {
+				return nil, err
+			}
+			s.Metrics = make(map[string]float64, sz)
+			for ; sz > 0; sz-- {
+				var k string
+				var v float64
+				if k, b, err = str(b); err != nil {
+					return nil, err
+				}
+				if v, b, err = msgp.ReadFloat64Bytes(b); err != nil {
+					return nil, err
+				}
+				s.Metrics[k] = v
+			}
+			if s.Type, b, err = str(b); err != nil {
+				return nil, err
+			}
+			traces[i] = append(traces[i], s)
+		}
+	}
+	if len(b) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(b))
+	}
+	return traces, nil
+}
+
+// TestPayloadV05 tests that the traces pushed into a v0.5 payload can be decoded
+// back, and that repeated strings are only stored once.
+func TestPayloadV05(t *testing.T) {
+	for _, n := range []int{1, 16, 1 << 10} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			assert := assert.New(t)
+			p, v04 := newPayloadV05(), newPayload()
+			for i := 0; i < n; i++ {
+				trace := newSpanList(i%5 + 1)
+				trace[0].Error = 1
+				trace[0].Meta["index"] = strconv.Itoa(i % 3)
+				assert.NoError(p.push(trace))
+				assert.NoError(v04.push(trace))
+			}
+			assert.Equal(n, p.itemCount())
+			want, err := decode(v04)
+			assert.NoError(err)
+			size := p.size()
+
+			raw, err := ioutil.ReadAll(p)
+			assert.NoError(err)
+			assert.True(len(raw) <= size, "size %d is lower than the actual size %d", size, len(raw))
+
+			got, err := decodeV05(bytes.NewReader(raw))
+			assert.NoError(err)
+			if !assert.Equal(len(want), len(got)) {
+				return
+			}
+			for i := range want {
+				assert.Equal(want[i], got[i])
+			}
+
+			// the string table holds every distinct string exactly once
+			seen := make(map[string]bool)
+			for _, s := range p.strings.strings {
+				assert.False(seen[s], "duplicate string %q", s)
+				seen[s] = true
+			}
+			assert.Equal("", p.strings.strings[0])
+
+			// the payload can be read again
+			p.rewind()
+			again, err := ioutil.ReadAll(p)
+			assert.NoError(err)
+			assert.Equal(raw, again)
+		})
+	}
+
+	t.Run("reset", func(t *testing.T) {
+		assert := assert.New(t)
+		p := newPayloadV05()
+		p.push(newSpanList(3))
+		p.reset()
+		assert.Equal(0, p.itemCount())
+		assert.Equal([]string{""}, p.strings.strings)
+		p.push(newSpanList(1))
+		got, err := decodeV05(p)
+		assert.NoError(err)
+		assert.Len(got, 1)
+	})
+
+	t.Run("smaller", func(t *testing.T) {
+		v04, v05 := newPayload(), newPayloadV05()
+		for i := 0; i < 100; i++ {
+			trace := newSpanList(5)
+			v04.push(trace)
+			v05.push(trace)
+		}
+		b04, _ := ioutil.ReadAll(v04)
+		b05, _ := ioutil.ReadAll(v05)
+		assert.True(t, len(b05) < len(b04)/2, "v0.5: %d bytes, v0.4: %d bytes", len(b05), len(b04))
+	})
+}
+
+// benchmarkTrace returns a trace of n spans resembling those of a web service.
+func benchmarkTrace(n int) spanList {
+	trace := make(spanList, n)
+	for i := range trace {
+		s := newBasicSpan("http.request")
+		s.Service = "web-frontend"
+		s.Resource = "GET /api/v1/users/:id"
+		s.Type = "web"
+		s.Meta["http.method"] = "GET"
+		s.Meta["http.url"] = "/api/v1/users/" + strconv.Itoa(i)
+		s.Meta["http.status_code"] = "200"
+		s.Meta["env"] = "prod"
+		s.Meta["version"] = "1.2.3"
+		s.Metrics["_sampling_priority_v1"] = 1
+		s.Metrics["_dd.measured"] = 1
+		trace[i] = s
+	}
+	return trace
+}
+
+// BenchmarkPayloadEncoding compares the v0.4 and v0.5 encoders by pushing 100 traces
+// of various sizes into a payload.
+func BenchmarkPayloadEncoding(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		trace := benchmarkTrace(n)
+		for _, tt := range []struct {
+			name       string
+			newPayload func() *payload
+		}{
+			{"v0.4", newPayload},
+			{"v0.5", newPayloadV05},
+		} {
+			b.Run(fmt.Sprintf("%s/%d-spans", tt.name, n), func(b *testing.B) {
+				p := tt.newPayload()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.reset()
+					for j := 0; j < 100; j++ {
+						p.push(trace)
+					}
+				}
+				b.StopTimer()
+				b.Logf("payload size for 100 traces: %d bytes", p.size())
+			})
+		}
+	}
+}
@@ -158,7 +158,7 @@ func (ps *prioritySampler) apply(spn *span) {
 }
 
 // rulesSampler allows a user-defined list of rules to apply to spans.
-// These rules can match based on the span's Service, Name or both.
+// These rules can match based on the span's Service, Name, Resource and tags.
 // When making a sampling decision, the rules are checked in order until
 // a match is found.
 // If a match is found, the rate from that rule is used.
@@ -170,21 +170,104 @@ func (ps *prioritySampler) apply(spn *span) {
 // The rate is used to determine if the span should be sampled, but an upper
 // limit can be defined using the DD_TRACE_RATE_LIMIT environment variable.
 // Its value is the number of spans to sample per second.
+// Rules having their own MaxPerSecond are limited separately, so that a burst
+// of spans matching one rule doesn't use up the limit of the others.
 // Spans that matched the rules but exceeded the rate limit are not sampled.
+//
+// The decision is made when a trace starts, so that it can be propagated to
+// other services. Unless it was already propagated, the rules are matched again
+// against the root span once it finishes, so that the resource and tags set
+// after the trace started are taken into account.
+//
+// The rules, rate and limit may be replaced at runtime using update.
 type rulesSampler struct {
-	rules      []SamplingRule // the rules to match spans with
-	globalRate float64        // a rate to apply when no rules match a span
-	limiter    *rateLimiter   // used to limit the volume of spans sampled
+	mu           sync.RWMutex   // guards below fields
+	rules        []SamplingRule // the rules to match spans with
+	ruleLimiters []*rateLimiter // ruleLimiters[i] limits rules[i]; nil if it uses limiter
+	globalRate   float64        // a rate to apply when no rules match a span
+	limiter      *rateLimiter   // used to limit the volume of spans sampled
 }
 
 // newRulesSampler configures a *rulesSampler instance using the given set of rules.
 // Invalid rules or environment variable values are tolerated, by logging warnings and then ignoring them.
 func newRulesSampler(rules []SamplingRule) *rulesSampler {
 	return &rulesSampler{
-		rules:      rules,
-		globalRate: globalSampleRate(),
-		limiter:    newRateLimiter(),
+		rules:        rules,
+		ruleLimiters: newRuleLimiters(rules),
+		globalRate:   globalSampleRate(),
+		limiter:      newRateLimiter(),
+	}
+}
+
+// update atomically replaces the rules, the global rate and the rate limit
+// used by the sampler.
+func (rs *rulesSampler) update(rules []SamplingRule, globalRate, limit float64) {
+	limiter := newRateLimiterWithLimit(limit)
+	ruleLimiters := newRuleLimiters(rules)
+	rules = copySamplingRules(rules)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.rules = rules
+	rs.ruleLimiters = ruleLimiters
+	rs.globalRate = globalRate
+	rs.limiter = limiter
+}
+
+// config returns the rules, the global rate and the rate limit currently used by
+// the sampler. The returned rules are a copy, which may be modified freely.
+func (rs *rulesSampler) config() SamplingConfig {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	cfg := SamplingConfig{
+		Rules:      copySamplingRules(rs.rules),
+		SampleRate: rs.globalRate,
+	}
+	if rs.limiter != nil {
+		cfg.RateLimit = float64(rs.limiter.limiter.Limit())
 	}
+	return cfg
+}
+
+// copySamplingRules returns a deep copy of rules. The regular expressions, which
+// are safe for concurrent use, are shared.
+func copySamplingRules(rules []SamplingRule) []SamplingRule {
+	if rules == nil {
+		return nil
+	}
+	cp := make([]SamplingRule, len(rules))
+	for i, r := range rules {
+		if r.Tags != nil {
+			tags := make(map[string]*regexp.Regexp, len(r.Tags))
+			for k, v := range r.Tags {
+				tags[k] = v
+			}
+			r.Tags = tags
+		}
+		if r.globs != nil {
+			globs := *r.globs
+			if globs.Tags != nil {
+				globs.Tags = make(map[string]string, len(r.globs.Tags))
+				for k, v := range r.globs.Tags {
+					globs.Tags[k] = v
+				}
+			}
+			r.globs = &globs
+		}
+		cp[i] = r
+	}
+	return cp
+}
+
+// jsonSamplingRule is the JSON representation of a SamplingRule, as found in the
+// DD_TRACE_SAMPLING_RULES environment variable.
+type jsonSamplingRule struct {
+	Service  string            `json:"service"`
+	Name     string            `json:"name"`
+	Resource string            `json:"resource,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Rate     json.Number       `json:"sample_rate"`
+
+	MaxPerSecond float64 `json:"max_per_second,omitempty"`
 }
 
 // samplingRulesFromEnv parses sampling rules from the DD_TRACE_SAMPLING_RULES
@@ -194,15 +277,17 @@ func samplingRulesFromEnv() ([]SamplingRule, error) {
 	if rulesFromEnv == "" {
 		return nil, nil
 	}
-	jsonRules := []struct {
-		Service string      `json:"service"`
-		Name    string      `json:"name"`
-		Rate    json.Number `json:"sample_rate"`
-	}{}
+	jsonRules := []jsonSamplingRule{}
 	err := json.Unmarshal([]byte(rulesFromEnv), &jsonRules)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
 	}
+	return parseSamplingRules(jsonRules)
+}
+
+// parseSamplingRules converts the given JSON rules into sampling rules. Invalid
+// rules are skipped and reported in the returned error.
+func parseSamplingRules(jsonRules []jsonSamplingRule) ([]SamplingRule, error) {
 	rules := make([]SamplingRule, 0, len(jsonRules))
 	var errs []string
 	for i, v := range jsonRules {
@@ -219,14 +304,16 @@ func samplingRulesFromEnv() ([]SamplingRule, error) {
 			log.Warn("at index %d: ignoring rule %+v: rate is out of [0.0, 1.0] range", i, v)
 			continue
 		}
-		switch {
-		case v.Service != "" && v.Name != "":
-			rules = append(rules, NameServiceRule(v.Name, v.Service, rate))
-		case v.Service != "":
-			rules = append(rules, ServiceRule(v.Service, rate))
-		case v.Name != "":
-			rules = append(rules, NameRule(v.Name, rate))
+		if v.Service == "" && v.Name == "" && v.Resource == "" && len(v.Tags) == 0 {
+			continue
+		}
+		if v.MaxPerSecond < 0 {
+			log.Warn("at index %d: ignoring rule %+v: max_per_second is negative", i, v)
+			continue
 		}
+		rule := TagsResourceRule(v.Tags, v.Resource, v.Name, v.Service, rate)
+		rule.MaxPerSecond = v.MaxPerSecond
+		rules = append(rules, rule)
 	}
 	if len(errs) != 0 {
 		return rules, fmt.Errorf("found errors:\n\t%s", strings.Join(errs, "\n\t"))
@@ -273,6 +360,24 @@ func newRateLimiter() *rateLimiter {
 			limit = l
 		}
 	}
+	return newRateLimiterWithLimit(limit)
+}
+
+// newRuleLimiters returns the rate limiters of the given rules, holding nil for the
+// rules without a MaxPerSecond.
+func newRuleLimiters(rules []SamplingRule) []*rateLimiter {
+	limiters := make([]*rateLimiter, len(rules))
+	for i, r := range rules {
+		if r.MaxPerSecond > 0 {
+			limiters[i] = newRateLimiterWithLimit(r.MaxPerSecond)
+		}
+	}
+	return limiters
+}
+
+// newRateLimiterWithLimit returns a rate limiter which allows sampling at most limit
+// traces per second.
+func newRateLimiterWithLimit(limit float64) *rateLimiter {
 	return &rateLimiter{
 		limiter:  rate.NewLimiter(rate.Limit(limit), int(math.Ceil(limit))),
 		prevTime: time.Now(),
@@ -284,56 +389,123 @@ func newRateLimiter() *rateLimiter {
 // set using DD_TRACE_SAMPLE_RATE, then it returns false and the span is not
 // modified.
 func (rs *rulesSampler) apply(span *span) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
 	if len(rs.rules) == 0 && math.IsNaN(rs.globalRate) {
 		// short path when disabled
 		return false
 	}
 
-	var matched bool
-	rate := rs.globalRate
-	for _, rule := range rs.rules {
-		if rule.match(span) {
-			matched = true
-			rate = rule.Rate
-			break
-		}
-	}
-	if !matched && math.IsNaN(rate) {
+	rate, limiter, ok := rs.matchRate(span)
+	if !ok {
 		// no matching rule or global rate, so we want to fall back
 		// to priority sampling
 		return false
 	}
 
-	rs.applyRate(span, rate, time.Now())
+	rs.applyLimitedRate(span, rate, limiter, time.Now())
 	return true
 }
 
+// applyFinished matches the rules against the finished root span of a trace. If
+// the matching rate differs from the one applied when the trace started, the
+// sampling decision is made again using that rate. The rate limiter is only
+// consulted if it differs from the one consulted when the trace started.
+// Otherwise, or if nothing matches, the span is not modified. It must be called
+// with the span locked.
+func (rs *rulesSampler) applyFinished(span *span) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if len(rs.rules) == 0 {
+		// the decision made at start can't change
+		return
+	}
+	rate, limiter, ok := rs.matchRate(span)
+	if !ok {
+		return
+	}
+	if prev, ok := span.Metrics[keyRulesSamplerAppliedRate]; ok && prev == rate {
+		// same rate, same decision
+		return
+	}
+	rs.applyLimitedRate(span, rate, limiter, time.Now())
+}
+
+// matchRate returns the rate and the rate limiter of the first rule matching span,
+// or the global rate and limiter if none match. It returns false if there is no
+// matching rule nor global rate. It must be called with rs.mu held.
+func (rs *rulesSampler) matchRate(span *span) (float64, *rateLimiter, bool) {
+	for i, rule := range rs.rules {
+		if rule.match(span) {
+			if l := rs.ruleLimiters[i]; l != nil {
+				return rule.Rate, l, true
+			}
+			return rule.Rate, rs.limiter, true
+		}
+	}
+	return rs.globalRate, rs.limiter, !math.IsNaN(rs.globalRate)
+}
+
+// applyRate applies the given rate to span, subject to the global rate limit. It
+// must be called with rs.mu held, and with the span locked unless it is not yet shared.
 func (rs *rulesSampler) applyRate(span *span, rate float64, now time.Time) {
-	span.SetTag(keyRulesSamplerAppliedRate, rate)
+	rs.applyLimitedRate(span, rate, rs.limiter, now)
+}
+
+// applyLimitedRate applies the given rate to span, subject to the rate limit of
+// limiter, whose effective rate is reported on the span. It must be called under
+// the same conditions as applyRate.
+func (rs *rulesSampler) applyLimitedRate(span *span, rate float64, limiter *rateLimiter, now time.Time) {
+	span.setMetric(keyRulesSamplerAppliedRate, rate)
 	if !sampledByRate(span.TraceID, rate) {
-		span.SetTag(ext.SamplingPriority, ext.PriorityAutoReject)
+		span.setMetric(ext.SamplingPriority, ext.PriorityAutoReject)
 		return
 	}
 
-	sampled, rate := rs.limiter.allowOne(now)
+	if limiter == span.rulesLimiter {
+		// the limiter already decided whether to keep the trace when it started;
+		// its decision stands rather than being charged to it twice
+		return
+	}
+	span.rulesLimiter = limiter
+	sampled, rate := limiter.allowOne(now)
 	if sampled {
-		span.SetTag(ext.SamplingPriority, ext.PriorityAutoKeep)
+		span.setMetric(ext.SamplingPriority, ext.PriorityAutoKeep)
 	} else {
-		span.SetTag(ext.SamplingPriority, ext.PriorityAutoReject)
+		span.setMetric(ext.SamplingPriority, ext.PriorityAutoReject)
 	}
-	span.SetTag(keyRulesSamplerLimiterRate, rate)
+	span.setMetric(keyRulesSamplerLimiterRate, rate)
 }
 
 // SamplingRule is used for applying sampling rates to spans that match
-// the service name, operation name or both.
+// the service name, operation name, resource and tags.
 // For basic usage, consider using the helper functions ServiceRule, NameRule, etc.
 type SamplingRule struct {
-	Service *regexp.Regexp
-	Name    *regexp.Regexp
-	Rate    float64
-
-	exactService string
-	exactName    string
+	Service  *regexp.Regexp
+	Name     *regexp.Regexp
+	Resource *regexp.Regexp
+
+	// Tags maps tag names to the expression their value must match. Numeric
+	// tags are matched using their shortest decimal representation, such as
+	// "200" or "0.5".
+	Tags map[string]*regexp.Regexp
+
+	Rate float64
+
+	// MaxPerSecond limits the number of traces sampled per second by the rule,
+	// in place of the global rate limit, or the number of spans kept per second
+	// by a single-span sampling rule (see WithSpanSamplingRules). Zero means
+	// the global rate limit applies to trace rules, and no limit to single-span
+	// rules.
+	MaxPerSecond float64
+
+	exactService  string
+	exactName     string
+	exactResource string
+
+	// globs holds the patterns passed to TagsResourceRule, if the rule was
+	// created using it.
+	globs *jsonSamplingRule
 }
 
 // ServiceRule returns a SamplingRule that applies the provided sampling rate
@@ -364,6 +536,62 @@ func NameServiceRule(name string, service string, rate float64) SamplingRule {
 	}
 }
 
+// TagsResourceRule returns a SamplingRule that applies the provided sampling rate
+// to spans matching all of the tags, resource, operation name and service provided.
+// Each of them is a glob pattern, in which "*" matches any sequence of characters
+// and "?" matches any single character. Empty patterns, and tags which are not in
+// the map, match any value.
+func TagsResourceRule(tags map[string]string, resource, name, service string, rate float64) SamplingRule {
+	rule := SamplingRule{
+		Rate: rate,
+		globs: &jsonSamplingRule{
+			Service:  service,
+			Name:     name,
+			Resource: resource,
+			Tags:     tags,
+		},
+	}
+	rule.exactService, rule.Service = globMatcher(service)
+	rule.exactName, rule.Name = globMatcher(name)
+	rule.exactResource, rule.Resource = globMatcher(resource)
+	if len(tags) > 0 {
+		rule.Tags = make(map[string]*regexp.Regexp, len(tags))
+		for k, v := range tags {
+			rule.Tags[k] = globRegexp(v)
+		}
+	}
+	return rule
+}
+
+// globMatcher returns the exact string to match when pattern holds no wildcards,
+// and otherwise the regular expression equivalent to it.
+func globMatcher(pattern string) (string, *regexp.Regexp) {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern, nil
+	}
+	return "", globRegexp(pattern)
+}
+
+// globRegexp returns a regular expression matching the same strings as the glob
+// pattern, where "*" matches any sequence of characters and "?" matches any
+// single character.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
 // RateRule returns a SamplingRule that applies the provided sampling rate to all spans.
 func RateRule(rate float64) SamplingRule {
 	return SamplingRule{
@@ -383,16 +611,43 @@ func (sr *SamplingRule) match(s *span) bool {
 	} else if sr.exactName != "" && sr.exactName != s.Name {
 		return false
 	}
+	if sr.Resource != nil && !sr.Resource.MatchString(s.Resource) {
+		return false
+	} else if sr.exactResource != "" && sr.exactResource != s.Resource {
+		return false
+	}
+	for k, re := range sr.Tags {
+		v, ok := s.Meta[k]
+		if !ok {
+			m, ok := s.Metrics[k]
+			if !ok {
+				return false
+			}
+			v = strconv.FormatFloat(m, 'f', -1, 64)
+		}
+		if !re.MatchString(v) {
+			return false
+		}
+	}
 	return true
 }
 
 // MarshalJSON implements the json.Marshaler interface.
 func (sr *SamplingRule) MarshalJSON() ([]byte, error) {
 	s := struct {
-		Service string  `json:"service"`
-		Name    string  `json:"name"`
-		Rate    float64 `json:"sample_rate"`
+		Service  string            `json:"service"`
+		Name     string            `json:"name"`
+		Resource string            `json:"resource,omitempty"`
+		Tags     map[string]string `json:"tags,omitempty"`
+		Rate     float64           `json:"sample_rate"`
+		MPS      float64           `json:"max_per_second,omitempty"`
 	}{}
+	s.Rate = sr.Rate
+	s.MPS = sr.MaxPerSecond
+	if g := sr.globs; g != nil {
+		s.Service, s.Name, s.Resource, s.Tags = g.Service, g.Name, g.Resource, g.Tags
+		return json.Marshal(&s)
+	}
 	if sr.exactService != "" {
 		s.Service = sr.exactService
 	} else if sr.Service != nil {
@@ -403,7 +658,17 @@ func (sr *SamplingRule) MarshalJSON() ([]byte, error) {
 	} else if sr.Name != nil {
 		s.Name = fmt.Sprintf("%s", sr.Name)
 	}
-	s.Rate = sr.Rate
+	if sr.exactResource != "" {
+		s.Resource = sr.exactResource
+	} else if sr.Resource != nil {
+		s.Resource = fmt.Sprintf("%s", sr.Resource)
+	}
+	if len(sr.Tags) > 0 {
+		s.Tags = make(map[string]string, len(sr.Tags))
+		for k, re := range sr.Tags {
+			s.Tags[k] = fmt.Sprintf("%s", re)
+		}
+	}
 	return json.Marshal(&s)
 }
 
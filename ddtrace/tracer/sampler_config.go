@@ -0,0 +1,198 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// SamplingConfig holds the user-defined sampling settings of a tracer, which may be
+// changed at runtime using UpdateSamplingConfig.
+type SamplingConfig struct {
+	// Rules specifies the sampling rules, matched in order against the
+	// root span of each trace. See WithSamplingRules.
+	Rules []SamplingRule
+
+	// SampleRate specifies the rate applied to traces matching no rule. A NaN
+	// value leaves the decision to the rates provided by the agent. It is
+	// initially set from DD_TRACE_SAMPLE_RATE.
+	SampleRate float64
+
+	// RateLimit specifies the maximum number of traces per second sampled by
+	// SampleRate and by the Rules which have no MaxPerSecond. It is initially
+	// set from DD_TRACE_RATE_LIMIT, and defaults to 100.
+	RateLimit float64
+}
+
+// validate returns an error if any of the rates in cfg is out of range.
+func (cfg *SamplingConfig) validate() error {
+	for i, r := range cfg.Rules {
+		if !(r.Rate >= 0.0 && r.Rate <= 1.0) {
+			return fmt.Errorf("rule at index %d: rate %f is out of [0.0, 1.0] range", i, r.Rate)
+		}
+		if !(r.MaxPerSecond >= 0.0) {
+			return fmt.Errorf("rule at index %d: max per second %f is negative", i, r.MaxPerSecond)
+		}
+	}
+	if !math.IsNaN(cfg.SampleRate) && !(cfg.SampleRate >= 0.0 && cfg.SampleRate <= 1.0) {
+		return fmt.Errorf("sample rate %f is out of [0.0, 1.0] range", cfg.SampleRate)
+	}
+	if !(cfg.RateLimit >= 0.0) {
+		return fmt.Errorf("rate limit %f is negative", cfg.RateLimit)
+	}
+	return nil
+}
+
+// errTracerNotStarted is returned when changing the settings of a tracer which is
+// not running.
+var errTracerNotStarted = errors.New("tracer not started")
+
+// CurrentSamplingConfig returns a copy of the sampling settings of the running
+// tracer. Modifying it has no effect until it is passed to UpdateSamplingConfig.
+// It returns false if the tracer is not started.
+func CurrentSamplingConfig() (SamplingConfig, bool) {
+	t, ok := internal.GetGlobalTracer().(*tracer)
+	if !ok {
+		return SamplingConfig{}, false
+	}
+	return t.rulesSampling.config(), true
+}
+
+// UpdateSamplingConfig atomically replaces the sampling rules, the sample rate and
+// the rate limit of the running tracer with the values in cfg, without restarting
+// it. Traces started after the call are sampled using the new settings. To change
+// only some of the settings, modify the copy returned by CurrentSamplingConfig and
+// pass it to UpdateSamplingConfig. The tracer keeps its own copy of cfg.
+// An error is returned if the tracer is not started or if any of the values is out
+// of range, in which case the settings are left unchanged.
+func UpdateSamplingConfig(cfg SamplingConfig) error {
+	t, ok := internal.GetGlobalTracer().(*tracer)
+	if !ok {
+		return errTracerNotStarted
+	}
+	return t.updateSamplingConfig(cfg, "api")
+}
+
+// updateSamplingConfig applies cfg to the rules sampler. The source of the change
+// is reported in logs and metrics.
+func (t *tracer) updateSamplingConfig(cfg SamplingConfig, source string) error {
+	if err := cfg.validate(); err != nil {
+		t.config.statsd.Incr("datadog.tracer.sampling_config.rejected", []string{"source:" + source}, 1)
+		return err
+	}
+	t.rulesSampling.update(cfg.Rules, cfg.SampleRate, cfg.RateLimit)
+	rules, err := json.Marshal(cfg.Rules)
+	if err != nil {
+		rules = []byte(fmt.Sprintf("%d rules", len(cfg.Rules)))
+	}
+	log.Info("Sampling configuration updated (source: %s): rules: %s, sample rate: %f, rate limit: %f",
+		source, rules, cfg.SampleRate, cfg.RateLimit)
+	t.config.statsd.Incr("datadog.tracer.sampling_config.updated", []string{"source:" + source}, 1)
+	return nil
+}
+
+// samplingConfigPollInterval specifies how often the sampling configuration file
+// is checked for changes; replaced in tests.
+var samplingConfigPollInterval = 10 * time.Second
+
+// readSamplingConfigFile parses the sampling configuration file at path. The file
+// holds a JSON object such as:
+//
+//	{
+//		"sample_rate": 0.5,
+//		"rate_limit": 50,
+//		"rules": [{"service": "web", "name": "http.request", "sample_rate": 1.0}]
+//	}
+//
+// Rules use the same format as DD_TRACE_SAMPLING_RULES. A missing sample rate leaves
+// the decision to the agent and a missing rate limit defaults to 100.
+func readSamplingConfigFile(path string) (SamplingConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return SamplingConfig{}, err
+	}
+	var file struct {
+		Rules      []jsonSamplingRule `json:"rules"`
+		SampleRate *float64           `json:"sample_rate"`
+		RateLimit  *float64           `json:"rate_limit"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return SamplingConfig{}, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+	cfg := SamplingConfig{
+		SampleRate: math.NaN(),
+		RateLimit:  defaultRateLimit,
+	}
+	if file.SampleRate != nil {
+		cfg.SampleRate = *file.SampleRate
+	}
+	if file.RateLimit != nil {
+		cfg.RateLimit = *file.RateLimit
+	}
+	if cfg.Rules, err = parseSamplingRules(file.Rules); err != nil {
+		return SamplingConfig{}, err
+	}
+	if len(cfg.Rules) != len(file.Rules) {
+		return SamplingConfig{}, errors.New("some rules are invalid")
+	}
+	return cfg, nil
+}
+
+// samplingConfigWatcher applies the sampling configuration file to a tracer each
+// time it changes.
+type samplingConfigWatcher struct {
+	tracer  *tracer
+	path    string
+	modTime time.Time // modification time of the last applied file
+	size    int64     // size of the last applied file
+}
+
+// check applies the configuration file if it changed since the last call.
+func (w *samplingConfigWatcher) check() {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		if !w.modTime.IsZero() {
+			log.Warn("Sampling configuration file %s: %v", w.path, err)
+			w.modTime, w.size = time.Time{}, 0
+		}
+		return
+	}
+	if fi.ModTime().Equal(w.modTime) && fi.Size() == w.size {
+		return
+	}
+	w.modTime, w.size = fi.ModTime(), fi.Size()
+	cfg, err := readSamplingConfigFile(w.path)
+	if err == nil {
+		err = w.tracer.updateSamplingConfig(cfg, "file")
+	}
+	if err != nil {
+		log.Error("Ignoring sampling configuration file %s: %v", w.path, err)
+	}
+}
+
+// watchSamplingConfig checks the sampling configuration file for changes until
+// the tracer is stopped.
+func (t *tracer) watchSamplingConfig(w *samplingConfigWatcher) {
+	tick := time.NewTicker(samplingConfigPollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			w.check()
+		case <-t.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// keySpanSamplingMechanism is set on the spans kept by a single-span
+	// sampling rule, with the value samplingMechanismSingleSpan.
+	keySpanSamplingMechanism = "_dd.span_sampling.mechanism"
+	// keySpanSamplingRuleRate holds the rate of the single-span sampling rule
+	// which kept the span.
+	keySpanSamplingRuleRate = "_dd.span_sampling.rule_rate"
+	// keySpanSamplingMPS holds the limit of the single-span sampling rule which
+	// kept the span, if it has one.
+	keySpanSamplingMPS = "_dd.span_sampling.max_per_second"
+)
+
+// samplingMechanismSingleSpan identifies the spans kept by single-span sampling rules.
+const samplingMechanismSingleSpan = 8
+
+// singleSpanSampler applies single-span sampling rules to the spans of traces
+// which are not sampled. The spans matching a rule are kept, so that critical
+// operations remain visible regardless of the trace sampling rate.
+type singleSpanSampler struct {
+	rules    []SamplingRule
+	limiters []*rateLimiter // limiters[i] limits rules[i]; nil if unlimited
+}
+
+// newSingleSpanSampler returns a sampler using the given single-span sampling rules.
+func newSingleSpanSampler(rules []SamplingRule) *singleSpanSampler {
+	return &singleSpanSampler{
+		rules:    rules,
+		limiters: newRuleLimiters(rules),
+	}
+}
+
+// enabled reports whether there are any single-span sampling rules.
+func (ss *singleSpanSampler) enabled() bool {
+	return len(ss.rules) > 0
+}
+
+// apply matches the rules against s, which belongs to a trace that is not sampled.
+// If the first matching rule samples the span, the span is marked as such and apply
+// returns true. It must be called with the span locked.
+func (ss *singleSpanSampler) apply(s *span) bool {
+	for i, rule := range ss.rules {
+		if !rule.match(s) {
+			continue
+		}
+		if !sampledByRate(s.SpanID, rule.Rate) {
+			return false
+		}
+		if l := ss.limiters[i]; l != nil {
+			if ok, _ := l.allowOne(time.Now()); !ok {
+				return false
+			}
+		}
+		s.setMetric(keySpanSamplingMechanism, samplingMechanismSingleSpan)
+		s.setMetric(keySpanSamplingRuleRate, rule.Rate)
+		if rule.MaxPerSecond > 0 {
+			s.setMetric(keySpanSamplingMPS, rule.MaxPerSecond)
+		}
+		return true
+	}
+	return false
+}
+
+// SpanNameServiceRule returns a single-span sampling rule keeping the given
+// proportion of the spans matching the operation name and service glob patterns,
+// as in TagsResourceRule. See WithSpanSamplingRules.
+func SpanNameServiceRule(name, service string, rate float64) SamplingRule {
+	return TagsResourceRule(nil, "", name, service, rate)
+}
+
+// SpanNameServiceMPSRule is like SpanNameServiceRule, but keeps at most limit
+// matching spans per second.
+func SpanNameServiceMPSRule(name, service string, rate, limit float64) SamplingRule {
+	rule := SpanNameServiceRule(name, service, rate)
+	rule.MaxPerSecond = limit
+	return rule
+}
+
+// spanSamplingRulesFromEnv parses single-span sampling rules from the
+// DD_SPAN_SAMPLING_RULES environment variable. It uses the format of
+// DD_TRACE_SAMPLING_RULES, with an optional "max_per_second" field, and
+// "sample_rate" defaulting to 1.
+func spanSamplingRulesFromEnv() ([]SamplingRule, error) {
+	rulesFromEnv := os.Getenv("DD_SPAN_SAMPLING_RULES")
+	if rulesFromEnv == "" {
+		return nil, nil
+	}
+	jsonRules := []jsonSamplingRule{}
+	err := json.Unmarshal([]byte(rulesFromEnv), &jsonRules)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+	for i := range jsonRules {
+		if jsonRules[i].Rate == "" {
+			jsonRules[i].Rate = "1"
+		}
+	}
+	return parseSamplingRules(jsonRules)
+}
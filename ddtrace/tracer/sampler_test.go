@@ -253,6 +253,16 @@ func TestRuleEnvVars(t *testing.T) {
 				// invalid rule ignored
 				value: `[{"service": "abcd", "sample_rate": 42.0}, {"service": "abcd", "sample_rate": 0.2}]`,
 				ruleN: 1,
+			}, {
+				value: `[{"resource": "GET /health*", "sample_rate": 0.1},{"tags": {"http.status_code": "5??"}, "sample_rate": 1.0}]`,
+				ruleN: 2,
+			}, {
+				value: `[{"service": "abcd", "sample_rate": 1.0, "max_per_second": 10},{"service": "abcd", "sample_rate": 1.0, "max_per_second": -1}]`,
+				ruleN: 1,
+			}, {
+				// rules matching anything are ignored
+				value: `[{"sample_rate": 0.5}]`,
+				ruleN: 0,
 			}, {
 				value:  `not JSON at all`,
 				errStr: `error unmarshalling JSON: invalid character 'o' in literal null (expecting 'u')`,
@@ -329,6 +339,38 @@ func TestRulesSampler(t *testing.T) {
 		}
 	})
 
+	t.Run("tags-resource", func(t *testing.T) {
+		makeTaggedSpan := func() *span {
+			s := newSpan("http.request", "test-service", "POST /checkout", 0, 0, 0)
+			s.SetTag("customer.tier", "premium")
+			s.SetTag(ext.HTTPCode, 503)
+			return s
+		}
+		for _, tt := range []struct {
+			rule    SamplingRule
+			matches bool
+		}{
+			{TagsResourceRule(nil, "POST /checkout", "", "", 1.0), true},
+			{TagsResourceRule(nil, "POST /*", "http.*", "test-?ervice", 1.0), true},
+			{TagsResourceRule(map[string]string{"customer.tier": "prem*"}, "", "", "", 1.0), true},
+			{TagsResourceRule(map[string]string{"http.status_code": "5??"}, "*", "", "", 1.0), true},
+			{TagsResourceRule(map[string]string{"http.status_code": "503", "customer.tier": "premium"}, "", "", "", 1.0), true},
+			{SamplingRule{Resource: regexp.MustCompile("^POST "), Tags: map[string]*regexp.Regexp{"customer.tier": regexp.MustCompile("^p")}, Rate: 1.0}, true},
+			{TagsResourceRule(nil, "GET /checkout", "", "", 1.0), false},
+			{TagsResourceRule(nil, "POST /checkout?", "", "", 1.0), false},
+			{TagsResourceRule(nil, "post /*", "", "", 1.0), false},
+			{TagsResourceRule(map[string]string{"customer.tier": "free"}, "", "", "", 1.0), false},
+			{TagsResourceRule(map[string]string{"http.status_code": "4??"}, "", "", "", 1.0), false},
+			{TagsResourceRule(map[string]string{"missing": "*"}, "", "", "", 1.0), false},
+			{TagsResourceRule(nil, "POST /checkout", "", "other-*", 1.0), false},
+		} {
+			t.Run("", func(t *testing.T) {
+				rs := newRulesSampler([]SamplingRule{tt.rule})
+				assert.Equal(t, tt.matches, rs.apply(makeTaggedSpan()))
+			})
+		}
+	})
+
 	t.Run("default-rate", func(t *testing.T) {
 		ruleSets := [][]SamplingRule{
 			{},
@@ -360,6 +402,234 @@ func TestRulesSampler(t *testing.T) {
 	})
 }
 
+func TestRulesSamplerFinish(t *testing.T) {
+	rules := []SamplingRule{
+		TagsResourceRule(map[string]string{"customer.tier": "free"}, "", "", "", 0.0),
+		TagsResourceRule(nil, "GET /health", "", "", 0.0),
+		ServiceRule("test-service", 1.0),
+	}
+
+	t.Run("late-tags", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		root := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		child.Finish()
+		root.SetTag("customer.tier", "free")
+		root.Finish()
+		assert.EqualValues(ext.PriorityAutoReject, root.Metrics[keySamplingPriority])
+		assert.Equal(0.0, root.Metrics[keyRulesSamplerAppliedRate])
+		p, _ := child.context.samplingPriority()
+		assert.Equal(ext.PriorityAutoReject, p)
+	})
+
+	t.Run("late-resource", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		root := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+		root.SetTag(ext.ResourceName, "GET /health")
+		root.Finish()
+		assert.EqualValues(ext.PriorityAutoReject, root.Metrics[keySamplingPriority])
+	})
+
+	t.Run("limiter", func(t *testing.T) {
+		assert := assert.New(t)
+		rules := []SamplingRule{
+			TagsResourceRule(map[string]string{"customer.tier": "premium"}, "", "", "", 0.5),
+			ServiceRule("test-service", 1.0),
+		}
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		id := uint64(1)
+		for !sampledByRate(id, 0.5) {
+			id++
+		}
+		root := tracer.StartSpan("http.request", ServiceName("test-service"), WithSpanID(id)).(*span)
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+		root.SetTag("customer.tier", "premium")
+		root.Finish()
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+		assert.Equal(0.5, root.Metrics[keyRulesSamplerAppliedRate])
+		assert.Equal(1., tracer.rulesSampling.limiter.seen, "the trace should be charged to the limiter once")
+	})
+
+	t.Run("propagated", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		root := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		assert.NoError(tracer.Inject(root.Context(), TextMapCarrier(map[string]string{})))
+		root.SetTag("customer.tier", "free")
+		root.Finish()
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+	})
+
+	t.Run("manual", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		root := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		root.SetTag(ext.ManualKeep, true)
+		root.SetTag("customer.tier", "free")
+		root.Finish()
+		assert.EqualValues(ext.PriorityUserKeep, root.Metrics[keySamplingPriority])
+	})
+
+	t.Run("non-root", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithSamplingRules(rules))
+		defer stop()
+
+		root := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		child.SetTag("customer.tier", "free")
+		child.Finish()
+		root.Finish()
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[keySamplingPriority])
+	})
+}
+
+func TestSingleSpanSampler(t *testing.T) {
+	makeSpan := func(op, svc string) *span {
+		return newSpan(op, svc, "", random.Uint64(), 0, 0)
+	}
+
+	t.Run("matching", func(t *testing.T) {
+		assert := assert.New(t)
+		ss := newSingleSpanSampler([]SamplingRule{
+			SpanNameServiceRule("http.*", "", 0.0),
+			SpanNameServiceMPSRule("sql.*", "db-?", 1.0, 10),
+		})
+		s := makeSpan("sql.query", "db-1")
+		assert.True(ss.apply(s))
+		assert.Equal(float64(samplingMechanismSingleSpan), s.Metrics[keySpanSamplingMechanism])
+		assert.Equal(1.0, s.Metrics[keySpanSamplingRuleRate])
+		assert.Equal(10.0, s.Metrics[keySpanSamplingMPS])
+
+		s = makeSpan("http.request", "db-1")
+		assert.False(ss.apply(s))
+		_, ok := s.Metrics[keySpanSamplingMechanism]
+		assert.False(ok)
+
+		assert.False(ss.apply(makeSpan("sql.query", "db-12")))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		assert := assert.New(t)
+		ss := newSingleSpanSampler([]SamplingRule{SpanNameServiceMPSRule("*", "", 1.0, 2)})
+		var kept int
+		for i := 0; i < 10; i++ {
+			if ss.apply(makeSpan("sql.query", "db")) {
+				kept++
+			}
+		}
+		assert.Equal(2, kept)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv("DD_SPAN_SAMPLING_RULES", `[{"service": "db", "name": "sql.*", "max_per_second": 50}, {"name": "kafka.consume", "sample_rate": 0.5}, {"name": "x", "max_per_second": -1}]`)
+		defer os.Unsetenv("DD_SPAN_SAMPLING_RULES")
+		rules, err := spanSamplingRulesFromEnv()
+		assert.NoError(err)
+		if assert.Len(rules, 2) {
+			assert.Equal(1.0, rules[0].Rate)
+			assert.Equal(50.0, rules[0].MaxPerSecond)
+			assert.Equal(0.5, rules[1].Rate)
+			assert.Equal(0.0, rules[1].MaxPerSecond)
+		}
+	})
+
+	t.Run("drop-p0s", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t,
+			WithSamplingRules([]SamplingRule{RateRule(0)}),
+			WithSpanSamplingRules([]SamplingRule{SpanNameServiceRule("sql.query", "", 1.0)}),
+		)
+		defer stop()
+		tracer.features.Store(agentFeatures{DropP0s: true})
+
+		root := tracer.StartSpan("http.request")
+		tracer.StartSpan("sql.query", ChildOf(root.Context())).Finish()
+		tracer.StartSpan("cache.get", ChildOf(root.Context())).Finish()
+		root.Finish()
+		flush(1)
+		traces := transport.Traces()
+		if assert.Len(traces, 1) && assert.Len(traces[0], 1) {
+			assert.Equal("sql.query", traces[0][0].Name)
+			assert.Equal(float64(samplingMechanismSingleSpan), traces[0][0].Metrics[keySpanSamplingMechanism])
+		}
+		assert.EqualValues(2, tracer.droppedP0Spans)
+		assert.EqualValues(1, tracer.droppedP0Traces)
+	})
+
+	t.Run("agent-drops", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t,
+			WithSamplingRules([]SamplingRule{RateRule(0)}),
+			WithSpanSamplingRules([]SamplingRule{SpanNameServiceRule("sql.query", "", 1.0)}),
+		)
+		defer stop()
+
+		root := tracer.StartSpan("http.request")
+		tracer.StartSpan("sql.query", ChildOf(root.Context())).Finish()
+		root.Finish()
+		flush(1)
+		traces := transport.Traces()
+		if assert.Len(traces, 1) && assert.Len(traces[0], 2) {
+			for _, s := range traces[0] {
+				_, ok := s.Metrics[keySpanSamplingMechanism]
+				assert.Equal(s.Name == "sql.query", ok)
+			}
+		}
+	})
+
+	t.Run("sampled-trace", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t,
+			WithSamplingRules([]SamplingRule{RateRule(1)}),
+			WithSpanSamplingRules([]SamplingRule{SpanNameServiceRule("sql.query", "", 1.0)}),
+		)
+		defer stop()
+
+		root := tracer.StartSpan("http.request")
+		tracer.StartSpan("sql.query", ChildOf(root.Context())).Finish()
+		root.Finish()
+		flush(1)
+		traces := transport.Traces()
+		if assert.Len(traces, 1) && assert.Len(traces[0], 2) {
+			for _, s := range traces[0] {
+				_, ok := s.Metrics[keySpanSamplingMechanism]
+				assert.False(ok)
+			}
+		}
+	})
+}
+
+func TestSamplingRuleMarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		rule SamplingRule
+		json string
+	}{
+		{ServiceRule("web", 0.5), `{"service":"web","name":"","sample_rate":0.5}`},
+		{TagsResourceRule(map[string]string{"http.status_code": "5??"}, "POST /*", "http.request", "web-*", 1), `{"service":"web-*","name":"http.request","resource":"POST /*","tags":{"http.status_code":"5??"},"sample_rate":1}`},
+		{SamplingRule{Resource: regexp.MustCompile("^GET "), Tags: map[string]*regexp.Regexp{"tier": regexp.MustCompile("free")}, Rate: 0.1}, `{"service":"","name":"","resource":"^GET ","tags":{"tier":"free"},"sample_rate":0.1}`},
+	} {
+		b, err := tt.rule.MarshalJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.json, string(b))
+	}
+}
+
 func TestRulesSamplerConcurrency(t *testing.T) {
 	rules := []SamplingRule{
 		ServiceRule("test-service", 1.0),
@@ -434,6 +704,188 @@ func TestRulesSamplerInternals(t *testing.T) {
 		assert.Equal(1.0, span.Metrics["_dd.rule_psr"])
 		assert.Equal(0.75, span.Metrics["_dd.limit_psr"])
 	})
+
+	t.Run("rule-limit", func(t *testing.T) {
+		assert := assert.New(t)
+		noisy := NameRule("noisy.request", 1.0)
+		noisy.MaxPerSecond = 2
+		rs := newRulesSampler([]SamplingRule{noisy, NameRule("rare.request", 1.0)})
+		rs.limiter.limiter = rate.NewLimiter(rate.Limit(3.0), 3)
+
+		var kept int
+		for i := 0; i < 10; i++ {
+			span := newSpan("noisy.request", "test-service", "", random.Uint64(), 0, 0)
+			assert.True(rs.apply(span))
+			if span.Metrics[keySamplingPriority] == ext.PriorityAutoKeep {
+				kept++
+			}
+			if i == 9 {
+				// reported by the limiter of the rule
+				assert.Equal(0.2, span.Metrics[keyRulesSamplerLimiterRate])
+			}
+		}
+		assert.Equal(2, kept)
+
+		// the global limit still applies to other rules, untouched by the noisy one
+		kept = 0
+		for i := 0; i < 5; i++ {
+			span := newSpan("rare.request", "test-service", "", random.Uint64(), 0, 0)
+			assert.True(rs.apply(span))
+			if span.Metrics[keySamplingPriority] == ext.PriorityAutoKeep {
+				kept++
+			}
+		}
+		assert.Equal(3, kept)
+	})
+}
+
+// samplingConfigUpdateTags returns the tags of the sampling configuration updates
+// reported to tg.
+func samplingConfigUpdateTags(tg *testStatsdClient) []string {
+	var tags []string
+	for _, c := range tg.IncrCalls() {
+		if c.name == "datadog.tracer.sampling_config.updated" {
+			tags = append(tags, c.tags...)
+		}
+	}
+	return tags
+}
+
+func TestUpdateSamplingConfig(t *testing.T) {
+	t.Run("not-started", func(t *testing.T) {
+		_, ok := CurrentSamplingConfig()
+		assert.False(t, ok)
+		assert.Equal(t, errTracerNotStarted, UpdateSamplingConfig(SamplingConfig{}))
+	})
+
+	t.Run("api", func(t *testing.T) {
+		assert := assert.New(t)
+		var tg testStatsdClient
+		tracer, _, _, stop := startTestTracer(t, withStatsdClient(&tg))
+		defer stop()
+
+		cfg, ok := CurrentSamplingConfig()
+		assert.True(ok)
+		assert.Empty(cfg.Rules)
+		assert.True(math.IsNaN(cfg.SampleRate))
+		assert.Equal(defaultRateLimit, cfg.RateLimit)
+
+		sp := tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		_, ok = sp.Metrics[keyRulesSamplerAppliedRate]
+		assert.False(ok)
+
+		cfg.Rules = []SamplingRule{ServiceRule("test-service", 0.0)}
+		cfg.RateLimit = 10
+		assert.NoError(UpdateSamplingConfig(cfg))
+		sp = tracer.StartSpan("http.request", ServiceName("test-service")).(*span)
+		assert.Equal(0.0, sp.Metrics[keyRulesSamplerAppliedRate])
+		assert.EqualValues(ext.PriorityAutoReject, sp.Metrics[keySamplingPriority])
+		sp = tracer.StartSpan("http.request", ServiceName("other-service")).(*span)
+		_, ok = sp.Metrics[keyRulesSamplerAppliedRate]
+		assert.False(ok)
+
+		cfg.SampleRate = 1.0
+		assert.NoError(UpdateSamplingConfig(cfg))
+		sp = tracer.StartSpan("http.request", ServiceName("other-service")).(*span)
+		assert.Equal(1.0, sp.Metrics[keyRulesSamplerAppliedRate])
+		assert.EqualValues(ext.PriorityAutoKeep, sp.Metrics[keySamplingPriority])
+
+		got, _ := CurrentSamplingConfig()
+		assert.Equal(cfg.Rules, got.Rules)
+		assert.Equal(1.0, got.SampleRate)
+		assert.Equal(10.0, got.RateLimit)
+		assert.Equal(int64(2), tg.Counts()["datadog.tracer.sampling_config.updated"])
+		assert.Contains(samplingConfigUpdateTags(&tg), "source:api")
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		assert := assert.New(t)
+		_, _, _, stop := startTestTracer(t)
+		defer stop()
+
+		rule := SamplingRule{Tags: map[string]*regexp.Regexp{"env": regexp.MustCompile("^prod$")}, Rate: 0.5}
+		cfg, _ := CurrentSamplingConfig()
+		cfg.Rules = []SamplingRule{rule}
+		assert.NoError(UpdateSamplingConfig(cfg))
+		// modifying the settings passed to, or returned by, the tracer does
+		// not affect the sampler
+		cfg.Rules[0].Rate = 1.0
+		got, _ := CurrentSamplingConfig()
+		got.Rules[0].Rate = 0.0
+		got.Rules[0].Tags["host"] = regexp.MustCompile("")
+		got, _ = CurrentSamplingConfig()
+		assert.Equal(0.5, got.Rules[0].Rate)
+		assert.Len(got.Rules[0].Tags, 1)
+		assert.Len(rule.Tags, 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var tg testStatsdClient
+		_, _, _, stop := startTestTracer(t, withStatsdClient(&tg))
+		defer stop()
+		for _, cfg := range []SamplingConfig{
+			{Rules: []SamplingRule{ServiceRule("svc", 1.5)}, SampleRate: math.NaN()},
+			{Rules: []SamplingRule{{Rate: 1.0, MaxPerSecond: -1}}, SampleRate: math.NaN()},
+			{SampleRate: -1},
+			{SampleRate: math.NaN(), RateLimit: -1},
+			{SampleRate: math.NaN(), RateLimit: math.NaN()},
+		} {
+			assert.Error(t, UpdateSamplingConfig(cfg))
+		}
+		cfg, _ := CurrentSamplingConfig()
+		assert.True(t, math.IsNaN(cfg.SampleRate))
+		assert.Equal(t, defaultRateLimit, cfg.RateLimit)
+		assert.Equal(t, int64(5), tg.Counts()["datadog.tracer.sampling_config.rejected"])
+	})
+}
+
+func TestSamplingConfigFile(t *testing.T) {
+	defer func(d time.Duration) { samplingConfigPollInterval = d }(samplingConfigPollInterval)
+	samplingConfigPollInterval = 5 * time.Millisecond
+
+	assert := assert.New(t)
+	f, err := ioutil.TempFile("", "sampling")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	write := func(content string, mtime time.Time) {
+		assert.NoError(ioutil.WriteFile(f.Name(), []byte(content), 0600))
+		assert.NoError(os.Chtimes(f.Name(), mtime, mtime))
+	}
+	waitFor := func(cond func(SamplingConfig) bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if cfg, _ := CurrentSamplingConfig(); cond(cfg) {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("timed out waiting for the sampling configuration to change")
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"sample_rate": 0.5, "rules": [{"service": "web", "sample_rate": 1.0}]}`, start)
+
+	var tg testStatsdClient
+	_, _, _, stop := startTestTracer(t, WithSamplingConfigFile(f.Name()), withStatsdClient(&tg))
+	defer stop()
+
+	// the file is applied when the tracer starts
+	cfg, _ := CurrentSamplingConfig()
+	assert.Equal(0.5, cfg.SampleRate)
+	assert.Equal(defaultRateLimit, cfg.RateLimit)
+	assert.Len(cfg.Rules, 1)
+
+	write(`{"rate_limit": 20, "rules": [{"name": "http.request", "sample_rate": 0.1}, {"service": "db", "sample_rate": 0}]}`, start.Add(time.Minute))
+	waitFor(func(cfg SamplingConfig) bool { return cfg.RateLimit == 20 })
+	cfg, _ = CurrentSamplingConfig()
+	assert.True(math.IsNaN(cfg.SampleRate))
+	assert.Len(cfg.Rules, 2)
+
+	// invalid files are ignored
+	write(`{"rate_limit": 30, "rules": [{"service": "db", "sample_rate": 2}]}`, start.Add(2*time.Minute))
+	write(`not JSON`, start.Add(3*time.Minute))
+	write(`{"rate_limit": 40}`, start.Add(4*time.Minute))
+	waitFor(func(cfg SamplingConfig) bool { return cfg.RateLimit == 40 })
+	assert.Contains(samplingConfigUpdateTags(&tg), "source:file")
 }
 
 func TestSamplingLimiter(t *testing.T) {
@@ -9,7 +9,6 @@ package tracer
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -21,9 +20,9 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
-	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
+	"github.com/pkg/errors"
 	"github.com/tinylib/msgp/msgp"
 	"golang.org/x/xerrors"
 )
@@ -38,16 +37,22 @@ type (
 )
 
 var (
-	_ ddtrace.Span   = (*span)(nil)
-	_ msgp.Encodable = (*spanList)(nil)
-	_ msgp.Decodable = (*spanLists)(nil)
+	_ ddtrace.Span              = (*span)(nil)
+	_ ddtrace.SpanWithEvents    = (*span)(nil)
+	_ ddtrace.SpanWithLinks     = (*span)(nil)
+	_ ddtrace.SpanWithTraceTags = (*span)(nil)
+	_ msgp.Encodable            = (*spanList)(nil)
+	_ msgp.Decodable            = (*spanLists)(nil)
 )
 
+//msgp:ignore errorConfig
+
 // errorConfig holds customization options for setting error tags.
 type errorConfig struct {
 	noDebugStack bool
 	stackFrames  uint
 	stackSkip    uint
+	chainDepth   uint // maximum number of errors inspected in a chain of wrapped errors
 }
 
 // span represents a computation. Callers must call Finish when a span is
@@ -55,22 +60,26 @@ type errorConfig struct {
 type span struct {
 	sync.RWMutex `msg:"-"`
 
-	Name     string             `msg:"name"`              // operation name
-	Service  string             `msg:"service"`           // service name (i.e. "grpc.server", "http.request")
-	Resource string             `msg:"resource"`          // resource name (i.e. "/user?id=123", "SELECT * FROM users")
-	Type     string             `msg:"type"`              // protocol associated with the span (i.e. "web", "db", "cache")
-	Start    int64              `msg:"start"`             // span start time expressed in nanoseconds since epoch
-	Duration int64              `msg:"duration"`          // duration of the span expressed in nanoseconds
-	Meta     map[string]string  `msg:"meta,omitempty"`    // arbitrary map of metadata
-	Metrics  map[string]float64 `msg:"metrics,omitempty"` // arbitrary map of numeric metrics
-	SpanID   uint64             `msg:"span_id"`           // identifier of this span
-	TraceID  uint64             `msg:"trace_id"`          // identifier of the root span
-	ParentID uint64             `msg:"parent_id"`         // identifier of the span's direct parent
-	Error    int32              `msg:"error"`             // error status of the span; 0 means no errors
+	Name     string             `msg:"name"`                  // operation name
+	Service  string             `msg:"service"`               // service name (i.e. "grpc.server", "http.request")
+	Resource string             `msg:"resource"`              // resource name (i.e. "/user?id=123", "SELECT * FROM users")
+	Type     string             `msg:"type"`                  // protocol associated with the span (i.e. "web", "db", "cache")
+	Start    int64              `msg:"start"`                 // span start time expressed in nanoseconds since epoch
+	Duration int64              `msg:"duration"`              // duration of the span expressed in nanoseconds
+	Meta     map[string]string  `msg:"meta,omitempty"`        // arbitrary map of metadata
+	Metrics  map[string]float64 `msg:"metrics,omitempty"`     // arbitrary map of numeric metrics
+	SpanID   uint64             `msg:"span_id"`               // identifier of this span
+	TraceID  uint64             `msg:"trace_id"`              // identifier of the root span
+	ParentID uint64             `msg:"parent_id"`             // identifier of the span's direct parent
+	Error    int32              `msg:"error"`                 // error status of the span; 0 means no errors
+	Events   []spanEvent        `msg:"span_events,omitempty"` // timestamped events, such as logs
+	Links    []spanLink         `msg:"span_links,omitempty"`  // links to causally related spans
 
 	noDebugStack bool         `msg:"-"` // disables debug stack traces
 	finished     bool         `msg:"-"` // true if the span has been submitted to a tracer.
+	flushable    bool         `msg:"-"` // true once the trace has acknowledged the span as finished; guarded by the trace's lock.
 	context      *spanContext `msg:"-"` // span propagation context
+	rulesLimiter *rateLimiter `msg:"-"` // the rate limiter consulted by the rules sampler for the trace, if any
 	taskEnd      func()       // ends execution tracer (runtime/trace) task, if started
 }
 
@@ -129,6 +138,15 @@ func (s *span) SetTag(key string, value interface{}) {
 	s.setMeta(key, fmt.Sprint(value))
 }
 
+// SetTraceTag implements ddtrace.SpanWithTraceTags. Trace-level tags are added to
+// the local root span of the trace, or to the first span of every chunk of the
+// trace when it is flushed partially. Numeric values are recorded as metrics and
+// all other values as strings. Tags set after the local root span has finished
+// are ignored.
+func (s *span) SetTraceTag(key string, value interface{}) {
+	s.context.trace.setTag(key, value)
+}
+
 // setTagError sets the error tag. It accounts for various valid scenarios.
 // This method is not safe for concurrent use.
 func (s *span) setTagError(value interface{}, cfg errorConfig) {
@@ -160,8 +178,18 @@ func (s *span) setTagError(value interface{}, cfg errorConfig) {
 		setError(true)
 		s.setMeta(ext.ErrorMsg, v.Error())
 		s.setMeta(ext.ErrorType, reflect.TypeOf(v).String())
+		chain := errorChain(v, cfg.chainDepth)
+		if len(chain) > 1 {
+			s.setMeta(ext.ErrorChain, formatErrorChain(chain))
+		}
 		if !cfg.noDebugStack {
-			s.setMeta(ext.ErrorStack, takeStacktrace(cfg.stackFrames, cfg.stackSkip))
+			if pcs := errorStack(chain); len(pcs) > 0 {
+				// the stack of the error's origin is more useful than
+				// the one of the place where it is being recorded
+				s.setMeta(ext.ErrorStack, formatStack(pcs, cfg.stackFrames))
+			} else {
+				s.setMeta(ext.ErrorStack, takeStacktrace(cfg.stackFrames, cfg.stackSkip))
+			}
 		}
 		switch v.(type) {
 		case xerrors.Formatter:
@@ -189,7 +217,6 @@ func takeStacktrace(n, skip uint) string {
 	if n == 0 {
 		n = defaultStackLength
 	}
-	var builder strings.Builder
 	pcs := make([]uintptr, n)
 
 	// +2 to exclude runtime.Callers and takeStacktrace
@@ -197,7 +224,20 @@ func takeStacktrace(n, skip uint) string {
 	if numFrames == 0 {
 		return ""
 	}
-	frames := runtime.CallersFrames(pcs[:numFrames])
+	return formatStack(pcs[:numFrames], n)
+}
+
+// formatStack formats the first n entries of the stack trace made of the program
+// counters pcs. If n is 0, up to defaultStackLength entries are formatted.
+func formatStack(pcs []uintptr, n uint) string {
+	if n == 0 {
+		n = defaultStackLength
+	}
+	if uint(len(pcs)) > n {
+		pcs = pcs[:n]
+	}
+	var builder strings.Builder
+	frames := runtime.CallersFrames(pcs)
 	for i := 0; ; i++ {
 		frame, more := frames.Next()
 		if i != 0 {
@@ -216,6 +256,75 @@ func takeStacktrace(n, skip uint) string {
 	return builder.String()
 }
 
+// defaultErrorChainDepth specifies the default maximum number of errors inspected
+// in a chain of wrapped errors.
+const defaultErrorChainDepth = 8
+
+// errorChain returns err followed by the errors it wraps, as found using their
+// Unwrap or Cause methods, up to a maximum of depth errors. If depth is 0, up to
+// defaultErrorChainDepth errors are returned.
+func errorChain(err error, depth uint) []error {
+	if depth == 0 {
+		depth = defaultErrorChainDepth
+	}
+	var chain []error
+	for err != nil && uint(len(chain)) < depth {
+		chain = append(chain, err)
+		switch v := err.(type) {
+		case interface{ Unwrap() error }:
+			// errors wrapped using fmt.Errorf("%w") or xerrors
+			err = v.Unwrap()
+		case interface{ Cause() error }:
+			// errors wrapped using github.com/pkg/errors
+			err = v.Cause()
+		default:
+			err = nil
+		}
+	}
+	return chain
+}
+
+// formatErrorChain returns the types and messages of the errors in chain, one per line.
+func formatErrorChain(chain []error) string {
+	var builder strings.Builder
+	for i, err := range chain {
+		if i != 0 {
+			builder.WriteByte('\n')
+		}
+		builder.WriteString(reflect.TypeOf(err).String())
+		builder.WriteString(": ")
+		builder.WriteString(err.Error())
+	}
+	return builder.String()
+}
+
+// errorStack returns the program counters of the stack trace held by the innermost
+// error of chain providing one, which is the closest to the origin of the error.
+// It returns nil if there is none.
+func errorStack(chain []error) []uintptr {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if pcs := stackTrace(chain[i]); len(pcs) > 0 {
+			return pcs
+		}
+	}
+	return nil
+}
+
+// stackTrace returns the program counters of the stack trace held by err, if it
+// was created using github.com/pkg/errors.
+func stackTrace(err error) []uintptr {
+	e, ok := err.(interface{ StackTrace() errors.StackTrace })
+	if !ok {
+		return nil
+	}
+	st := e.StackTrace()
+	pcs := make([]uintptr, len(st))
+	for i, f := range st {
+		pcs[i] = uintptr(f)
+	}
+	return pcs
+}
+
 // setMeta sets a string tag. This method is not safe for concurrent use.
 func (s *span) setMeta(key, v string) {
 	if s.Meta == nil {
@@ -299,6 +408,7 @@ func (s *span) Finish(opts ...ddtrace.FinishOption) {
 				noDebugStack: cfg.NoDebugStack,
 				stackFrames:  cfg.StackFrames,
 				stackSkip:    cfg.SkipStackFrames,
+				chainDepth:   cfg.ErrorDetailsDepth,
 			})
 			s.Unlock()
 		}
@@ -334,6 +444,10 @@ func (s *span) finish(finishTime int64) {
 
 	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
 		// we have an active tracer
+		if s == s.context.trace.root && !s.context.drop && s.context.trace.canResample() {
+			// match the sampling rules against the final resource and tags
+			t.rulesSampling.applyFinished(s)
+		}
 		feats := t.features.Load()
 		if feats.Stats && shouldComputeStats(s) {
 			// the agent supports computed stats
@@ -348,10 +462,16 @@ func (s *span) finish(finishTime int64) {
 			// the agent supports dropping p0's in the client
 			if shouldDrop(s) {
 				// ...and this span can be dropped
-				atomic.AddUint64(&t.droppedP0Spans, 1)
 				if s == s.context.trace.root {
 					atomic.AddUint64(&t.droppedP0Traces, 1)
 				}
+				if t.spanSampling.enabled() && t.spanSampling.apply(s) {
+					// unless a single-span sampling rule keeps it, in
+					// which case it is sent on its own
+					t.pushTrace([]*span{s})
+					return
+				}
+				atomic.AddUint64(&t.droppedP0Spans, 1)
 				return
 			}
 		}
@@ -450,25 +570,17 @@ func (s *span) Format(f fmt.State, c rune) {
 	case 's':
 		fmt.Fprint(f, s.String())
 	case 'v':
-		if svc := globalconfig.ServiceName(); svc != "" {
-			fmt.Fprintf(f, "dd.service=%s ", svc)
+		lc := NewLogCorrelation(s)
+		if lc.Service != "" {
+			fmt.Fprintf(f, "%s=%s ", ext.LogKeyService, lc.Service)
 		}
-		if tr, ok := internal.GetGlobalTracer().(*tracer); ok {
-			if tr.config.env != "" {
-				fmt.Fprintf(f, "dd.env=%s ", tr.config.env)
-			}
-			if tr.config.version != "" {
-				fmt.Fprintf(f, "dd.version=%s ", tr.config.version)
-			}
-		} else {
-			if env := os.Getenv("DD_ENV"); env != "" {
-				fmt.Fprintf(f, "dd.env=%s ", env)
-			}
-			if v := os.Getenv("DD_VERSION"); v != "" {
-				fmt.Fprintf(f, "dd.version=%s ", v)
-			}
+		if lc.Env != "" {
+			fmt.Fprintf(f, "%s=%s ", ext.LogKeyEnv, lc.Env)
+		}
+		if lc.Version != "" {
+			fmt.Fprintf(f, "%s=%s ", ext.LogKeyVersion, lc.Version)
 		}
-		fmt.Fprintf(f, `dd.trace_id="%d" dd.span_id="%d"`, s.TraceID, s.SpanID)
+		fmt.Fprintf(f, `%s="%d" %s="%d"`, ext.LogKeyTraceID, lc.TraceID, ext.LogKeySpanID, lc.SpanID)
 	default:
 		fmt.Fprintf(f, "%%!%c(ddtrace.Span=%v)", c, s)
 	}
@@ -482,6 +594,12 @@ const (
 	keyRulesSamplerAppliedRate = "_dd.rule_psr"
 	keyRulesSamplerLimiterRate = "_dd.limit_psr"
 	keyMeasured                = "_dd.measured"
+	// keyTraceID128 is the key of the tag holding the hex-encoded upper 64 bits
+	// of a 128-bit trace ID.
+	keyTraceID128 = "_dd.p.tid"
+	// keySpanLinks is the key of the tag holding the JSON-encoded span links, when
+	// the payload encoding can not hold them natively.
+	keySpanLinks = "_dd.span_links"
 	// keyTopLevel is the key of top level metric indicating if a span is top level.
 	// A top level span is a local root (parent span of the local trace) or the first span of each service.
 	keyTopLevel = "_dd.top_level"
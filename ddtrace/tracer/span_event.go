@@ -0,0 +1,101 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:generate msgp -unexported -marshal=false -o=span_event_msgp.go -tests=false
+
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+// spanEvent is a timestamped event, such as a log entry, which occurred during
+// the lifetime of a span.
+type spanEvent struct {
+	Name         string                 `msg:"name" json:"name"`                                 // name of the event
+	TimeUnixNano uint64                 `msg:"time_unix_nano" json:"time_unix_nano"`             // time of the event in nanoseconds since epoch
+	Attributes   map[string]interface{} `msg:"attributes,omitempty" json:"attributes,omitempty"` // attributes of the event
+}
+
+// AddEvent attaches an event with the given name to the span. The event occurs at
+// the current time, unless changed using the EventTime option.
+func (s *span) AddEvent(name string, opts ...ddtrace.SpanEventOption) {
+	var cfg ddtrace.SpanEventConfig
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+	t := now()
+	if !cfg.Time.IsZero() {
+		t = cfg.Time.UnixNano()
+	}
+	e := spanEvent{Name: name, TimeUnixNano: uint64(t)}
+	if len(cfg.Attributes) > 0 {
+		e.Attributes = make(map[string]interface{}, len(cfg.Attributes))
+		for k, v := range cfg.Attributes {
+			e.Attributes[k] = eventAttributeValue(v)
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		return
+	}
+	s.Events = append(s.Events, e)
+}
+
+// eventAttributeValue converts v into one of the types supported by span event
+// attributes: string, bool, int64, float64, or a []interface{} of those. Other
+// values are converted to strings.
+func eventAttributeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, bool, int64, float64:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case error:
+		return v.Error()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			// byte slices are more useful as strings
+			return string(rv.Bytes())
+		}
+		vs := make([]interface{}, rv.Len())
+		for i := range vs {
+			vs[i] = eventAttributeValue(rv.Index(i).Interface())
+			if _, ok := vs[i].([]interface{}); ok {
+				// nested arrays are not supported
+				vs[i] = fmt.Sprint(rv.Index(i).Interface())
+			}
+		}
+		return vs
+	}
+	return fmt.Sprint(v)
+}
+
+// eventsJSON returns the JSON encoding of the given events, used with encodings
+// which can not hold them natively.
+func eventsJSON(events []spanEvent) string {
+	b, err := json.Marshal(events)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
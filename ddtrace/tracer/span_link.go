@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:generate msgp -unexported -marshal=false -o=span_link_msgp.go -tests=false
+
+package tracer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+// spanLink is a reference from a span to another span, possibly belonging to
+// another trace, which is causally related to it.
+type spanLink struct {
+	TraceID     uint64            `msg:"trace_id" json:"trace_id"`                               // lower 64 bits of the linked trace ID
+	TraceIDHigh uint64            `msg:"trace_id_high,omitempty" json:"trace_id_high,omitempty"` // upper 64 bits of the linked trace ID
+	SpanID      uint64            `msg:"span_id" json:"span_id"`                                 // identifier of the linked span
+	Attributes  map[string]string `msg:"attributes,omitempty" json:"attributes,omitempty"`       // attributes describing the link
+}
+
+// newSpanLink returns a link to the span having the context ctx.
+func newSpanLink(ctx ddtrace.SpanContext, attributes map[string]string) spanLink {
+	l := spanLink{
+		TraceID: ctx.TraceID(),
+		SpanID:  ctx.SpanID(),
+	}
+	switch ctx := ctx.(type) {
+	case *spanContext:
+		l.TraceIDHigh = ctx.traceIDHigh
+	case ddtrace.SpanContextW3C:
+		id := ctx.TraceID128Bytes()
+		l.TraceIDHigh = binary.BigEndian.Uint64(id[:8])
+	}
+	if len(attributes) > 0 {
+		l.Attributes = make(map[string]string, len(attributes))
+		for k, v := range attributes {
+			l.Attributes[k] = v
+		}
+	}
+	return l
+}
+
+// AddLink links the span to the span having the context ctx, described by the
+// given attributes.
+func (s *span) AddLink(ctx ddtrace.SpanContext, attributes map[string]string) {
+	if ctx == nil {
+		return
+	}
+	l := newSpanLink(ctx, attributes)
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		return
+	}
+	s.Links = append(s.Links, l)
+}
+
+// linksJSON returns the JSON encoding of the given links, used with encodings
+// which can not hold them natively.
+func linksJSON(links []spanLink) string {
+	b, err := json.Marshal(links)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
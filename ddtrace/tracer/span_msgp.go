@@ -65,7 +65,7 @@ func (z *span) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
-			if z.Meta == nil && zb0002 > 0 {
+			if z.Meta == nil {
 				z.Meta = make(map[string]string, zb0002)
 			} else if len(z.Meta) > 0 {
 				for key := range z.Meta {
@@ -92,7 +92,7 @@ func (z *span) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
-			if z.Metrics == nil && zb0003 > 0 {
+			if z.Metrics == nil {
 				z.Metrics = make(map[string]float64, zb0003)
 			} else if len(z.Metrics) > 0 {
 				for key := range z.Metrics {
@@ -133,6 +133,40 @@ func (z *span) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "span_events":
+			var zb0004 uint32
+			zb0004, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Events) >= int(zb0004) {
+				z.Events = (z.Events)[:zb0004]
+			} else {
+				z.Events = make([]spanEvent, zb0004)
+			}
+			for za0005 := range z.Events {
+				err = z.Events[za0005].DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		case "span_links":
+			var zb0005 uint32
+			zb0005, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Links) >= int(zb0005) {
+				z.Links = (z.Links)[:zb0005]
+			} else {
+				z.Links = make([]spanLink, zb0005)
+			}
+			for za0006 := range z.Links {
+				err = z.Links[za0006].DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -145,9 +179,35 @@ func (z *span) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *span) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 12
+	// omitempty: check for empty values
+	zb0001Len := uint32(14)
+	var zb0001Mask uint16 /* 14 bits */
+	if z.Meta == nil {
+		zb0001Len--
+		zb0001Mask |= 0x40
+	}
+	if z.Metrics == nil {
+		zb0001Len--
+		zb0001Mask |= 0x80
+	}
+	if z.Events == nil {
+		zb0001Len--
+		zb0001Mask |= 0x1000
+	}
+	if z.Links == nil {
+		zb0001Len--
+		zb0001Mask |= 0x2000
+	}
+	// variable map header, size zb0001Len
+	err = en.Append(0x80 | uint8(zb0001Len))
+	if err != nil {
+		return
+	}
+	if zb0001Len == 0 {
+		return
+	}
 	// write "name"
-	err = en.Append(0x8c, 0xa4, 0x6e, 0x61, 0x6d, 0x65)
+	err = en.Append(0xa4, 0x6e, 0x61, 0x6d, 0x65)
 	if err != nil {
 		return
 	}
@@ -200,43 +260,47 @@ func (z *span) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
-	// write "meta"
-	err = en.Append(0xa4, 0x6d, 0x65, 0x74, 0x61)
-	if err != nil {
-		return
-	}
-	err = en.WriteMapHeader(uint32(len(z.Meta)))
-	if err != nil {
-		return
-	}
-	for za0001, za0002 := range z.Meta {
-		err = en.WriteString(za0001)
+	if (zb0001Mask & 0x40) == 0 { // if not empty
+		// write "meta"
+		err = en.Append(0xa4, 0x6d, 0x65, 0x74, 0x61)
 		if err != nil {
 			return
 		}
-		err = en.WriteString(za0002)
+		err = en.WriteMapHeader(uint32(len(z.Meta)))
 		if err != nil {
 			return
 		}
+		for za0001, za0002 := range z.Meta {
+			err = en.WriteString(za0001)
+			if err != nil {
+				return
+			}
+			err = en.WriteString(za0002)
+			if err != nil {
+				return
+			}
+		}
 	}
-	// write "metrics"
-	err = en.Append(0xa7, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73)
-	if err != nil {
-		return
-	}
-	err = en.WriteMapHeader(uint32(len(z.Metrics)))
-	if err != nil {
-		return
-	}
-	for za0003, za0004 := range z.Metrics {
-		err = en.WriteString(za0003)
+	if (zb0001Mask & 0x80) == 0 { // if not empty
+		// write "metrics"
+		err = en.Append(0xa7, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73)
 		if err != nil {
 			return
 		}
-		err = en.WriteFloat64(za0004)
+		err = en.WriteMapHeader(uint32(len(z.Metrics)))
 		if err != nil {
 			return
 		}
+		for za0003, za0004 := range z.Metrics {
+			err = en.WriteString(za0003)
+			if err != nil {
+				return
+			}
+			err = en.WriteFloat64(za0004)
+			if err != nil {
+				return
+			}
+		}
 	}
 	// write "span_id"
 	err = en.Append(0xa7, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x69, 0x64)
@@ -274,6 +338,40 @@ func (z *span) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	if (zb0001Mask & 0x1000) == 0 { // if not empty
+		// write "span_events"
+		err = en.Append(0xab, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.Events)))
+		if err != nil {
+			return
+		}
+		for za0005 := range z.Events {
+			err = z.Events[za0005].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if (zb0001Mask & 0x2000) == 0 { // if not empty
+		// write "span_links"
+		err = en.Append(0xaa, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x6c, 0x69, 0x6e, 0x6b, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.Links)))
+		if err != nil {
+			return
+		}
+		for za0006 := range z.Links {
+			err = z.Links[za0006].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
 	return
 }
 
@@ -293,7 +391,14 @@ func (z *span) Msgsize() (s int) {
 			s += msgp.StringPrefixSize + len(za0003) + msgp.Float64Size
 		}
 	}
-	s += 8 + msgp.Uint64Size + 9 + msgp.Uint64Size + 10 + msgp.Uint64Size + 6 + msgp.Int32Size
+	s += 8 + msgp.Uint64Size + 9 + msgp.Uint64Size + 10 + msgp.Uint64Size + 6 + msgp.Int32Size + 12 + msgp.ArrayHeaderSize
+	for za0005 := range z.Events {
+		s += z.Events[za0005].Msgsize()
+	}
+	s += 11 + msgp.ArrayHeaderSize
+	for za0006 := range z.Links {
+		s += z.Links[za0006].Msgsize()
+	}
 	return
 }
 
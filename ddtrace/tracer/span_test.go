@@ -6,9 +6,12 @@
 package tracer
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -16,6 +19,7 @@ import (
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -204,6 +208,259 @@ func TestSpanFinishWithErrorStackFrames(t *testing.T) {
 	assert.Equal(strings.Count(span.Meta[ext.ErrorStack], "\n\t"), 2)
 }
 
+type (
+	// stackError is an error holding the stack trace of the place it was created at,
+	// in the format of github.com/pkg/errors.
+	stackError struct {
+		msg   string
+		stack pkgerrors.StackTrace
+	}
+
+	// wrapError wraps an error using the Unwrap method of Go 1.13 errors.
+	wrapError struct {
+		msg string
+		err error
+	}
+
+	// causeError wraps an error using the Cause method of github.com/pkg/errors.
+	causeError struct {
+		msg   string
+		cause error
+	}
+)
+
+func (e *stackError) Error() string                    { return e.msg }
+func (e *stackError) StackTrace() pkgerrors.StackTrace { return e.stack }
+
+func (e *wrapError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *wrapError) Unwrap() error { return e.err }
+
+func (e *causeError) Error() string { return e.msg + ": " + e.cause.Error() }
+func (e *causeError) Cause() error  { return e.cause }
+
+// newStackError returns a stackError holding the stack of its caller.
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	st := make(pkgerrors.StackTrace, n)
+	for i := range st {
+		st[i] = pkgerrors.Frame(pcs[i])
+	}
+	return &stackError{msg: msg, stack: st}
+}
+
+func TestSpanFinishWithErrorChain(t *testing.T) {
+	t.Run("wrapped", func(t *testing.T) {
+		assert := assert.New(t)
+		err := &wrapError{msg: "loading config", err: &causeError{msg: "reading", cause: io.ErrUnexpectedEOF}}
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err))
+
+		assert.Equal("*tracer.wrapError", span.Meta[ext.ErrorType])
+		assert.Equal("*tracer.wrapError: loading config: reading: unexpected EOF\n"+
+			"*tracer.causeError: reading: unexpected EOF\n"+
+			"*errors.errorString: unexpected EOF", span.Meta[ext.ErrorChain])
+		// without embedded stacks, the one of the finish site is used
+		assert.Contains(span.Meta[ext.ErrorStack], "tracer.TestSpanFinishWithErrorChain")
+	})
+
+	t.Run("single", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(errors.New("broken")))
+		assert.NotContains(t, span.Meta, ext.ErrorChain)
+	})
+
+	t.Run("stack", func(t *testing.T) {
+		assert := assert.New(t)
+		err := &causeError{msg: "querying", cause: newStackError("broken")}
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err))
+
+		assert.Equal("*tracer.causeError: querying: broken\n*tracer.stackError: broken", span.Meta[ext.ErrorChain])
+		stack := span.Meta[ext.ErrorStack]
+		assert.True(strings.HasPrefix(stack, "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.newStackError\n"), stack)
+		assert.NotContains(stack, "tracer.(*span).Finish")
+	})
+
+	t.Run("pkg-errors", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(pkgerrors.Wrap(pkgerrors.New("broken"), "querying")))
+		stack := span.Meta[ext.ErrorStack]
+		assert.True(t, strings.HasPrefix(stack, "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.TestSpanFinishWithErrorChain.func"), stack)
+		assert.NotContains(t, stack, "tracer.(*span).Finish")
+	})
+
+	t.Run("stack-frames", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(newStackError("broken")), StackFrames(2, 0))
+		assert.Equal(t, 2, strings.Count(span.Meta[ext.ErrorStack], "\n\t"))
+	})
+
+	t.Run("no-debug-stack", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(newStackError("broken")), NoDebugStack())
+		assert.Empty(t, span.Meta[ext.ErrorStack])
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		assert := assert.New(t)
+		err := &causeError{msg: "a", cause: &causeError{msg: "b", cause: newStackError("c")}}
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err), WithErrorDetails(2))
+		assert.Equal("*tracer.causeError: a: b: c\n*tracer.causeError: b: c", span.Meta[ext.ErrorChain])
+		assert.Contains(span.Meta[ext.ErrorStack], "tracer.(*span).Finish")
+
+		span = newBasicSpan("web.request")
+		span.Finish(WithError(err), WithErrorDetails(1))
+		assert.NotContains(span.Meta, ext.ErrorChain)
+	})
+}
+
+func TestSpanAddEvent(t *testing.T) {
+	t.Run("time", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		before := now()
+		span.AddEvent("first")
+		eventTime := time.Now().Add(-time.Minute)
+		span.AddEvent("second", EventTime(eventTime))
+
+		assert.Len(span.Events, 2)
+		assert.Equal("first", span.Events[0].Name)
+		assert.True(span.Events[0].TimeUnixNano >= uint64(before))
+		assert.Nil(span.Events[0].Attributes)
+		assert.Equal("second", span.Events[1].Name)
+		assert.Equal(uint64(eventTime.UnixNano()), span.Events[1].TimeUnixNano)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.AddEvent("exception", EventAttributes(map[string]interface{}{
+			"message":  "boom",
+			"handled":  false,
+			"attempt":  2,
+			"size":     uint16(512),
+			"ratio":    float32(0.5),
+			"codes":    []int{500, 503},
+			"nested":   [][]string{{"a"}},
+			"duration": time.Second,
+			"err":      errors.New("broken"),
+			"payload":  []byte("raw"),
+			"other":    struct{ A int }{1},
+		}))
+		assert.Equal(t, map[string]interface{}{
+			"message":  "boom",
+			"handled":  false,
+			"attempt":  int64(2),
+			"size":     int64(512),
+			"ratio":    0.5,
+			"codes":    []interface{}{int64(500), int64(503)},
+			"nested":   []interface{}{"[a]"},
+			"duration": "1s",
+			"err":      "broken",
+			"payload":  "raw",
+			"other":    "{1}",
+		}, span.Events[0].Attributes)
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish()
+		span.AddEvent("late")
+		assert.Len(t, span.Events, 0)
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.AddEvent("retry", EventAttributes(map[string]interface{}{"attempt": 1, "reason": "timeout"}))
+		span.AddEvent("done")
+		plain := newBasicSpan("web.request")
+
+		p := newPayload()
+		assert.NoError(p.push(spanList{span, plain}))
+		got, err := decode(p)
+		assert.NoError(err)
+		assert.Equal(span.Events, got[0][0].Events)
+		assert.Nil(got[0][1].Events)
+
+		// the v0.5 format holds them as JSON in the meta
+		p = newPayloadV05()
+		assert.NoError(p.push(spanList{span, plain}))
+		got, err = decodeV05(p)
+		assert.NoError(err)
+		var events []spanEvent
+		assert.NoError(json.Unmarshal([]byte(got[0][0].Meta["events"]), &events))
+		assert.Len(events, 2)
+		assert.Equal("retry", events[0].Name)
+		assert.Equal(span.Events[1].TimeUnixNano, events[1].TimeUnixNano)
+		assert.Equal(map[string]interface{}{"attempt": 1., "reason": "timeout"}, events[0].Attributes)
+		assert.NotContains(got[0][1].Meta, "events")
+	})
+}
+
+func TestSpanLinks(t *testing.T) {
+	t.Run("start", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDefaultTransport()), With128BitTraceIDs(true))
+		defer tracer.Stop()
+		first := tracer.StartSpan("produce").(*span)
+		second := tracer.StartSpan("produce").(*span)
+		span := tracer.StartSpan("consume.batch", WithSpanLinks(first.Context(), nil, second.Context())).(*span)
+
+		assert.Equal([]spanLink{
+			{TraceID: first.TraceID, TraceIDHigh: first.context.traceIDHigh, SpanID: first.SpanID},
+			{TraceID: second.TraceID, TraceIDHigh: second.context.traceIDHigh, SpanID: second.SpanID},
+		}, span.Links)
+		assert.NotZero(span.Links[0].TraceIDHigh)
+		assert.Zero(span.ParentID)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		assert := assert.New(t)
+		linked := newBasicSpan("produce")
+		span := newBasicSpan("consume")
+		attrs := map[string]string{"messaging.operation": "receive"}
+		span.AddLink(linked.Context(), attrs)
+		attrs["messaging.operation"] = "changed"
+		span.AddLink(nil, nil)
+		span.Finish()
+		span.AddLink(linked.Context(), nil)
+
+		assert.Equal([]spanLink{{
+			TraceID:    linked.TraceID,
+			SpanID:     linked.SpanID,
+			Attributes: map[string]string{"messaging.operation": "receive"},
+		}}, span.Links)
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("consume")
+		span.Links = []spanLink{
+			{TraceID: 1, TraceIDHigh: 2, SpanID: 3, Attributes: map[string]string{"k": "v"}},
+			{TraceID: 4, SpanID: 5},
+		}
+		plain := newBasicSpan("consume")
+
+		p := newPayload()
+		assert.NoError(p.push(spanList{span, plain}))
+		got, err := decode(p)
+		assert.NoError(err)
+		assert.Equal(span.Links, got[0][0].Links)
+		assert.Nil(got[0][1].Links)
+
+		// the v0.5 format holds them as JSON in the meta
+		p = newPayloadV05()
+		assert.NoError(p.push(spanList{span, plain}))
+		got, err = decodeV05(p)
+		assert.NoError(err)
+		assert.JSONEq(`[{"trace_id":1,"trace_id_high":2,"span_id":3,"attributes":{"k":"v"}},{"trace_id":4,"span_id":5}]`,
+			got[0][0].Meta[keySpanLinks])
+		assert.NotContains(got[0][1].Meta, keySpanLinks)
+	})
+}
+
 func TestSpanSetTag(t *testing.T) {
 	assert := assert.New(t)
 
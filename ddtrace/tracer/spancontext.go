@@ -6,15 +6,18 @@
 package tracer
 
 import (
+	"encoding/binary"
+	"fmt"
 	"sync"
 	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
-var _ ddtrace.SpanContext = (*spanContext)(nil)
+var _ ddtrace.SpanContextW3C = (*spanContext)(nil)
 
 // SpanContext represents a span state that can propagate to descendant spans
 // and across process boundaries. It contains all the information needed to
@@ -30,13 +33,17 @@ type spanContext struct {
 
 	// the below group should propagate cross-process
 
-	traceID uint64
-	spanID  uint64
+	traceID     uint64
+	traceIDHigh uint64 // upper 64 bits of a 128-bit trace ID; zero when not in use
+	spanID      uint64
 
-	mu         sync.RWMutex // guards below fields
-	baggage    map[string]string
-	hasBaggage int32  // atomic int for quick checking presence of baggage. 0 indicates no baggage, otherwise baggage exists.
-	origin     string // e.g. "synthetics"
+	mu           sync.RWMutex // guards below fields
+	baggage      map[string]string
+	baggageBytes int    // total size of the keys and values in baggage
+	hasBaggage   int32  // atomic int for quick checking presence of baggage. 0 indicates no baggage, otherwise baggage exists.
+	origin       string // e.g. "synthetics"
+	tracestate   string // foreign W3C tracestate list-members, propagated as-is
+	debug        bool   // the B3 debug flag was extracted, and is propagated as-is
 }
 
 // newSpanContext creates a new SpanContext to serve as context for the given
@@ -52,8 +59,11 @@ func newSpanContext(span *span, parent *spanContext) *spanContext {
 	}
 	if parent != nil {
 		context.trace = parent.trace
+		context.traceIDHigh = parent.traceIDHigh
 		context.drop = parent.drop
 		context.origin = parent.origin
+		context.tracestate = parent.tracestate
+		context.debug = parent.debug
 		context.errors = parent.errors
 		parent.ForeachBaggageItem(func(k, v string) bool {
 			context.setBaggageItem(k, v)
@@ -78,6 +88,19 @@ func (c *spanContext) SpanID() uint64 { return c.spanID }
 // TraceID implements ddtrace.SpanContext.
 func (c *spanContext) TraceID() uint64 { return c.traceID }
 
+// TraceID128 implements ddtrace.SpanContextW3C.
+func (c *spanContext) TraceID128() string {
+	return fmt.Sprintf("%016x%016x", c.traceIDHigh, c.traceID)
+}
+
+// TraceID128Bytes implements ddtrace.SpanContextW3C.
+func (c *spanContext) TraceID128Bytes() [16]byte {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], c.traceIDHigh)
+	binary.BigEndian.PutUint64(b[8:], c.traceID)
+	return b
+}
+
 // ForeachBaggageItem implements ddtrace.SpanContext.
 func (c *spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
 	if atomic.LoadInt32(&c.hasBaggage) == 0 {
@@ -106,14 +129,34 @@ func (c *spanContext) samplingPriority() (p int, ok bool) {
 	return c.trace.samplingPriority()
 }
 
+// setBaggageItem sets the baggage item key to val. The item is dropped if it
+// would exceed the baggage limits of the running tracer, or the default ones.
 func (c *spanContext) setBaggageItem(key, val string) {
+	maxItems, maxBytes := defaultBaggageMaxItems, defaultBaggageMaxBytes
+	tr, haveTracer := internal.GetGlobalTracer().(*tracer)
+	if haveTracer && tr.config.baggageMaxItems > 0 {
+		maxItems, maxBytes = tr.config.baggageMaxItems, tr.config.baggageMaxBytes
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	size := c.baggageBytes + len(key) + len(val)
+	old, replace := c.baggage[key]
+	if replace {
+		size -= len(key) + len(old)
+	}
+	if (!replace && len(c.baggage) >= maxItems) || size > maxBytes {
+		log.Debug("Dropping baggage item %q: exceeds limits of %d items and %d bytes", key, maxItems, maxBytes)
+		if haveTracer {
+			atomic.AddInt64(&tr.baggageDropped, 1)
+		}
+		return
+	}
 	if c.baggage == nil {
 		atomic.StoreInt32(&c.hasBaggage, 1)
 		c.baggage = make(map[string]string, 1)
 	}
 	c.baggage[key] = val
+	c.baggageBytes = size
 }
 
 func (c *spanContext) baggageItem(key string) string {
@@ -139,10 +182,23 @@ type trace struct {
 	priority *float64     // sampling priority
 	locked   bool         // specifies if the sampling priority can be altered
 
+	// propagated is set when the span context was injected into a carrier,
+	// after which the sampling decision is no longer revised by the tracer.
+	propagated bool
+
+	// tags and metrics hold the trace-level tags, which are set on the first
+	// span of every chunk of the trace which is flushed.
+	tags    map[string]string
+	metrics map[string]float64
+
 	// root specifies the root of the trace, if known; it is nil when a span
 	// context is extracted from a carrier, at which point there are no spans in
 	// the trace yet.
 	root *span
+
+	// rootFinished is set once the local root span has finished, after which
+	// trace-level tags are ignored.
+	rootFinished bool
 }
 
 var (
@@ -194,6 +250,78 @@ func (t *trace) setSamplingPriorityLocked(p float64) {
 	*t.priority = p
 }
 
+// setPropagated records that the sampling decision of the trace was propagated
+// to another service.
+func (t *trace) setPropagated() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.propagated = true
+}
+
+// canResample reports whether the tracer may still revise the sampling decision
+// of the trace: it must have been made automatically by this tracer, and not yet
+// been propagated or sent.
+func (t *trace) canResample() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.locked || t.propagated || t.priority == nil {
+		return false
+	}
+	p := *t.priority
+	return p == ext.PriorityAutoKeep || p == ext.PriorityAutoReject
+}
+
+// setTag sets a trace-level tag, which will be added to the first span of every
+// chunk of the trace which is flushed. Numeric values are recorded as metrics.
+// The tag is ignored if the local root span has finished.
+func (t *trace) setTag(key string, value interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rootFinished {
+		log.Debug("Ignoring trace-level tag %q set after the local root span finished.", key)
+		return
+	}
+	if v, ok := toFloat64(value); ok {
+		if t.metrics == nil {
+			t.metrics = make(map[string]float64, 1)
+		}
+		t.metrics[key] = v
+		delete(t.tags, key)
+		return
+	}
+	var v string
+	switch value := value.(type) {
+	case string:
+		v = value
+	case fmt.Stringer:
+		v = value.String()
+	default:
+		v = fmt.Sprint(value)
+	}
+	if t.tags == nil {
+		t.tags = make(map[string]string, 1)
+	}
+	t.tags[key] = v
+	delete(t.metrics, key)
+}
+
+// setTraceTags adds the trace-level tags to the span s, which must be locked.
+// It must be called with t.mu held.
+func (t *trace) setTraceTags(s *span) {
+	for k, v := range t.tags {
+		s.setMeta(k, v)
+	}
+	for k, v := range t.metrics {
+		// not using setMetric, which would alter the sampling priority
+		// of the trace while t.mu is held.
+		if s.Metrics == nil {
+			s.Metrics = make(map[string]float64, len(t.metrics))
+		}
+		delete(s.Meta, k)
+		s.Metrics[k] = v
+	}
+}
+
 // push pushes a new span into the trace. If the buffer is full, it returns
 // a errBufferFull error.
 func (t *trace) push(sp *span) {
@@ -236,6 +364,9 @@ func (t *trace) finishedOne(s *span) {
 		return
 	}
 	t.finished++
+	if s == t.root {
+		t.rootFinished = true
+	}
 	if s == t.root && t.priority != nil {
 		// after the root has finished we lock down the priority;
 		// we won't be able to make changes to a span after finishing
@@ -243,14 +374,89 @@ func (t *trace) finishedOne(s *span) {
 		t.root.setMetric(keySamplingPriority, *t.priority)
 		t.locked = true
 	}
+	s.flushable = true
+	tr, haveTracer := internal.GetGlobalTracer().(*tracer)
 	if len(t.spans) != t.finished {
+		if haveTracer && tr.config.partialFlushEnabled && t.finished >= tr.config.partialFlushMinSpans {
+			t.flushPartial(tr, s)
+		}
 		return
 	}
-	if tr, ok := internal.GetGlobalTracer().(*tracer); ok {
+	if haveTracer {
 		// we have a tracer that can receive completed traces.
+		t.sampleSpans(tr, t.spans, s)
+		if len(t.tags) > 0 || len(t.metrics) > 0 {
+			// the first span in the buffer is the local root, unless it
+			// was sent with an earlier chunk.
+			first := t.spans[0]
+			if first != s {
+				first.Lock()
+			}
+			t.setTraceTags(first)
+			if first != s {
+				first.Unlock()
+			}
+		}
 		tr.pushTrace(t.spans)
 		atomic.AddInt64(&tr.spansFinished, int64(len(t.spans)))
 	}
 	t.spans = nil
 	t.finished = 0 // important, because a buffer can be used for several flushes
 }
+
+// sampleSpans applies the single-span sampling rules of tr to the given finished
+// spans if the trace is not sampled, marking those which the agent should keep.
+// The span s is already locked by the caller. It must be called with t.mu held.
+func (t *trace) sampleSpans(tr *tracer, spans []*span, s *span) {
+	if !tr.spanSampling.enabled() || t.priority == nil || *t.priority > 0 {
+		return
+	}
+	for _, sp := range spans {
+		if sp != s {
+			sp.Lock()
+		}
+		tr.spanSampling.apply(sp)
+		if sp != s {
+			sp.Unlock()
+		}
+	}
+}
+
+// flushPartial sends the finished spans of a trace which still has unfinished
+// spans to the tracer, keeping the unfinished ones in the buffer. The sampling
+// priority is locked down and set on the first span of the flushed chunk, along
+// with the trace-level tags, so that all chunks of the trace carry the same
+// sampling decision. The span s is
+// the one which has just finished and is already locked by the caller.
+// It must be called with t.mu held.
+func (t *trace) flushPartial(tr *tracer, s *span) {
+	chunk := make([]*span, 0, t.finished)
+	leftover := make([]*span, 0, len(t.spans)-t.finished)
+	for _, sp := range t.spans {
+		if sp.flushable {
+			chunk = append(chunk, sp)
+		} else {
+			leftover = append(leftover, sp)
+		}
+	}
+	t.sampleSpans(tr, chunk, s)
+	first := chunk[0]
+	if first != s {
+		first.Lock()
+		defer first.Unlock()
+	}
+	if t.priority != nil {
+		first.setMetric(keySamplingPriority, *t.priority)
+		t.locked = true
+	}
+	if high := first.context.traceIDHigh; high != 0 {
+		first.setMeta(keyTraceID128, fmt.Sprintf("%016x", high))
+	}
+	t.setTraceTags(first)
+	log.Debug("Partial flush: sending %d finished spans, keeping %d unfinished", len(chunk), len(leftover))
+	tr.pushTrace(chunk)
+	atomic.AddInt64(&tr.spansFinished, int64(len(chunk)))
+	atomic.AddInt64(&tr.partialFlushes, 1)
+	t.spans = leftover
+	t.finished = 0
+}
@@ -7,12 +7,15 @@ package tracer
 
 import (
 	"context"
+	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
@@ -188,6 +191,168 @@ func TestSpanTracePushSeveral(t *testing.T) {
 	}
 }
 
+func TestSpanTracePartialFlush(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t, WithPartialFlushing(2), With128BitTraceIDs(true))
+		defer stop()
+
+		root := tracer.StartSpan("root", Tag(ext.SamplingPriority, ext.PriorityUserKeep)).(*span)
+		children := make([]*span, 3)
+		for i := range children {
+			children[i] = tracer.StartSpan("child", ChildOf(root.Context())).(*span)
+		}
+		children[0].Finish()
+		assert.Len(root.context.trace.spans, 4, "the trace is not flushed below the threshold")
+		children[1].Finish()
+		flush(1)
+
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+		assert.Equal(children[0].SpanID, traces[0][0].SpanID)
+		assert.Equal(children[1].SpanID, traces[0][1].SpanID)
+		assert.Equal(float64(ext.PriorityUserKeep), traces[0][0].Metrics[keySamplingPriority])
+		assert.Equal(root.Meta[keyTraceID128], traces[0][0].Meta[keyTraceID128])
+		assert.True(root.context.trace.locked, "the sampling priority is locked after a partial flush")
+		assert.Len(root.context.trace.spans, 2, "unfinished spans are kept")
+
+		// changing the priority after a partial flush has no effect
+		root.SetTag(ext.SamplingPriority, ext.PriorityUserReject)
+		children[2].Finish()
+		root.Finish()
+		flush(1)
+
+		traces = transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+		assert.Equal(root.SpanID, traces[0][0].SpanID)
+		assert.Equal(float64(ext.PriorityUserKeep), traces[0][0].Metrics[keySamplingPriority])
+		assert.Len(root.context.trace.spans, 0)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t)
+		defer stop()
+
+		root := tracer.StartSpan("root")
+		for i := 0; i < 3; i++ {
+			tracer.StartSpan("child", ChildOf(root.Context())).Finish()
+		}
+		assert.Len(root.(*span).context.trace.spans, 4)
+		root.Finish()
+		flush(1)
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 4)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_PARTIAL_FLUSH_ENABLED", "true")
+		defer os.Unsetenv("DD_TRACE_PARTIAL_FLUSH_ENABLED")
+		os.Setenv("DD_TRACE_PARTIAL_FLUSH_MIN_SPANS", "10")
+		defer os.Unsetenv("DD_TRACE_PARTIAL_FLUSH_MIN_SPANS")
+		c := newConfig()
+		assert.True(t, c.partialFlushEnabled)
+		assert.Equal(t, 10, c.partialFlushMinSpans)
+	})
+}
+
+func TestTraceTags(t *testing.T) {
+	t.Run("root", func(t *testing.T) {
+		assert := assert.New(t)
+		_, transport, flush, stop := startTestTracer(t)
+		defer stop()
+
+		root, ctx := StartSpanFromContext(context.Background(), "root")
+		child, ctx := StartSpanFromContext(ctx, "child")
+		SetTraceTag(ctx, "tenant_id", "acme")
+		SetTraceTag(ctx, "items", 3)
+		child.(*span).SetTraceTag("cached", true)
+		child.Finish()
+		root.Finish()
+		flush(1)
+
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+		for _, s := range traces[0] {
+			if s.Name != "root" {
+				assert.NotContains(s.Meta, "tenant_id")
+				continue
+			}
+			assert.Equal("acme", s.Meta["tenant_id"])
+			assert.Equal("true", s.Meta["cached"])
+			assert.Equal(3., s.Metrics["items"])
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, flush, stop := startTestTracer(t, WithPartialFlushing(2))
+		defer stop()
+
+		root := tracer.StartSpan("root").(*span)
+		children := make([]*span, 3)
+		for i := range children {
+			children[i] = tracer.StartSpan("child", ChildOf(root.Context())).(*span)
+		}
+		children[0].SetTraceTag("tenant_id", "acme")
+		children[0].Finish()
+		children[1].Finish()
+		flush(1)
+
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+		assert.Equal("acme", traces[0][0].Meta["tenant_id"])
+		assert.NotContains(traces[0][1].Meta, "tenant_id")
+
+		children[2].SetTraceTag("tenant_id", 42)
+		children[2].Finish()
+		root.Finish()
+		flush(1)
+
+		traces = transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+		assert.Equal(root.SpanID, traces[0][0].SpanID)
+		assert.Equal(42., traces[0][0].Metrics["tenant_id"])
+		assert.NotContains(traces[0][0].Meta, "tenant_id")
+	})
+
+	t.Run("root-finished", func(t *testing.T) {
+		assert := assert.New(t)
+		tp := new(testLogger)
+		_, transport, flush, stop := startTestTracer(t, WithLogger(tp), WithDebugMode(true))
+		defer stop()
+
+		root, ctx := StartSpanFromContext(context.Background(), "root")
+		_, ctx = StartSpanFromContext(ctx, "child")
+		root.Finish()
+		tp.Reset()
+		SetTraceTag(ctx, "tenant_id", "acme")
+		child, _ := SpanFromContext(ctx)
+		child.Finish()
+		flush(1)
+
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		for _, s := range traces[0] {
+			assert.NotContains(s.Meta, "tenant_id")
+		}
+		assert.Contains(tp.Lines()[0], `DEBUG: Ignoring trace-level tag "tenant_id" set after the local root span finished.`)
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			SetTraceTag(context.Background(), "tenant_id", "acme")
+			SetTraceTag(ContextWithSpan(context.Background(), &internal.NoopSpan{}), "tenant_id", "acme")
+		})
+	})
+}
+
 // TestSpanFinishPriority asserts that the root span will have the sampling
 // priority metric set by inheriting it from a child.
 func TestSpanFinishPriority(t *testing.T) {
@@ -374,6 +539,48 @@ func TestSpanContextBaggage(t *testing.T) {
 	assert.Equal("value", ctx.baggage["key"])
 }
 
+func TestSpanContextBaggageLimits(t *testing.T) {
+	t.Run("items", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithBaggageLimits(2, 0))
+		defer stop()
+
+		var ctx spanContext
+		ctx.setBaggageItem("a", "1")
+		ctx.setBaggageItem("b", "2")
+		ctx.setBaggageItem("c", "3")
+		ctx.setBaggageItem("a", "4")
+		assert.Equal(map[string]string{"a": "4", "b": "2"}, ctx.baggage)
+		assert.EqualValues(1, atomic.LoadInt64(&tracer.baggageDropped))
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, _, stop := startTestTracer(t, WithBaggageLimits(0, 10))
+		defer stop()
+
+		var ctx spanContext
+		ctx.setBaggageItem("key", "value")
+		ctx.setBaggageItem("k", "toolong")
+		ctx.setBaggageItem("key", "toolongval")
+		ctx.setBaggageItem("key", "short")
+		ctx.setBaggageItem("k", "v")
+		assert.Equal(map[string]string{"key": "short", "k": "v"}, ctx.baggage)
+		assert.Equal(10, ctx.baggageBytes)
+		assert.EqualValues(2, atomic.LoadInt64(&tracer.baggageDropped))
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_BAGGAGE_MAX_ITEMS", "10")
+		defer os.Unsetenv("DD_TRACE_BAGGAGE_MAX_ITEMS")
+		os.Setenv("DD_TRACE_BAGGAGE_MAX_BYTES", "invalid")
+		defer os.Unsetenv("DD_TRACE_BAGGAGE_MAX_BYTES")
+		c := newConfig()
+		assert.Equal(t, 10, c.baggageMaxItems)
+		assert.Equal(t, defaultBaggageMaxBytes, c.baggageMaxBytes)
+	})
+}
+
 func TestSpanContextIterator(t *testing.T) {
 	assert := assert.New(t)
 
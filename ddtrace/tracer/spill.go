@@ -0,0 +1,319 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+const (
+	// defaultSpillMaxSize is the default maximum total size of the payloads
+	// kept in the spill directory.
+	defaultSpillMaxSize = 64 * 1024 * 1024 // 64 MB
+
+	// defaultSpillMaxAge is the default maximum age of a spilled payload.
+	defaultSpillMaxAge = time.Hour
+
+	// spillFileExt is the extension of spilled payload files.
+	spillFileExt = ".msgp"
+
+	// spillV05Suffix marks the names of spilled payloads using the v0.5 format.
+	spillV05Suffix = "-v05"
+)
+
+var (
+	// spillMinBackoff and spillMaxBackoff bound the time waited between two
+	// replay attempts while the agent is unreachable; replaced in tests.
+	spillMinBackoff = time.Second
+	spillMaxBackoff = time.Minute
+)
+
+// spillQueue is a persistent queue of trace payloads which could not be sent to
+// the agent. Payloads are stored as files in a directory, named after the time
+// they were spilled at and the number of traces they contain, and are replayed
+// in order once the agent becomes reachable again. The queue is bounded by the
+// total size and the age of the stored payloads, evicting the oldest first.
+type spillQueue struct {
+	config  *config
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	// mu guards the contents of the directory.
+	mu sync.Mutex
+
+	// wake is signaled when an upload to the agent succeeds, causing the
+	// replay loop to make an attempt without waiting for the current
+	// backoff to elapse.
+	wake chan struct{}
+
+	// stop closes to stop the replay loop.
+	stop chan struct{}
+
+	// wg waits for the replay loop to return.
+	wg sync.WaitGroup
+}
+
+// newSpillQueue returns a new spillQueue storing its payloads in the directory
+// configured in c, creating it if it doesn't exist.
+func newSpillQueue(c *config) (*spillQueue, error) {
+	if err := os.MkdirAll(c.spillDir, 0700); err != nil {
+		return nil, err
+	}
+	q := &spillQueue{
+		config:  c,
+		dir:     c.spillDir,
+		maxSize: c.spillMaxSize,
+		maxAge:  c.spillMaxAge,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	if q.maxSize <= 0 {
+		q.maxSize = defaultSpillMaxSize
+	}
+	if q.maxAge <= 0 {
+		q.maxAge = defaultSpillMaxAge
+	}
+	return q, nil
+}
+
+// spillFile holds information about a spilled payload.
+type spillFile struct {
+	name    string
+	created time.Time
+	count   int
+	size    int64
+	v05     bool // the payload uses the v0.5 format
+}
+
+// parseSpillFile returns the information held in the name of a spilled payload
+// file, formatted as "<unix nanoseconds>-<trace count>.msgp", or as
+// "<unix nanoseconds>-<trace count>-v05.msgp" for v0.5 payloads.
+func parseSpillFile(fi os.FileInfo) (spillFile, bool) {
+	name := fi.Name()
+	if fi.IsDir() || !strings.HasSuffix(name, spillFileExt) {
+		return spillFile{}, false
+	}
+	base := strings.TrimSuffix(name, spillFileExt)
+	v05 := strings.HasSuffix(base, spillV05Suffix)
+	parts := strings.SplitN(strings.TrimSuffix(base, spillV05Suffix), "-", 2)
+	if len(parts) != 2 {
+		return spillFile{}, false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return spillFile{}, false
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return spillFile{}, false
+	}
+	return spillFile{name: name, created: time.Unix(0, ts), count: count, size: fi.Size(), v05: v05}, true
+}
+
+// files returns the spilled payloads, oldest first. It must be called with q.mu held.
+func (q *spillQueue) files() []spillFile {
+	infos, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		log.Error("Reading spill directory: %v", err)
+		return nil
+	}
+	var files []spillFile
+	for _, fi := range infos {
+		if f, ok := parseSpillFile(fi); ok {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].created.Before(files[j].created) })
+	return files
+}
+
+// spill stores the contents of payload p, which could not be sent to the agent.
+func (q *spillQueue) spill(p *payload) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := p.itemCount()
+	var (
+		suffix string
+		table  []byte
+	)
+	if p.strings != nil {
+		// v0.5 payloads are stored preceded by their string table
+		suffix = spillV05Suffix
+		table = p.strings.appendMsg(nil)
+	}
+	name := fmt.Sprintf("%d-%d%s%s", now(), count, suffix, spillFileExt)
+	tmp, err := ioutil.TempFile(q.dir, "spill-*.tmp")
+	if err != nil {
+		return err
+	}
+	for _, data := range [][]byte{table, p.buf.Bytes()} {
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	q.config.statsd.Count("datadog.tracer.spill.traces_written", int64(count), nil, 1)
+	q.config.statsd.Count("datadog.tracer.spill.bytes_written", int64(len(table)+p.buf.Len()), nil, 1)
+	q.evict()
+	return nil
+}
+
+// evict removes the spilled payloads which are older than the maximum age and,
+// oldest first, those exceeding the maximum total size. It must be called with
+// q.mu held.
+func (q *spillQueue) evict() {
+	files := q.files()
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	cutoff := time.Unix(0, now()).Add(-q.maxAge)
+	for _, f := range files {
+		var reason string
+		switch {
+		case f.created.Before(cutoff):
+			reason = "reason:expired"
+		case total > q.maxSize:
+			reason = "reason:size"
+		default:
+			continue
+		}
+		if err := os.Remove(filepath.Join(q.dir, f.name)); err != nil {
+			log.Error("Evicting spilled payload: %v", err)
+			continue
+		}
+		total -= f.size
+		q.config.statsd.Count("datadog.tracer.spill.traces_evicted", int64(f.count), []string{reason}, 1)
+	}
+}
+
+// notify wakes up the replay loop, if it is waiting.
+func (q *spillQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replayOne attempts to send the oldest spilled payload using send. It reports
+// whether there are more payloads to be sent and returns any send error.
+func (q *spillQueue) replayOne(send func(*payload) error) (more bool, err error) {
+	q.mu.Lock()
+	q.evict()
+	files := q.files()
+	q.mu.Unlock()
+	if len(files) == 0 {
+		return false, nil
+	}
+	f := files[0]
+	path := filepath.Join(q.dir, f.name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		// it may have been evicted in the meantime
+		return len(files) > 1, nil
+	}
+	p := newPayload()
+	if f.v05 {
+		if p.strings, data, err = readStringTable(data); err != nil {
+			log.Error("Discarding corrupted spilled payload %s: %v", f.name, err)
+			q.mu.Lock()
+			os.Remove(path)
+			q.mu.Unlock()
+			return len(files) > 1, nil
+		}
+	}
+	p.buf.Write(data)
+	p.count = uint64(f.count)
+	p.updateHeader()
+	if err := send(p); err != nil {
+		q.config.statsd.Incr("datadog.tracer.spill.replay_failed", nil, 1)
+		if shouldSpill(err) {
+			return true, err
+		}
+		// the agent will never accept it
+		log.Error("lost %d spilled traces: %v", f.count, err)
+		q.config.statsd.Count("datadog.tracer.traces_dropped", int64(f.count), []string{"reason:send_failed"}, 1)
+		q.mu.Lock()
+		os.Remove(path)
+		q.mu.Unlock()
+		return len(files) > 1, nil
+	}
+	q.mu.Lock()
+	os.Remove(path)
+	q.mu.Unlock()
+	q.config.statsd.Count("datadog.tracer.spill.traces_replayed", int64(f.count), nil, 1)
+	return len(files) > 1, nil
+}
+
+// start runs the replay loop in a new goroutine, sending spilled payloads using
+// send. Failed attempts are retried with an exponential backoff.
+func (q *spillQueue) start(send func(*payload) error) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		backoff := spillMinBackoff
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+				backoff = spillMinBackoff
+			case <-timer.C:
+			}
+			more, err := q.replayOne(send)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			switch {
+			case err != nil:
+				log.Debug("Replaying spilled payload failed, retrying in %s: %v", backoff, err)
+				timer.Reset(backoff)
+				if backoff *= 2; backoff > spillMaxBackoff {
+					backoff = spillMaxBackoff
+				}
+			case more:
+				backoff = spillMinBackoff
+				timer.Reset(0)
+			default:
+				// nothing left; wait for new payloads, but check
+				// from time to time for expired ones
+				timer.Reset(spillMaxBackoff)
+			}
+		}
+	}()
+}
+
+// close stops the replay loop. Any remaining payloads are kept on disk, to be
+// replayed by a future tracer using the same directory.
+func (q *spillQueue) close() {
+	close(q.stop)
+	q.wg.Wait()
+}
@@ -0,0 +1,235 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyTransport is a dummyTransport which fails to send payloads while down is set.
+type flakyTransport struct {
+	*dummyTransport
+	down int32
+}
+
+func (t *flakyTransport) send(p *payload) (io.ReadCloser, error) {
+	if atomic.LoadInt32(&t.down) == 1 {
+		return nil, errors.New("connection refused")
+	}
+	return t.dummyTransport.send(p)
+}
+
+// rejectingTransport is a dummyTransport which fails to send payloads with err.
+type rejectingTransport struct {
+	*dummyTransport
+	err error
+}
+
+func (t *rejectingTransport) send(p *payload) (io.ReadCloser, error) {
+	return nil, t.err
+}
+
+func spillFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestSpillQueue(t *testing.T) {
+	defer func(min, max time.Duration) {
+		spillMinBackoff, spillMaxBackoff = min, max
+	}(spillMinBackoff, spillMaxBackoff)
+	spillMinBackoff, spillMaxBackoff = time.Millisecond, 10*time.Millisecond
+
+	t.Run("replay", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "spill")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		var tg testStatsdClient
+		transport := &flakyTransport{dummyTransport: newDummyTransport(), down: 1}
+		c := newConfig(withTransport(transport), withStatsdClient(&tg), WithSpillDirectory(dir, 0, 0))
+		h := newAgentTraceWriter(c, newPrioritySampler())
+		defer h.stop()
+
+		h.add([]*span{makeSpan(0), makeSpan(0)})
+		h.flush()
+		h.wg.Wait()
+		assert.Len(spillFiles(t, dir), 1)
+		assert.Equal(0, transport.Len())
+		assert.NotContains(tg.CallNames(), "datadog.tracer.traces_dropped")
+		assert.Equal(int64(1), tg.Counts()["datadog.tracer.spill.traces_written"])
+
+		// the agent comes back
+		atomic.StoreInt32(&transport.down, 0)
+		h.add([]*span{makeSpan(0)})
+		h.flush()
+		h.wg.Wait()
+
+		deadline := time.After(time.Second)
+		for transport.Len() < 2 {
+			select {
+			case <-deadline:
+				t.Fatalf("timed out waiting for replay, got %d traces", transport.Len())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+		traces := transport.Traces()
+		assert.Len(traces, 2)
+		assert.Empty(spillFiles(t, dir))
+		assert.Equal(int64(1), tg.Counts()["datadog.tracer.spill.traces_replayed"])
+	})
+
+	t.Run("v0.5", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "spill")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		c := newConfig(withStatsdClient(&testStatsdClient{}), WithSpillDirectory(dir, 0, 0))
+		q, err := newSpillQueue(c)
+		assert.NoError(err)
+		p, v04 := newPayloadV05(), newPayload()
+		for _, trace := range []spanList{{makeSpan(2)}, {makeSpan(1), makeSpan(0)}} {
+			assert.NoError(p.push(trace))
+			assert.NoError(v04.push(trace))
+		}
+		want, err := decode(v04)
+		assert.NoError(err)
+		assert.NoError(q.spill(p))
+		files := spillFiles(t, dir)
+		assert.Len(files, 1)
+		assert.Contains(files[0], spillV05Suffix+spillFileExt)
+
+		var got spanLists
+		more, err := q.replayOne(func(p *payload) error {
+			assert.NotNil(p.strings)
+			got, err = decode(p)
+			return err
+		})
+		assert.NoError(err)
+		assert.False(more)
+		assert.Equal(want, got)
+		assert.Empty(spillFiles(t, dir))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			err   error
+			spill bool
+		}{
+			"network":     {err: errors.New("connection refused"), spill: true},
+			"unavailable": {err: &retriableError{&statusError{code: 503, err: errors.New("Service Unavailable")}}, spill: true},
+			"timeout":     {err: &statusError{code: 408, err: errors.New("Request Timeout")}, spill: true},
+			"bad-request": {err: &statusError{code: 400, err: errors.New("Bad Request")}, spill: false},
+			"too-large":   {err: &statusError{code: 413, err: errors.New("Request Entity Too Large")}, spill: false},
+		} {
+			t.Run(name, func(t *testing.T) {
+				assert := assert.New(t)
+				dir, err := ioutil.TempDir("", "spill")
+				assert.NoError(err)
+				defer os.RemoveAll(dir)
+
+				var tg testStatsdClient
+				transport := &rejectingTransport{dummyTransport: newDummyTransport(), err: tt.err}
+				c := newConfig(withTransport(transport), withStatsdClient(&tg), WithSpillDirectory(dir, 0, 0))
+				h := newAgentTraceWriter(c, newPrioritySampler())
+				defer h.stop()
+
+				h.add([]*span{makeSpan(0)})
+				h.flush()
+				h.wg.Wait()
+				if tt.spill {
+					assert.Len(spillFiles(t, dir), 1)
+					assert.NotContains(tg.CallNames(), "datadog.tracer.traces_dropped")
+				} else {
+					assert.Empty(spillFiles(t, dir))
+					assert.Equal(int64(1), tg.Counts()["datadog.tracer.traces_dropped"])
+				}
+			})
+		}
+	})
+
+	t.Run("replay-rejected", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "spill")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		var tg testStatsdClient
+		c := newConfig(withStatsdClient(&tg), WithSpillDirectory(dir, 0, 0))
+		q, err := newSpillQueue(c)
+		assert.NoError(err)
+		p, err := encode([][]*span{{makeSpan(0)}})
+		assert.NoError(err)
+		assert.NoError(q.spill(p))
+		more, err := q.replayOne(func(p *payload) error {
+			return &statusError{code: 413, err: errors.New("Request Entity Too Large")}
+		})
+		assert.NoError(err)
+		assert.False(more)
+		assert.Empty(spillFiles(t, dir))
+		assert.Equal(int64(1), tg.Counts()["datadog.tracer.traces_dropped"])
+	})
+
+	t.Run("evict-size", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "spill")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		var tg testStatsdClient
+		p, err := encode([][]*span{{makeSpan(10)}})
+		assert.NoError(err)
+		c := newConfig(withStatsdClient(&tg), WithSpillDirectory(dir, int64(p.size()*2), 0))
+		q, err := newSpillQueue(c)
+		assert.NoError(err)
+		for i := 0; i < 3; i++ {
+			assert.NoError(q.spill(p))
+			time.Sleep(time.Millisecond) // ensure distinct names
+		}
+		assert.Len(spillFiles(t, dir), 2)
+		assert.Equal(int64(1), tg.Counts()["datadog.tracer.spill.traces_evicted"])
+	})
+
+	t.Run("evict-age", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "spill")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		old := filepath.Join(dir, fmt.Sprintf("%d-3%s", time.Now().Add(-2*time.Hour).UnixNano(), spillFileExt))
+		assert.NoError(ioutil.WriteFile(old, []byte{0x90}, 0600))
+		var tg testStatsdClient
+		c := newConfig(withStatsdClient(&tg), WithSpillDirectory(dir, 0, time.Hour))
+		q, err := newSpillQueue(c)
+		assert.NoError(err)
+		p, err := encode([][]*span{{makeSpan(0)}})
+		assert.NoError(err)
+		assert.NoError(q.spill(p))
+		files := spillFiles(t, dir)
+		assert.Len(files, 1)
+		assert.NotEqual(filepath.Base(old), files[0])
+		assert.Equal(int64(3), tg.Counts()["datadog.tracer.spill.traces_evicted"])
+	})
+}
@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+)
+
+// SQLCommentInjectionMode specifies the information which is injected into
+// SQL queries by a SQLCommentCarrier.
+type SQLCommentInjectionMode string
+
+const (
+	// SQLInjectionDisabled disables the injection of comments into SQL queries.
+	SQLInjectionDisabled SQLCommentInjectionMode = "disabled"
+	// SQLInjectionModeService injects the service, environment and version of
+	// the application, as well as the name of the database service. These never
+	// change, so prepared statements are still cached by the database.
+	SQLInjectionModeService SQLCommentInjectionMode = "service"
+	// SQLInjectionModeFull additionally injects the W3C traceparent of the span
+	// tracing the query. As it differs for each query, it should not be used
+	// with prepared statements.
+	SQLInjectionModeFull SQLCommentInjectionMode = "full"
+)
+
+// Keys of the tags injected into SQL comments.
+const (
+	sqlCommentService   = "ddps"
+	sqlCommentEnv       = "dde"
+	sqlCommentVersion   = "ddpv"
+	sqlCommentDBService = "dddbs"
+)
+
+// SQLCommentCarrier injects information about the application and, depending
+// on its Mode, the trace into SQL queries, by prepending a comment to them which
+// follows the sqlcommenter format (https://google.github.io/sqlcommenter/spec/).
+// This allows correlating the queries seen by the database, for example in its
+// slow query logs, with the services and traces which ran them.
+type SQLCommentCarrier struct {
+	// Query is the SQL query. Inject prepends the comment to it.
+	Query string
+	// Mode specifies the information which is injected.
+	Mode SQLCommentInjectionMode
+	// DBServiceName is the name of the service representing the database.
+	DBServiceName string
+	// SpanID is the ID of the span which traces the query. In full mode, it is
+	// generated by Inject when unset and should be used to start that span (see
+	// WithSpanID), so that the injected traceparent points to it.
+	SpanID uint64
+}
+
+// Inject prepends a comment to the carrier's Query. In full mode, the injected
+// traceparent belongs to a child of spanCtx. It is omitted when spanCtx is nil
+// or was not created by this tracer.
+func (c *SQLCommentCarrier) Inject(spanCtx ddtrace.SpanContext) {
+	tags := make(map[string]string, 5)
+	switch c.Mode {
+	case SQLInjectionModeFull:
+		if ctx, ok := spanCtx.(*spanContext); ok && ctx.traceID != 0 {
+			if c.SpanID == 0 {
+				c.SpanID = random.Uint64()
+			}
+			flags := "00"
+			if p, ok := ctx.samplingPriority(); ok && p >= ext.PriorityAutoKeep {
+				flags = "01"
+			}
+			tags[traceparentHeader] = fmt.Sprintf("00-%s-%016x-%s", ctx.TraceID128(), c.SpanID, flags)
+		}
+		fallthrough
+	case SQLInjectionModeService:
+		if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+			setNonEmpty(tags, sqlCommentService, t.config.serviceName)
+			setNonEmpty(tags, sqlCommentEnv, t.config.env)
+			setNonEmpty(tags, sqlCommentVersion, t.config.version)
+		}
+		setNonEmpty(tags, sqlCommentDBService, c.DBServiceName)
+	}
+	if len(tags) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s='%s'", k, escapeSQLCommentValue(tags[k]))
+	}
+	b.WriteString("*/")
+	if c.Query != "" {
+		b.WriteByte(' ')
+		b.WriteString(c.Query)
+	}
+	c.Query = b.String()
+}
+
+// setNonEmpty sets the key k of m to v, unless v is empty.
+func setNonEmpty(m map[string]string, k, v string) {
+	if v != "" {
+		m[k] = v
+	}
+}
+
+// escapeSQLCommentValue URL-encodes s, as required by the sqlcommenter format.
+// Spaces are encoded as "%20" rather than "+".
+func escapeSQLCommentValue(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
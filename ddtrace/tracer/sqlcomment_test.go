@@ -0,0 +1,56 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+)
+
+func TestSQLCommentCarrier(t *testing.T) {
+	_, _, _, stop := startTestTracer(t, WithService("whiskey service !#$%&'()*+,/:;=?@[]"), WithEnv("test-env"), WithServiceVersion("1.2"))
+	defer stop()
+
+	t.Run("disabled", func(t *testing.T) {
+		c := SQLCommentCarrier{Query: "SELECT 1", Mode: SQLInjectionDisabled, DBServiceName: "db"}
+		c.Inject(nil)
+		assert.Equal(t, "SELECT 1", c.Query)
+		assert.Zero(t, c.SpanID)
+	})
+
+	t.Run("service", func(t *testing.T) {
+		root := StartSpan("root")
+		defer root.Finish()
+		c := SQLCommentCarrier{Query: "SELECT 1", Mode: SQLInjectionModeService, DBServiceName: "db"}
+		c.Inject(root.Context())
+		assert.Equal(t, "/*dddbs='db',dde='test-env',ddps='whiskey%20service%20%21%23%24%25%26%27%28%29%2A%2B%2C%2F%3A%3B%3D%3F%40%5B%5D',ddpv='1.2'*/ SELECT 1", c.Query)
+		assert.Zero(t, c.SpanID)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		root := StartSpan("root", Tag(ext.SamplingPriority, ext.PriorityUserKeep))
+		defer root.Finish()
+		c := SQLCommentCarrier{Query: "SELECT 1", Mode: SQLInjectionModeFull}
+		c.Inject(root.Context())
+		assert.NotZero(t, c.SpanID)
+		child := StartSpan("child", ChildOf(root.Context()), WithSpanID(c.SpanID))
+		defer child.Finish()
+		traceparent := fmt.Sprintf("00-%s-%016x-01", child.Context().(*spanContext).TraceID128(), child.Context().SpanID())
+		assert.Contains(t, c.Query, "traceparent='"+traceparent+"'*/ SELECT 1")
+	})
+
+	t.Run("full-no-span", func(t *testing.T) {
+		c := SQLCommentCarrier{Query: "SELECT 1", Mode: SQLInjectionModeFull, SpanID: 42}
+		c.Inject(nil)
+		assert.NotContains(t, c.Query, "traceparent")
+		assert.Contains(t, c.Query, "dde='test-env'")
+		assert.EqualValues(t, 42, c.SpanID)
+	})
+}
@@ -8,9 +8,11 @@ package tracer
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -86,6 +88,10 @@ const (
 	DefaultPriorityHeader = "x-datadog-sampling-priority"
 )
 
+// traceTagsHeader specifies the name of the header holding trace-level tags which
+// are propagated along with the trace, such as the upper 64 bits of a 128-bit trace ID.
+const traceTagsHeader = "x-datadog-tags"
+
 // originHeader specifies the name of the header indicating the origin of the trace.
 // It is used with the Synthetics product and usually has the value "synthetics".
 const originHeader = "x-datadog-origin"
@@ -107,11 +113,40 @@ type PropagatorConfig struct {
 	// PriorityHeader specifies the map key that will be used to store the sampling priority.
 	// It deafults to DefaultPriorityHeader.
 	PriorityHeader string
+
+	// BaggageAllowList specifies the keys of the baggage items which may be
+	// propagated to other services. When empty, it defaults to the comma-separated
+	// list found in the DD_TRACE_BAGGAGE_ALLOWLIST environment variable, and all
+	// baggage items are propagated if that is not set either.
+	BaggageAllowList []string
+}
+
+// baggageAllowed reports whether the baggage item with the given key may be
+// propagated.
+func (cfg *PropagatorConfig) baggageAllowed(key string) bool {
+	if len(cfg.BaggageAllowList) == 0 {
+		return true
+	}
+	for _, k := range cfg.BaggageAllowList {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 // NewPropagator returns a new propagator which uses TextMap to inject
 // and extract values. It propagates trace and span IDs and baggage.
 // To use the defaults, nil may be provided in place of the config.
+//
+// The propagation styles used for injecting and extracting can be chosen by
+// setting the DD_PROPAGATION_STYLE_INJECT and DD_PROPAGATION_STYLE_EXTRACT
+// environment variables to a comma-separated list of the values "datadog",
+// "b3", "b3 single header", "tracecontext" (W3C Trace Context) and "baggage"
+// (W3C Baggage). The default is "datadog". The baggage found in the W3C baggage
+// header is added to the span context extracted by the other styles. When they
+// find none, the extracted span context only holds the baggage, and spans started
+// as its children begin a new trace.
 func NewPropagator(cfg *PropagatorConfig) Propagator {
 	if cfg == nil {
 		cfg = new(PropagatorConfig)
@@ -128,18 +163,35 @@ func NewPropagator(cfg *PropagatorConfig) Propagator {
 	if cfg.PriorityHeader == "" {
 		cfg.PriorityHeader = DefaultPriorityHeader
 	}
-	return &chainedPropagator{
-		injectors:  getPropagators(cfg, headerPropagationStyleInject),
-		extractors: getPropagators(cfg, headerPropagationStyleExtract),
+	if len(cfg.BaggageAllowList) == 0 {
+		for _, k := range strings.Split(os.Getenv("DD_TRACE_BAGGAGE_ALLOWLIST"), ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				cfg.BaggageAllowList = append(cfg.BaggageAllowList, k)
+			}
+		}
 	}
+	p := &chainedPropagator{
+		injectors: getPropagators(cfg, headerPropagationStyleInject),
+	}
+	for _, e := range getPropagators(cfg, headerPropagationStyleExtract) {
+		if b, ok := e.(*propagatorBaggage); ok {
+			p.baggage = b
+			continue
+		}
+		p.extractors = append(p.extractors, e)
+	}
+	return p
 }
 
 // chainedPropagator implements Propagator and applies a list of injectors and extractors.
 // When injecting, all injectors are called to propagate the span context.
-// When extracting, it tries each extractor, selecting the first successful one.
+// When extracting, it tries each extractor, selecting the first successful one,
+// and adds to it the baggage found by the baggage extractor, if any. When no other
+// extractor succeeds, the context holding only the baggage is returned.
 type chainedPropagator struct {
 	injectors  []Propagator
 	extractors []Propagator
+	baggage    *propagatorBaggage
 }
 
 // getPropagators returns a list of propagators based on the list found in the
@@ -153,11 +205,17 @@ func getPropagators(cfg *PropagatorConfig, env string) []Propagator {
 	}
 	var list []Propagator
 	for _, v := range strings.Split(ps, ",") {
-		switch strings.ToLower(v) {
+		switch strings.ToLower(strings.TrimSpace(v)) {
 		case "datadog":
 			list = append(list, dd)
 		case "b3":
 			list = append(list, &propagatorB3{})
+		case "b3 single header":
+			list = append(list, &propagatorB3SingleHeader{})
+		case "tracecontext":
+			list = append(list, &propagatorW3c{})
+		case "baggage":
+			list = append(list, &propagatorBaggage{cfg})
 		default:
 			log.Warn("unrecognized propagator: %s\n", v)
 		}
@@ -188,6 +246,13 @@ func (p *chainedPropagator) Extract(carrier interface{}) (ddtrace.SpanContext, e
 		ctx, err := v.Extract(carrier)
 		if ctx != nil {
 			// first extractor returns
+			if sctx, ok := ctx.(*spanContext); ok && p.baggage != nil {
+				if reader, ok := carrier.(TextMapReader); ok {
+					if err := p.baggage.extractBaggage(reader, sctx); err != nil {
+						return nil, err
+					}
+				}
+			}
 			log.Debug("Extracted span context: %#v", ctx)
 			return ctx, nil
 		}
@@ -196,6 +261,9 @@ func (p *chainedPropagator) Extract(carrier interface{}) (ddtrace.SpanContext, e
 		}
 		return nil, err
 	}
+	if p.baggage != nil {
+		return p.baggage.Extract(carrier)
+	}
 	return nil, ErrSpanContextNotFound
 }
 
@@ -228,9 +296,14 @@ func (p *propagator) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWr
 	if ctx.origin != "" {
 		writer.Set(originHeader, ctx.origin)
 	}
+	if ctx.traceIDHigh != 0 {
+		writer.Set(traceTagsHeader, fmt.Sprintf("%s=%016x", keyTraceID128, ctx.traceIDHigh))
+	}
 	// propagate OpenTracing baggage
 	for k, v := range ctx.baggage {
-		writer.Set(p.cfg.BaggagePrefix+k, v)
+		if p.cfg.baggageAllowed(k) {
+			writer.Set(p.cfg.BaggagePrefix+k, v)
+		}
 	}
 	return nil
 }
@@ -268,6 +341,8 @@ func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 			ctx.setSamplingPriority(priority)
 		case originHeader:
 			ctx.origin = v
+		case traceTagsHeader:
+			ctx.traceIDHigh = parseTraceTags(v)
 		default:
 			if strings.HasPrefix(key, p.cfg.BaggagePrefix) {
 				ctx.setBaggageItem(strings.TrimPrefix(key, p.cfg.BaggagePrefix), v)
@@ -284,6 +359,24 @@ func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 	return &ctx, nil
 }
 
+// parseTraceTags returns the upper 64 bits of the trace ID found in the given
+// value of the x-datadog-tags header, or zero if it is missing or malformed.
+func parseTraceTags(v string) uint64 {
+	for _, tag := range strings.Split(v, ",") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] != keyTraceID128 {
+			continue
+		}
+		if len(kv[1]) != 16 || !isLowerHex(kv[1]) {
+			log.Debug("malformed %s value in %s: %q", keyTraceID128, traceTagsHeader, kv[1])
+			return 0
+		}
+		high, _ := strconv.ParseUint(kv[1], 16, 64)
+		return high
+	}
+	return 0
+}
+
 const (
 	b3TraceIDHeader = "x-b3-traceid"
 	b3SpanIDHeader  = "x-b3-spanid"
@@ -308,7 +401,11 @@ func (*propagatorB3) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWr
 	if !ok || ctx.traceID == 0 || ctx.spanID == 0 {
 		return ErrInvalidSpanContext
 	}
-	writer.Set(b3TraceIDHeader, fmt.Sprintf("%016x", ctx.traceID))
+	if ctx.traceIDHigh != 0 {
+		writer.Set(b3TraceIDHeader, ctx.TraceID128())
+	} else {
+		writer.Set(b3TraceIDHeader, fmt.Sprintf("%016x", ctx.traceID))
+	}
 	writer.Set(b3SpanIDHeader, fmt.Sprintf("%016x", ctx.spanID))
 	if p, ok := ctx.samplingPriority(); ok {
 		if p >= ext.PriorityAutoKeep {
@@ -336,7 +433,14 @@ func (*propagatorB3) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 		key := strings.ToLower(k)
 		switch key {
 		case b3TraceIDHeader:
+			if len(v) > 32 {
+				return ErrSpanContextCorrupted
+			}
 			if len(v) > 16 {
+				ctx.traceIDHigh, err = strconv.ParseUint(v[:len(v)-16], 16, 64)
+				if err != nil {
+					return ErrSpanContextCorrupted
+				}
 				v = v[len(v)-16:]
 			}
 			ctx.traceID, err = strconv.ParseUint(v, 16, 64)
@@ -366,3 +470,444 @@ func (*propagatorB3) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 	}
 	return &ctx, nil
 }
+
+// b3SingleHeader is the name of the header used by the B3 single header format,
+// which holds "{traceid}-{spanid}-{sampled}-{parentspanid}", where the last two
+// fields are optional.
+const b3SingleHeader = "b3"
+
+// propagatorB3SingleHeader implements Propagator and injects/extracts span contexts
+// using the single "b3" header. Only TextMap carriers are supported.
+type propagatorB3SingleHeader struct{}
+
+func (p *propagatorB3SingleHeader) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (*propagatorB3SingleHeader) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID == 0 || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	var traceID string
+	if ctx.traceIDHigh != 0 {
+		traceID = ctx.TraceID128()
+	} else {
+		traceID = fmt.Sprintf("%016x", ctx.traceID)
+	}
+	header := fmt.Sprintf("%s-%016x", traceID, ctx.spanID)
+	if p, ok := ctx.samplingPriority(); ok {
+		switch {
+		case p >= ext.PriorityUserKeep && ctx.debug:
+			// the debug flag is only propagated, as it requests more
+			// than keeping the trace
+			header += "-d"
+		case p >= ext.PriorityAutoKeep:
+			header += "-1"
+		default:
+			header += "-0"
+		}
+	}
+	writer.Set(b3SingleHeader, header)
+	return nil
+}
+
+func (p *propagatorB3SingleHeader) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		return p.extractTextMap(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (*propagatorB3SingleHeader) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	var ctx spanContext
+	err := reader.ForeachKey(func(k, v string) error {
+		if strings.ToLower(k) != b3SingleHeader {
+			return nil
+		}
+		parts := strings.Split(strings.TrimSpace(v), "-")
+		if len(parts) == 1 {
+			switch parts[0] {
+			case "0", "1", "d":
+				// only a sampling decision is present; there is
+				// no trace to continue
+				return nil
+			}
+			return ErrSpanContextCorrupted
+		}
+		if len(parts) > 4 {
+			return ErrSpanContextCorrupted
+		}
+		traceID, spanID := parts[0], parts[1]
+		if (len(traceID) != 16 && len(traceID) != 32) || len(spanID) != 16 {
+			return ErrSpanContextCorrupted
+		}
+		var err error
+		if len(traceID) == 32 {
+			ctx.traceIDHigh, err = strconv.ParseUint(traceID[:16], 16, 64)
+			if err != nil {
+				return ErrSpanContextCorrupted
+			}
+			traceID = traceID[16:]
+		}
+		if ctx.traceID, err = strconv.ParseUint(traceID, 16, 64); err != nil {
+			return ErrSpanContextCorrupted
+		}
+		if ctx.spanID, err = strconv.ParseUint(spanID, 16, 64); err != nil {
+			return ErrSpanContextCorrupted
+		}
+		if len(parts) >= 3 {
+			switch parts[2] {
+			case "0":
+				ctx.setSamplingPriority(ext.PriorityAutoReject)
+			case "1":
+				ctx.setSamplingPriority(ext.PriorityAutoKeep)
+			case "d":
+				ctx.setSamplingPriority(ext.PriorityUserKeep)
+				ctx.debug = true
+			default:
+				return ErrSpanContextCorrupted
+			}
+		}
+		if len(parts) == 4 {
+			if _, err := strconv.ParseUint(parts[3], 16, 64); err != nil || len(parts[3]) != 16 {
+				return ErrSpanContextCorrupted
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ctx.traceID == 0 || ctx.spanID == 0 {
+		return nil, ErrSpanContextNotFound
+	}
+	return &ctx, nil
+}
+
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// maxTracestateMembers is the maximum number of list-members allowed in
+// the tracestate header, as specified by the W3C Trace Context specification.
+const maxTracestateMembers = 32
+
+// propagatorW3c implements Propagator and injects/extracts span contexts
+// using the W3C Trace Context headers (traceparent and tracestate).
+// Only TextMap carriers are supported.
+type propagatorW3c struct{}
+
+func (p *propagatorW3c) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+// injectTextMap propagates the span context using the traceparent header, as
+// well as a tracestate header holding Datadog specific information in its "dd"
+// list-member, followed by any foreign list-members that were extracted.
+func (*propagatorW3c) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID == 0 || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	flags := "00"
+	p, ok := ctx.samplingPriority()
+	if ok && p >= ext.PriorityAutoKeep {
+		flags = "01"
+	}
+	writer.Set(traceparentHeader, fmt.Sprintf("00-%s-%016x-%s", ctx.TraceID128(), ctx.spanID, flags))
+	writer.Set(tracestateHeader, composeTracestate(ctx, p, ok))
+	return nil
+}
+
+// composeTracestate returns the value of the tracestate header for the given
+// context. The "dd" list-member is always placed first, as it was the most
+// recently updated one.
+func composeTracestate(ctx *spanContext, priority int, hasPriority bool) string {
+	var dd []string
+	if hasPriority {
+		dd = append(dd, "s:"+strconv.Itoa(priority))
+	}
+	if ctx.origin != "" {
+		dd = append(dd, "o:"+sanitizeTracestateValue(ctx.origin))
+	}
+	members := make([]string, 0, maxTracestateMembers)
+	if len(dd) > 0 {
+		members = append(members, "dd="+strings.Join(dd, ";"))
+	}
+	for _, m := range strings.Split(ctx.tracestate, ",") {
+		if len(members) == maxTracestateMembers {
+			break
+		}
+		if m = strings.TrimSpace(m); m == "" {
+			continue
+		}
+		members = append(members, m)
+	}
+	return strings.Join(members, ",")
+}
+
+// sanitizeTracestateValue replaces all characters which are not allowed within
+// the value of the "dd" tracestate list-member with an underscore.
+func sanitizeTracestateValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == ',' || r == ';' || r == '=' {
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+func (p *propagatorW3c) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		return p.extractTextMap(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (*propagatorW3c) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	var (
+		parent string
+		states []string
+	)
+	err := reader.ForeachKey(func(k, v string) error {
+		switch strings.ToLower(k) {
+		case traceparentHeader:
+			if parent != "" {
+				// multiple traceparent headers are invalid
+				return ErrSpanContextCorrupted
+			}
+			parent = strings.TrimSpace(v)
+		case tracestateHeader:
+			states = append(states, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parent == "" {
+		return nil, ErrSpanContextNotFound
+	}
+	var ctx spanContext
+	sampled, err := parseTraceparent(&ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	parseTracestate(&ctx, strings.Join(states, ","), sampled)
+	return &ctx, nil
+}
+
+// parseTraceparent parses the given traceparent header value into ctx and
+// reports whether the sampled flag was set. It accepts future versions of
+// the header, as long as the version 00 fields can be found at the beginning.
+func parseTraceparent(ctx *spanContext, header string) (sampled bool, err error) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 {
+		return false, ErrSpanContextCorrupted
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" {
+		return false, ErrSpanContextCorrupted
+	}
+	if version == "00" && len(parts) != 4 {
+		return false, ErrSpanContextCorrupted
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) || len(spanID) != 16 || !isLowerHex(spanID) {
+		return false, ErrSpanContextCorrupted
+	}
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return false, ErrSpanContextCorrupted
+	}
+	if ctx.traceIDHigh, err = strconv.ParseUint(traceID[:16], 16, 64); err != nil {
+		return false, ErrSpanContextCorrupted
+	}
+	if ctx.traceID, err = strconv.ParseUint(traceID[16:], 16, 64); err != nil {
+		return false, ErrSpanContextCorrupted
+	}
+	if ctx.spanID, err = strconv.ParseUint(spanID, 16, 64); err != nil {
+		return false, ErrSpanContextCorrupted
+	}
+	if ctx.traceID == 0 || ctx.spanID == 0 {
+		// the trace ID is invalid if it is all zeroes; spans are identified by
+		// the lower 64 bits, which must then be non-zero as well
+		return false, ErrSpanContextCorrupted
+	}
+	f, err := strconv.ParseUint(flags, 16, 8)
+	if err != nil {
+		return false, ErrSpanContextCorrupted
+	}
+	return f&0x1 == 1, nil
+}
+
+// parseTracestate reads the sampling priority and origin from the "dd" list-member
+// of the given tracestate header and keeps all other list-members on ctx, so that
+// they can be propagated further. The sampled flag found in traceparent takes
+// precedence over the priority found in tracestate when the two disagree.
+func parseTracestate(ctx *spanContext, header string, sampled bool) {
+	var (
+		priority    int
+		hasPriority bool
+		foreign     []string
+	)
+	for _, m := range strings.Split(header, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if !strings.HasPrefix(m, "dd=") {
+			foreign = append(foreign, m)
+			continue
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(m, "dd="), ";") {
+			kv := strings.SplitN(field, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "s":
+				if p, err := strconv.Atoi(kv[1]); err == nil {
+					priority, hasPriority = p, true
+				}
+			case "o":
+				ctx.origin = kv[1]
+			}
+		}
+	}
+	switch {
+	case sampled && (!hasPriority || priority <= 0):
+		priority = ext.PriorityAutoKeep
+	case !sampled && (!hasPriority || priority > 0):
+		priority = ext.PriorityAutoReject
+	}
+	ctx.setSamplingPriority(priority)
+	if len(foreign) > maxTracestateMembers-1 {
+		// leave room for our own list-member
+		foreign = foreign[:maxTracestateMembers-1]
+	}
+	ctx.tracestate = strings.Join(foreign, ",")
+}
+
+// isLowerHex reports whether s is made up only of lowercase hexadecimal characters.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// baggageHeader is the name of the header used by the W3C Baggage specification,
+// which holds a comma-separated list of "key=value" members, optionally followed
+// by semicolon-separated properties.
+const baggageHeader = "baggage"
+
+// propagatorBaggage implements Propagator and injects/extracts the baggage of span
+// contexts using the W3C baggage header. It does not propagate the trace itself.
+// Only TextMap carriers are supported.
+type propagatorBaggage struct {
+	cfg *PropagatorConfig
+}
+
+func (p *propagatorBaggage) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (p *propagatorBaggage) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok {
+		return ErrInvalidSpanContext
+	}
+	var members []string
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if p.cfg.baggageAllowed(k) {
+			members = append(members, escapeBaggage(k)+"="+escapeBaggage(v))
+		}
+		return true
+	})
+	if len(members) > 0 {
+		writer.Set(baggageHeader, strings.Join(members, ","))
+	}
+	return nil
+}
+
+func (p *propagatorBaggage) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		var ctx spanContext
+		if err := p.extractBaggage(c, &ctx); err != nil {
+			return nil, err
+		}
+		if atomic.LoadInt32(&ctx.hasBaggage) == 0 {
+			return nil, ErrSpanContextNotFound
+		}
+		return &ctx, nil
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+// extractBaggage adds the baggage items found in the baggage headers of reader
+// to ctx. Malformed list-members are skipped; properties are discarded.
+func (*propagatorBaggage) extractBaggage(reader TextMapReader, ctx *spanContext) error {
+	return reader.ForeachKey(func(k, v string) error {
+		if strings.ToLower(k) != baggageHeader {
+			return nil
+		}
+		for _, m := range strings.Split(v, ",") {
+			if i := strings.IndexByte(m, ';'); i >= 0 {
+				m = m[:i]
+			}
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key, err := url.PathUnescape(strings.TrimSpace(kv[0]))
+			if err != nil || key == "" {
+				continue
+			}
+			val, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+			if err != nil {
+				continue
+			}
+			ctx.setBaggageItem(key, val)
+		}
+		return nil
+	})
+}
+
+// escapeBaggage percent-encodes all characters of s which are not allowed
+// within the keys and values of the W3C baggage header.
+func escapeBaggage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' || c == '%' || c == '=' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -7,6 +7,7 @@ package tracer
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -342,3 +343,452 @@ func TestB3(t *testing.T) {
 		assert.Equal(2, p)
 	})
 }
+
+func TestW3C(t *testing.T) {
+	t.Run("inject", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "tracecontext")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+
+		var tests = []struct {
+			traceID, spanID uint64
+			priority        int
+			origin          string
+			tracestate      string
+			out             map[string]string
+		}{
+			{
+				traceID:  1412508178991881,
+				spanID:   1842642739201064,
+				priority: ext.PriorityUserKeep,
+				out: map[string]string{
+					traceparentHeader: "00-0000000000000000000504ab30404b09-00068bdfb1eb0428-01",
+					tracestateHeader:  "dd=s:2",
+				},
+			},
+			{
+				traceID:  1,
+				spanID:   1,
+				priority: ext.PriorityUserReject,
+				origin:   "synthetics;web=x",
+				out: map[string]string{
+					traceparentHeader: "00-00000000000000000000000000000001-0000000000000001-00",
+					tracestateHeader:  "dd=s:-1;o:synthetics_web_x",
+				},
+			},
+			{
+				traceID:    1,
+				spanID:     2,
+				priority:   ext.PriorityAutoKeep,
+				tracestate: "foo=1,bar=2",
+				out: map[string]string{
+					traceparentHeader: "00-00000000000000000000000000000001-0000000000000002-01",
+					tracestateHeader:  "dd=s:1,foo=1,bar=2",
+				},
+			},
+		}
+		for _, test := range tests {
+			t.Run("", func(t *testing.T) {
+				tracer := newTracer()
+				root := tracer.StartSpan("web.request").(*span)
+				root.SetTag(ext.SamplingPriority, test.priority)
+				ctx, ok := root.Context().(*spanContext)
+				ctx.traceID = test.traceID
+				ctx.spanID = test.spanID
+				ctx.origin = test.origin
+				ctx.tracestate = test.tracestate
+				headers := TextMapCarrier(map[string]string{})
+				err := tracer.Inject(ctx, headers)
+
+				assert := assert.New(t)
+				assert.True(ok)
+				assert.Nil(err)
+				assert.Equal(test.out, map[string]string(headers))
+			})
+		}
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "tracecontext")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		var tests = []struct {
+			in         TextMapCarrier
+			traceID    uint64
+			spanID     uint64
+			priority   int
+			origin     string
+			tracestate string
+		}{
+			{
+				in: TextMapCarrier{
+					traceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				},
+				traceID:  11803532876627986230,
+				spanID:   67667974448284343,
+				priority: ext.PriorityAutoKeep,
+			},
+			{
+				in: TextMapCarrier{
+					traceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+					tracestateHeader:  "congo=t61rcWkgMzE, dd=s:-1;o:synthetics,rojo=00f067aa0ba902b7",
+				},
+				traceID:    11803532876627986230,
+				spanID:     67667974448284343,
+				priority:   ext.PriorityUserReject,
+				origin:     "synthetics",
+				tracestate: "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7",
+			},
+			{
+				// the sampled flag wins over a contradicting priority
+				in: TextMapCarrier{
+					traceparentHeader: "00-00000000000000000000000000000001-0000000000000002-01",
+					tracestateHeader:  "dd=s:-1",
+				},
+				traceID:  1,
+				spanID:   2,
+				priority: ext.PriorityAutoKeep,
+			},
+			{
+				// future versions may carry extra fields
+				in: TextMapCarrier{
+					traceparentHeader: "01-00000000000000000000000000000001-0000000000000002-03-what",
+					tracestateHeader:  "dd=s:2",
+				},
+				traceID:  1,
+				spanID:   2,
+				priority: ext.PriorityUserKeep,
+			},
+		}
+		for _, test := range tests {
+			t.Run("", func(t *testing.T) {
+				tracer := newTracer()
+				assert := assert.New(t)
+				ctx, err := tracer.Extract(test.in)
+				assert.Nil(err)
+				sctx, ok := ctx.(*spanContext)
+				assert.True(ok)
+
+				assert.Equal(test.traceID, sctx.traceID)
+				assert.Equal(test.spanID, sctx.spanID)
+				p, ok := sctx.samplingPriority()
+				assert.True(ok)
+				assert.Equal(test.priority, p)
+				assert.Equal(test.origin, sctx.origin)
+				assert.Equal(test.tracestate, sctx.tracestate)
+			})
+		}
+	})
+
+	t.Run("extract-invalid", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "tracecontext")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		for _, tp := range []string{
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da60000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		} {
+			tracer := newTracer()
+			_, err := tracer.Extract(TextMapCarrier{traceparentHeader: tp})
+			assert.Equal(t, ErrSpanContextCorrupted, err, tp)
+		}
+		_, err := newTracer().Extract(TextMapCarrier{tracestateHeader: "dd=s:1"})
+		assert.Equal(t, ErrSpanContextNotFound, err)
+	})
+
+	t.Run("inject-extract", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "datadog,tracecontext")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "tracecontext,datadog")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		tracer := newTracer()
+		assert := assert.New(t)
+		ctx, err := tracer.Extract(HTTPHeadersCarrier(http.Header{
+			"Traceparent": []string{"00-00000000000000000000000000000001-0000000000000002-01"},
+			"Tracestate":  []string{"foo=1", "dd=s:2;o:rum,bar=2"},
+		}))
+		assert.Nil(err)
+		child := tracer.StartSpan("child", ChildOf(ctx)).(*span)
+		headers := TextMapCarrier(map[string]string{})
+		assert.Nil(tracer.Inject(child.Context(), headers))
+
+		assert.Equal("1", headers[DefaultTraceIDHeader])
+		assert.Equal(strconv.FormatUint(child.SpanID, 10), headers[DefaultParentIDHeader])
+		assert.Equal("2", headers[DefaultPriorityHeader])
+		assert.Equal("rum", headers[originHeader])
+		assert.Equal(fmt.Sprintf("00-00000000000000000000000000000001-%016x-01", child.SpanID), headers[traceparentHeader])
+		assert.Equal("dd=s:2;o:rum,foo=1,bar=2", headers[tracestateHeader])
+	})
+}
+
+func TestBaggage(t *testing.T) {
+	t.Run("inject", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "datadog,baggage")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+
+		tracer := newTracer()
+		root := tracer.StartSpan("web.request")
+		root.SetBaggageItem("user.id", "a b,c=d")
+		headers := TextMapCarrier(map[string]string{})
+		assert.Nil(t, tracer.Inject(root.Context(), headers))
+		assert.Equal(t, "user.id=a%20b%2Cc%3Dd", headers[baggageHeader])
+		assert.Equal(t, "a b,c=d", headers[DefaultBaggageHeaderPrefix+"user.id"])
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "datadog,baggage")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		tracer := newTracer()
+		assert := assert.New(t)
+		ctx, err := tracer.Extract(HTTPHeadersCarrier(http.Header{
+			"X-Datadog-Trace-Id":  []string{"1"},
+			"X-Datadog-Parent-Id": []string{"2"},
+			"Ot-Baggage-Item":     []string{"x"},
+			"Baggage":             []string{"user.id = a%20b%2Cc ; prop=1, malformed,item=y"},
+		}))
+		assert.Nil(err)
+		sctx, ok := ctx.(*spanContext)
+		assert.True(ok)
+		assert.Equal(uint64(1), sctx.traceID)
+		assert.Equal(map[string]string{"item": "y", "user.id": "a b,c"}, sctx.baggage)
+	})
+
+	t.Run("extract-no-trace", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "datadog,baggage")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		assert := assert.New(t)
+		tracer := newTracer()
+		ctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			baggageHeader: "item=y",
+		}))
+		assert.Nil(err)
+		assert.Zero(ctx.TraceID())
+		child := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		assert.NotZero(child.TraceID)
+		assert.Equal(child.SpanID, child.TraceID)
+		assert.Zero(child.ParentID)
+		assert.Equal("y", child.BaggageItem("item"))
+
+		_, err = tracer.Extract(TextMapCarrier(map[string]string{}))
+		assert.Equal(ErrSpanContextNotFound, err)
+	})
+
+	t.Run("extract-baggage-only", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "baggage")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		tracer := newTracer()
+		ctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			baggageHeader:         "item=y",
+		}))
+		assert.Nil(t, err)
+		assert.Zero(t, ctx.TraceID())
+		assert.Equal(t, map[string]string{"item": "y"}, ctx.(*spanContext).baggage)
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "datadog,baggage")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+		os.Setenv("DD_TRACE_BAGGAGE_ALLOWLIST", "tenant, user.id")
+		defer os.Unsetenv("DD_TRACE_BAGGAGE_ALLOWLIST")
+
+		tracer := newTracer()
+		root := tracer.StartSpan("web.request")
+		root.SetBaggageItem("tenant", "acme")
+		root.SetBaggageItem("secret", "hunter2")
+		headers := TextMapCarrier(map[string]string{})
+		assert.Nil(t, tracer.Inject(root.Context(), headers))
+		assert.Equal(t, "tenant=acme", headers[baggageHeader])
+		assert.Equal(t, "acme", headers[DefaultBaggageHeaderPrefix+"tenant"])
+		assert.NotContains(t, headers, DefaultBaggageHeaderPrefix+"secret")
+		assert.Equal(t, "hunter2", root.BaggageItem("secret"), "baggage is kept in-process")
+	})
+
+	t.Run("config", func(t *testing.T) {
+		os.Setenv("DD_TRACE_BAGGAGE_ALLOWLIST", "tenant")
+		defer os.Unsetenv("DD_TRACE_BAGGAGE_ALLOWLIST")
+
+		cfg := &PropagatorConfig{BaggageAllowList: []string{"user.id"}}
+		NewPropagator(cfg)
+		assert.True(t, cfg.baggageAllowed("user.id"))
+		assert.False(t, cfg.baggageAllowed("tenant"))
+	})
+}
+
+func TestTextMapPropagator128BitTraceID(t *testing.T) {
+	for _, style := range []string{"datadog", "b3", "tracecontext"} {
+		t.Run(style, func(t *testing.T) {
+			os.Setenv("DD_PROPAGATION_STYLE_INJECT", style)
+			defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+			os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", style)
+			defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+			assert := assert.New(t)
+			tracer := newTracer(With128BitTraceIDs(true))
+			root := tracer.StartSpan("web.request").(*span)
+			root.SetTag(ext.SamplingPriority, ext.PriorityAutoKeep)
+			ctx := root.Context().(*spanContext)
+			headers := TextMapCarrier(map[string]string{})
+			assert.Nil(tracer.Inject(ctx, headers))
+
+			sctx, err := tracer.Extract(headers)
+			assert.Nil(err)
+			xctx, ok := sctx.(*spanContext)
+			assert.True(ok)
+			assert.Equal(ctx.traceID, xctx.traceID)
+			assert.Equal(ctx.traceIDHigh, xctx.traceIDHigh)
+			assert.Equal(ctx.TraceID128(), xctx.TraceID128())
+		})
+	}
+
+	t.Run("b3-extract", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "b3")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		assert := assert.New(t)
+		tracer := newTracer()
+		sctx, err := tracer.Extract(TextMapCarrier{
+			b3TraceIDHeader: "6e96719ded9c1864a21ba1551789e3f5",
+			b3SpanIDHeader:  "a1eb5bf36e56e50e",
+		})
+		assert.Nil(err)
+		xctx := sctx.(*spanContext)
+		assert.Equal(uint64(0x6e96719ded9c1864), xctx.traceIDHigh)
+		assert.Equal(uint64(0xa21ba1551789e3f5), xctx.traceID)
+
+		_, err = tracer.Extract(TextMapCarrier{
+			b3TraceIDHeader: "6e96719ded9c1864a21ba1551789e3f5a",
+			b3SpanIDHeader:  "a1eb5bf36e56e50e",
+		})
+		assert.Equal(ErrSpanContextCorrupted, err)
+	})
+
+	t.Run("datadog-malformed", func(t *testing.T) {
+		tracer := newTracer()
+		sctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			traceTagsHeader:       "_dd.p.tid=XYZ",
+		})
+		assert.Nil(t, err)
+		assert.Zero(t, sctx.(*spanContext).traceIDHigh)
+	})
+}
+
+func TestB3SingleHeader(t *testing.T) {
+	t.Run("inject", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "B3 single header")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+
+		var tests = []struct {
+			traceID, traceIDHigh, spanID uint64
+			priority                     int
+			out                          string
+		}{
+			{1412508178991881, 0, 1842642739201064, ext.PriorityAutoKeep, "000504ab30404b09-00068bdfb1eb0428-1"},
+			{1, 0, 1, ext.PriorityUserReject, "0000000000000001-0000000000000001-0"},
+			{1, 0, 2, ext.PriorityUserKeep, "0000000000000001-0000000000000002-1"},
+			{2, 1, 3, ext.PriorityAutoReject, "00000000000000010000000000000002-0000000000000003-0"},
+		}
+		for _, test := range tests {
+			t.Run("", func(t *testing.T) {
+				tracer := newTracer()
+				root := tracer.StartSpan("web.request").(*span)
+				root.SetTag(ext.SamplingPriority, test.priority)
+				ctx, ok := root.Context().(*spanContext)
+				ctx.traceID = test.traceID
+				ctx.traceIDHigh = test.traceIDHigh
+				ctx.spanID = test.spanID
+				headers := TextMapCarrier(map[string]string{})
+				err := tracer.Inject(ctx, headers)
+
+				assert := assert.New(t)
+				assert.True(ok)
+				assert.Nil(err)
+				assert.Equal(test.out, headers[b3SingleHeader])
+			})
+		}
+	})
+
+	t.Run("inject-debug", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_INJECT", "B3 single header")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_INJECT")
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "B3 single header")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		assert := assert.New(t)
+		tracer := newTracer()
+		ctx, err := tracer.Extract(TextMapCarrier{b3SingleHeader: "0000000000000001-0000000000000002-d"})
+		assert.Nil(err)
+		child := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		headers := TextMapCarrier(map[string]string{})
+		assert.Nil(tracer.Inject(child.Context(), headers))
+		assert.Equal(fmt.Sprintf("0000000000000001-%016x-d", child.SpanID), headers[b3SingleHeader])
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "datadog, b3 single header")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		var tests = []struct {
+			in                           string
+			traceID, traceIDHigh, spanID uint64
+			priority                     int
+			hasPriority                  bool
+		}{
+			{"000504ab30404b09-00068bdfb1eb0428", 1412508178991881, 0, 1842642739201064, 0, false},
+			{"000504ab30404b09-00068bdfb1eb0428-1", 1412508178991881, 0, 1842642739201064, ext.PriorityAutoKeep, true},
+			{"0000000000000001-0000000000000002-0-0000000000000003", 1, 0, 2, ext.PriorityAutoReject, true},
+			{"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d-05e3ac9a4f6e3b90", 0x64fe8b2a57d3eff7, 0x80f198ee56343ba8, 0xe457b5a2e4d86bd1, ext.PriorityUserKeep, true},
+		}
+		for _, test := range tests {
+			t.Run("", func(t *testing.T) {
+				tracer := newTracer()
+				assert := assert.New(t)
+				ctx, err := tracer.Extract(HTTPHeadersCarrier(http.Header{"B3": []string{test.in}}))
+				assert.Nil(err)
+				sctx, ok := ctx.(*spanContext)
+				assert.True(ok)
+
+				assert.Equal(test.traceID, sctx.traceID)
+				assert.Equal(test.traceIDHigh, sctx.traceIDHigh)
+				assert.Equal(test.spanID, sctx.spanID)
+				p, ok := sctx.samplingPriority()
+				assert.Equal(test.hasPriority, ok)
+				assert.Equal(test.priority, p)
+			})
+		}
+	})
+
+	t.Run("extract-invalid", func(t *testing.T) {
+		os.Setenv("DD_PROPAGATION_STYLE_EXTRACT", "b3 single header")
+		defer os.Unsetenv("DD_PROPAGATION_STYLE_EXTRACT")
+
+		tracer := newTracer()
+		for _, in := range []string{
+			"000504ab30404b09",
+			"000504ab30404b09-00068bdfb1eb0428-x",
+			"000504ab30404b09-00068bdfb1eb04-1",
+			"00000504ab30404b09-00068bdfb1eb0428-1",
+			"000504ab30404b09-00068bdfb1eb0428-1-05e3ac9a4f6e3b90-1",
+			"000504ab30404b09-00068bdfb1eb0428-1-zzz",
+		} {
+			_, err := tracer.Extract(TextMapCarrier{b3SingleHeader: in})
+			assert.Equal(t, ErrSpanContextCorrupted, err, in)
+		}
+		for _, in := range []string{"0", "1", "d"} {
+			_, err := tracer.Extract(TextMapCarrier{b3SingleHeader: in})
+			assert.Equal(t, ErrSpanContextNotFound, err, in)
+		}
+	})
+}
@@ -17,6 +17,8 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
@@ -71,6 +73,14 @@ type tracer struct {
 	// finished, and dropped
 	spansStarted, spansFinished, tracesDropped int64
 
+	// partialFlushes counts the number of chunks sent for traces which were
+	// not yet complete.
+	partialFlushes int64
+
+	// baggageDropped counts the number of baggage items which were dropped
+	// for exceeding the baggage limits.
+	baggageDropped int64
+
 	// Records the number of dropped P0 traces and spans.
 	droppedP0Traces, droppedP0Spans uint64
 
@@ -78,6 +88,10 @@ type tracer struct {
 	// rules for applying a sampling rate to spans that match the designated service
 	// or operation name.
 	rulesSampling *rulesSampler
+
+	// spanSampling holds the single-span sampling rules, applied to the spans of
+	// traces which are not sampled.
+	spanSampling *singleSpanSampler
 }
 
 const (
@@ -110,10 +124,10 @@ func Start(opts ...StartOption) {
 		return // mock tracer active
 	}
 	t := newTracer(opts...)
-	if t.config.HasFeature("discovery") {
-		t.loadAgentFeatures()
-	}
+	t.loadAgentFeatures()
 	internal.SetGlobalTracer(t)
+	globalconfig.SetStatsd(t.config.statsd)
+	t.startDataStreams()
 	if t.config.logStartup {
 		logStartup(t)
 	}
@@ -121,6 +135,8 @@ func Start(opts ...StartOption) {
 
 // Stop stops the started tracer. Subsequent calls are valid but become no-op.
 func Stop() {
+	globalconfig.SetStatsd(nil)
+	datastreams.SetTransport(nil)
 	internal.SetGlobalTracer(&internal.NoopTracer{})
 	log.Flush()
 }
@@ -162,12 +178,25 @@ func newUnstartedTracer(opts ...StartOption) *tracer {
 	if envRules != nil {
 		c.samplingRules = envRules
 	}
+	envSpanRules, err := spanSamplingRulesFromEnv()
+	if err != nil {
+		log.Warn("DIAGNOSTICS Error(s) parsing DD_SPAN_SAMPLING_RULES: %s", err)
+	}
+	if envSpanRules != nil {
+		c.spanSamplingRules = envSpanRules
+	}
 	sampler := newPrioritySampler()
+	features := &agentFeatures{}
 	var writer traceWriter
-	if c.logToStdout {
+	switch {
+	case c.logToStdout:
 		writer = newLogTraceWriter(c)
-	} else {
-		writer = newAgentTraceWriter(c, sampler)
+	case c.otlpEndpoint != "":
+		writer = newOTLPTraceWriter(c)
+	default:
+		w := newAgentTraceWriter(c, sampler)
+		w.features = features
+		writer = w
 	}
 	t := &tracer{
 		config:           c,
@@ -176,9 +205,10 @@ func newUnstartedTracer(opts ...StartOption) *tracer {
 		stop:             make(chan struct{}),
 		flush:            make(chan chan<- struct{}),
 		rulesSampling:    newRulesSampler(c.samplingRules),
+		spanSampling:     newSingleSpanSampler(c.spanSamplingRules),
 		prioritySampling: sampler,
 		pid:              strconv.Itoa(os.Getpid()),
-		features:         &agentFeatures{},
+		features:         features,
 		stats:            newConcentrator(c, defaultStatsBucketSize),
 	}
 	return t
@@ -212,6 +242,15 @@ func newTracer(opts ...StartOption) *tracer {
 		defer t.wg.Done()
 		t.reportHealthMetrics(statsInterval)
 	}()
+	if c.samplingConfigFile != "" {
+		w := &samplingConfigWatcher{tracer: t, path: c.samplingConfigFile}
+		w.check()
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.watchSamplingConfig(w)
+		}()
+	}
 	t.stats.Start()
 	return t
 }
@@ -248,7 +287,7 @@ type agentFeatures struct {
 	DropP0s bool
 
 	// V05 reports whether it's ok to use the /v0.5/traces endpoint format.
-	V05 bool // TODO(x): Not yet implemented
+	V05 bool
 
 	// Stats reports whether the agent can receive client-computed stats on
 	// the /v0.6/stats endpoint.
@@ -273,26 +312,36 @@ func (f *agentFeatures) Store(newf agentFeatures) {
 }
 
 // loadAgentFeatures queries the trace-agent for its capabilities and updates
-// the tracer's behaviour.
+// the tracer's behaviour: the v0.5 trace format and the payload compression are
+// used when the agent supports them. Dropping P0 traces and computing stats in
+// the client are only enabled along with the "discovery" feature flag, as they
+// change the traces which are sent to the agent.
 func (t *tracer) loadAgentFeatures() {
-	if t.config.logToStdout {
+	if t.config.logToStdout || t.config.otlpEndpoint != "" {
 		// there is no agent
 		return
 	}
-	resp, err := http.Get(fmt.Sprintf("http://%s/info", t.config.agentAddr))
+	client := t.config.httpClient
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Get(fmt.Sprintf("http://%s/info", t.config.agentAddr))
 	if err != nil {
 		log.Error("Loading features: %v", err)
 		return
 	}
 	if resp.StatusCode == http.StatusNotFound {
 		// agent is older than 7.28.0, features not discoverable
+		resp.Body.Close()
 		t.features.Store(agentFeatures{})
+		t.negotiateCompression(nil)
 		return
 	}
 	defer resp.Body.Close()
 	type infoResponse struct {
-		Endpoints     []string `json:"endpoints"`
-		ClientDropP0s bool     `json:"client_drop_p0s"`
+		Endpoints        []string `json:"endpoints"`
+		ClientDropP0s    bool     `json:"client_drop_p0s"`
+		ContentEncodings []string `json:"content_encodings"`
 	}
 	var info infoResponse
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
@@ -308,7 +357,28 @@ func (t *tracer) loadAgentFeatures() {
 			f.V05 = true
 		}
 	}
+	if !t.config.HasFeature("discovery") {
+		f.DropP0s, f.Stats = false, false
+	}
 	t.features.Store(f)
+	t.negotiateCompression(info.ContentEncodings)
+}
+
+// negotiateCompression enables the configured payload compression if it is part
+// of the content encodings which the agent accepts.
+func (t *tracer) negotiateCompression(encodings []string) {
+	tr, ok := t.config.transport.(*httpTransport)
+	if !ok || t.config.compression == "" {
+		return
+	}
+	for _, enc := range encodings {
+		if enc == t.config.compression {
+			tr.setContentEncoding(enc)
+			return
+		}
+	}
+	log.Warn("Agent does not support %s compression, payloads will be sent uncompressed.", t.config.compression)
+	tr.setContentEncoding("")
 }
 
 // worker receives finished traces to be added into the payload, as well
@@ -373,10 +443,17 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 	} else {
 		startTime = opts.StartTime.UnixNano()
 	}
-	var context *spanContext
+	var context, baggage *spanContext
 	if opts.Parent != nil {
 		if ctx, ok := opts.Parent.(*spanContext); ok {
-			context = ctx
+			if ctx.traceID == 0 {
+				// the parent only carries baggage, e.g. it was extracted
+				// using the "baggage" propagation style alone; the span
+				// starts a new trace which inherits it
+				baggage = ctx
+			} else {
+				context = ctx
+			}
 		}
 	}
 	id := opts.SpanID
@@ -418,15 +495,35 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 		}
 	}
 	span.context = newSpanContext(span, context)
+	if baggage != nil {
+		baggage.ForeachBaggageItem(func(k, v string) bool {
+			span.context.setBaggageItem(k, v)
+			return true
+		})
+	}
+	if context == nil && t.config.traceID128BitEnabled {
+		// the upper 64 bits of a new 128-bit trace ID hold the start
+		// time in seconds, followed by 32 zero bits.
+		span.context.traceIDHigh = uint64(startTime/int64(time.Second)) << 32
+	}
 	if context == nil || context.span == nil {
 		// this is either a root span or it has a remote parent, we should add the PID.
 		span.setMeta(ext.Pid, t.pid)
+		if span.context.traceIDHigh != 0 {
+			// the upper bits of the trace ID are carried by the local root
+			span.setMeta(keyTraceID128, fmt.Sprintf("%016x", span.context.traceIDHigh))
+		}
 		if _, ok := opts.Tags[ext.ServiceName]; !ok && t.config.runtimeMetrics {
 			// this is a root span in the global service; runtime metrics should
 			// be linked to it:
 			span.setMeta("language", "go")
 		}
 	}
+	for _, ctx := range opts.Links {
+		if ctx != nil {
+			span.Links = append(span.Links, newSpanLink(ctx, nil))
+		}
+	}
 	// add tags from options
 	for k, v := range opts.Tags {
 		span.SetTag(k, v)
@@ -458,6 +555,10 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 func (t *tracer) Stop() {
 	t.stopOnce.Do(func() {
 		close(t.stop)
+		if tr, ok := t.config.transport.(*httpTransport); ok {
+			// give up on any pending retries
+			tr.close()
+		}
 		t.config.statsd.Incr("datadog.tracer.stopped", nil, 1)
 	})
 	t.stats.Stop()
@@ -468,6 +569,10 @@ func (t *tracer) Stop() {
 
 // Inject uses the configured or default TextMap Propagator.
 func (t *tracer) Inject(ctx ddtrace.SpanContext, carrier interface{}) error {
+	if c, ok := ctx.(*spanContext); ok && c.trace != nil {
+		// the sampling decision is about to leave the process
+		c.trace.setPropagated()
+	}
 	return t.config.propagator.Inject(ctx, carrier)
 }
 
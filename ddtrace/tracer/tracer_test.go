@@ -8,6 +8,7 @@ package tracer
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -126,6 +127,14 @@ func TestTracerStart(t *testing.T) {
 		}
 	})
 
+	t.Run("statsd", func(t *testing.T) {
+		Start()
+		tr, _ := internal.GetGlobalTracer().(*tracer)
+		assert.Equal(t, tr.config.statsd, globalconfig.Statsd())
+		Stop()
+		assert.Nil(t, globalconfig.Statsd())
+	})
+
 	t.Run("testing", func(t *testing.T) {
 		internal.Testing = true
 		Start()
@@ -522,6 +531,61 @@ func TestNewChildHasNoPid(t *testing.T) {
 	assert.Equal("", child.Meta[ext.Pid])
 }
 
+func TestTracer128BitTraceID(t *testing.T) {
+	t.Run("off", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDefaultTransport()))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.Zero(root.context.traceIDHigh)
+		assert.NotContains(root.Meta, keyTraceID128)
+		assert.Equal(fmt.Sprintf("%032x", root.TraceID), root.context.TraceID128())
+	})
+
+	t.Run("on", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDefaultTransport()), With128BitTraceIDs(true))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+
+		high := root.context.traceIDHigh
+		assert.NotZero(high)
+		assert.Zero(high & 0xffffffff)
+		assert.Equal(high, child.context.traceIDHigh)
+		assert.Equal(fmt.Sprintf("%016x", high), root.Meta[keyTraceID128])
+		assert.NotContains(child.Meta, keyTraceID128)
+		assert.Equal(fmt.Sprintf("%016x%016x", high, root.TraceID), child.context.TraceID128())
+		b := child.context.TraceID128Bytes()
+		assert.Equal(child.context.TraceID128(), fmt.Sprintf("%x", b[:]))
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED", "true")
+		defer os.Unsetenv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED")
+		tracer := newTracer(withTransport(newDefaultTransport()))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.NotZero(t, root.context.traceIDHigh)
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDefaultTransport()))
+		defer tracer.Stop()
+		sctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			traceTagsHeader:       "_dd.p.tid=640cfd8d00000000",
+		})
+		assert.Nil(err)
+		sp := tracer.StartSpan("web.request", ChildOf(sctx)).(*span)
+		assert.Equal(uint64(0x640cfd8d00000000), sp.context.traceIDHigh)
+		assert.Equal("640cfd8d00000000", sp.Meta[keyTraceID128])
+		assert.Equal("640cfd8d000000000000000000000001", sp.context.TraceID128())
+	})
+}
+
 func TestTracerSampler(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1031,6 +1095,71 @@ func TestTracerFlush(t *testing.T) {
 	})
 }
 
+func TestTracerCompressionNegotiation(t *testing.T) {
+	for name, tt := range map[string]struct {
+		compression string
+		info        string
+		want        string
+	}{
+		"gzip":        {compression: "gzip", info: `{"content_encodings":["gzip","zstd"]}`, want: "gzip"},
+		"unsupported": {compression: "gzip", info: `{"content_encodings":["zstd"]}`, want: ""},
+		"old-agent":   {compression: "gzip", info: `{"endpoints":["/v0.4/traces"]}`, want: ""},
+		"disabled":    {compression: "", info: `{"content_encodings":["gzip"]}`, want: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.info))
+			}))
+			defer srv.Close()
+			tracer := newUnstartedTracer(
+				WithAgentAddr(strings.TrimPrefix(srv.URL, "http://")),
+				WithCompression(tt.compression),
+				withStatsdClient(&testStatsdClient{}),
+			)
+			tracer.loadAgentFeatures()
+			assert.Equal(t, tt.want, tracer.config.transport.(*httpTransport).contentEncoding())
+		})
+	}
+
+	t.Run("features", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"endpoints":["/v0.5/traces","/v0.6/stats"],"client_drop_p0s":true,"content_encodings":["gzip"]}`))
+		}))
+		defer srv.Close()
+		addr := strings.TrimPrefix(srv.URL, "http://")
+
+		tracer := newUnstartedTracer(WithAgentAddr(addr), WithCompression("gzip"), withStatsdClient(&testStatsdClient{}))
+		tracer.loadAgentFeatures()
+		assert.Equal(t, "gzip", tracer.config.transport.(*httpTransport).contentEncoding())
+		f := tracer.features.Load()
+		assert.False(t, f.DropP0s)
+		assert.False(t, f.Stats)
+		assert.True(t, f.V05, "the v0.5 format should be used without the discovery feature flag")
+
+		tracer = newUnstartedTracer(WithAgentAddr(addr), WithCompression("gzip"), WithFeatureFlags("discovery"), withStatsdClient(&testStatsdClient{}))
+		tracer.loadAgentFeatures()
+		assert.Equal(t, "gzip", tracer.config.transport.(*httpTransport).contentEncoding())
+		f = tracer.features.Load()
+		assert.True(t, f.DropP0s)
+		assert.True(t, f.Stats)
+		assert.True(t, f.V05)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		c := newConfig(WithCompression("brotli"))
+		assert.Equal(t, "", c.compression)
+		c = newConfig(WithCompression("zstd"))
+		assert.Equal(t, "", c.compression)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("DD_TRACE_COMPRESSION", "GZIP")
+		defer os.Unsetenv("DD_TRACE_COMPRESSION")
+		c := newConfig()
+		assert.Equal(t, "gzip", c.compression)
+	})
+}
+
 func TestTracerReportsHostname(t *testing.T) {
 	const hostname = "hostname-test"
 
@@ -1291,6 +1420,9 @@ func (t *dummyTransport) endpoint() string {
 }
 
 func decode(p *payload) (spanLists, error) {
+	if p.strings != nil {
+		return decodeV05(p)
+	}
 	var traces spanLists
 	err := msgp.Decode(p, &traces)
 	return traces, err
@@ -15,11 +15,14 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	traceinternal "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
 
 	"github.com/tinylib/msgp/msgp"
@@ -56,6 +59,17 @@ const (
 	defaultAddress     = defaultHostname + ":" + defaultPort
 	defaultHTTPTimeout = 2 * time.Second         // defines the current timeout before giving up with the send process
 	traceCountHeader   = "X-Datadog-Trace-Count" // header containing the number of traces in the payload
+
+	// defaultSendAttempts is the default maximum number of attempts made to deliver
+	// a payload to the agent.
+	defaultSendAttempts = 3
+)
+
+var (
+	// sendRetryMinBackoff and sendRetryMaxBackoff bound the exponential backoff
+	// between two attempts to deliver a payload; replaced in tests.
+	sendRetryMinBackoff = 100 * time.Millisecond
+	sendRetryMaxBackoff = 2 * time.Second
 )
 
 // transport is an interface for communicating data to the agent.
@@ -70,10 +84,17 @@ type transport interface {
 }
 
 type httpTransport struct {
-	traceURL string            // the delivery URL for traces
-	statsURL string            // the delivery URL for stats
-	client   *http.Client      // the HTTP client used in the POST
-	headers  map[string]string // the Transport headers
+	traceURL    string            // the delivery URL for traces
+	traceV05URL string            // the delivery URL for traces using the v0.5 format
+	statsURL    string            // the delivery URL for stats
+	pipelineURL string            // the delivery URL for data streams stats
+	client      *http.Client      // the HTTP client used in the POST
+	headers     map[string]string // the Transport headers
+	maxAttempts int               // the maximum number of attempts made to deliver a payload
+	encoding    atomic.Value      // the content encoding (string) negotiated with the agent, if any
+
+	stop     chan struct{} // closed to abort any pending retries
+	stopOnce sync.Once     // guards closing stop
 }
 
 // newTransport returns a new Transport implementation that sends traces to a
@@ -102,55 +123,193 @@ func newHTTPTransport(addr string, client *http.Client) *httpTransport {
 		defaultHeaders["Datadog-Container-ID"] = cid
 	}
 	return &httpTransport{
-		traceURL: fmt.Sprintf("http://%s/v0.4/traces", resolveAddr(addr)),
-		statsURL: fmt.Sprintf("http://%s/v0.6/stats", resolveAddr(addr)),
-		client:   client,
-		headers:  defaultHeaders,
+		traceURL:    fmt.Sprintf("http://%s/v0.4/traces", resolveAddr(addr)),
+		traceV05URL: fmt.Sprintf("http://%s/v0.5/traces", resolveAddr(addr)),
+		statsURL:    fmt.Sprintf("http://%s/v0.6/stats", resolveAddr(addr)),
+		pipelineURL: fmt.Sprintf("http://%s/v0.1/pipeline_stats", resolveAddr(addr)),
+		client:      client,
+		headers:     defaultHeaders,
+		maxAttempts: defaultSendAttempts,
+		stop:        make(chan struct{}),
+	}
+}
+
+// retriableError is an error returned by the agent or the network which may
+// not occur again when retrying at a later time.
+type retriableError struct{ err error }
+
+// Error implements error.
+func (e *retriableError) Error() string { return e.err.Error() }
+
+// statusError is an error reported by the agent using the HTTP status code code.
+type statusError struct {
+	code int
+	err  error
+}
+
+// Error implements error.
+func (e *statusError) Error() string { return e.err.Error() }
+
+// isRetriableStatus reports whether a request rejected by the agent with the
+// given status code may succeed when retried at a later time.
+func isRetriableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// retry calls fn until it succeeds, fails with an error which is not retriable,
+// or the maximum number of attempts is reached. Attempts are separated by a capped
+// exponential backoff with full jitter. Retrying stops once the transport is closed.
+// Callers are expected to hold a connection slot (see concurrentConnectionLimit) for
+// the whole duration of the call, so that retries never open additional connections.
+func (t *httpTransport) retry(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		rerr, ok := err.(*retriableError)
+		if !ok {
+			return err
+		}
+		if attempt >= t.maxAttempts {
+			return rerr.err
+		}
+		backoff := sendRetryMaxBackoff
+		if attempt < 32 && sendRetryMinBackoff<<uint(attempt-1) < backoff {
+			backoff = sendRetryMinBackoff << uint(attempt-1)
+		}
+		wait := time.Duration(random.Int63n(int64(backoff) + 1))
+		log.Debug("Sending to the agent failed (attempt %d of %d), retrying in %s: %v", attempt, t.maxAttempts, wait, rerr.err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-t.stop:
+			timer.Stop()
+			return rerr.err
+		}
 	}
 }
 
+// setContentEncoding sets the encoding used to compress the payloads sent to the
+// agent. An empty value sends them uncompressed.
+func (t *httpTransport) setContentEncoding(enc string) {
+	t.encoding.Store(enc)
+}
+
+// contentEncoding returns the encoding used to compress the payloads sent to the
+// agent, or an empty string if they are sent uncompressed.
+func (t *httpTransport) contentEncoding() string {
+	enc, _ := t.encoding.Load().(string)
+	return enc
+}
+
+// close aborts any pending retries, causing them to return their last error.
+// Subsequent failed attempts are not retried.
+func (t *httpTransport) close() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
+
+// responseError returns an error describing the failure reported by the agent in
+// resp, if any. Timeouts, rate limiting and server errors are retriable. The response body
+// is closed when an error is returned.
+func responseError(resp *http.Response) error {
+	code := resp.StatusCode
+	if code < 400 {
+		return nil
+	}
+	// error, check the body for context information and
+	// return a nice error.
+	msg := make([]byte, 1000)
+	n, _ := resp.Body.Read(msg)
+	resp.Body.Close()
+	txt := http.StatusText(code)
+	err := &statusError{code: code}
+	if n > 0 {
+		err.err = fmt.Errorf("%s (Status: %s)", msg[:n], txt)
+	} else {
+		err.err = fmt.Errorf("%s", txt)
+	}
+	if isRetriableStatus(code) {
+		return &retriableError{err}
+	}
+	return err
+}
+
 func (t *httpTransport) sendStats(p *statsPayload) error {
 	var buf bytes.Buffer
 	if err := msgp.Encode(&buf, p); err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", t.statsURL, &buf)
-	if err != nil {
+	body := buf.Bytes()
+	enc := t.contentEncoding()
+	if enc != "" {
+		compressed, err := compress(enc, &buf)
+		if err != nil {
+			log.Warn("Compressing stats payload using %s failed, sending it uncompressed: %v", enc, err)
+			enc = ""
+		} else {
+			body = compressed
+		}
+	}
+	return t.retry(func() error {
+		req, err := http.NewRequest("POST", t.statsURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if enc != "" {
+			req.Header.Set("Content-Encoding", enc)
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return &retriableError{err}
+		}
+		if err := responseError(resp); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+// sendPipelineStats sends the given data streams stats payload to the agent. It is
+// always compressed using gzip, regardless of the negotiated content encoding.
+func (t *httpTransport) sendPipelineStats(p *datastreams.StatsPayload) error {
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, p); err != nil {
 		return err
 	}
-	resp, err := t.client.Do(req)
+	body, err := compress(encodingGzip, &buf)
 	if err != nil {
 		return err
 	}
-	if code := resp.StatusCode; code >= 400 {
-		// error, check the body for context information and
-		// return a nice error.
-		msg := make([]byte, 1000)
-		n, _ := resp.Body.Read(msg)
-		resp.Body.Close()
-		txt := http.StatusText(code)
-		if n > 0 {
-			return fmt.Errorf("%s (Status: %s)", msg[:n], txt)
+	return t.retry(func() error {
+		req, err := http.NewRequest("POST", t.pipelineURL, bytes.NewReader(body))
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("%s", txt)
-	}
-	return nil
+		for header, value := range t.headers {
+			req.Header.Set(header, value)
+		}
+		req.Header.Set("Content-Encoding", encodingGzip)
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return &retriableError{err}
+		}
+		if err := responseError(resp); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
 }
 
 func (t *httpTransport) send(p *payload) (body io.ReadCloser, err error) {
-	req, err := http.NewRequest("POST", t.traceURL, p)
-	if err != nil {
-		return nil, fmt.Errorf("cannot create http request: %v", err)
-	}
+	headers := make(map[string]string, len(t.headers)+5)
 	for header, value := range t.headers {
-		req.Header.Set(header, value)
+		headers[header] = value
 	}
-	req.Header.Set(traceCountHeader, strconv.Itoa(p.itemCount()))
-	req.Header.Set("Content-Length", strconv.Itoa(p.size()))
-	req.Header.Set(headerComputedTopLevel, "yes")
+	headers[traceCountHeader] = strconv.Itoa(p.itemCount())
+	headers[headerComputedTopLevel] = "yes"
 	if t, ok := traceinternal.GetGlobalTracer().(*tracer); ok {
 		if t.features.Load().Stats {
-			req.Header.Set("Datadog-Client-Computed-Stats", "yes")
+			headers["Datadog-Client-Computed-Stats"] = "yes"
 		}
 		droppedTraces := int(atomic.SwapUint64(&t.droppedP0Traces, 0))
 		droppedSpans := int(atomic.SwapUint64(&t.droppedP0Spans, 0))
@@ -158,27 +317,58 @@ func (t *httpTransport) send(p *payload) (body io.ReadCloser, err error) {
 			stats.Count("datadog.tracer.dropped_p0_traces", int64(droppedTraces), nil, 1)
 			stats.Count("datadog.tracer.dropped_p0_spans", int64(droppedSpans), nil, 1)
 		}
-		req.Header.Set("Datadog-Client-Dropped-P0-Traces", strconv.Itoa(droppedTraces))
-		req.Header.Set("Datadog-Client-Dropped-P0-Spans", strconv.Itoa(droppedSpans))
+		headers["Datadog-Client-Dropped-P0-Traces"] = strconv.Itoa(droppedTraces)
+		headers["Datadog-Client-Dropped-P0-Spans"] = strconv.Itoa(droppedSpans)
 	}
-	response, err := t.client.Do(req)
-	if err != nil {
-		return nil, err
+	url := t.traceURL
+	if p.strings != nil {
+		url = t.traceV05URL
+	}
+	var compressed []byte
+	if enc := t.contentEncoding(); enc != "" {
+		if compressed, err = compress(enc, p); err != nil {
+			log.Warn("Compressing payload using %s failed, sending it uncompressed: %v", enc, err)
+			compressed = nil
+		} else {
+			headers["Content-Encoding"] = enc
+		}
 	}
-	p.waitClose()
-	if code := response.StatusCode; code >= 400 {
-		// error, check the body for context information and
-		// return a nice error.
-		msg := make([]byte, 1000)
-		n, _ := response.Body.Read(msg)
-		response.Body.Close()
-		txt := http.StatusText(code)
-		if n > 0 {
-			return nil, fmt.Errorf("%s (Status: %s)", msg[:n], txt)
+	err = t.retry(func() error {
+		var (
+			r    io.Reader
+			size int
+		)
+		if compressed != nil {
+			r, size = bytes.NewReader(compressed), len(compressed)
+		} else {
+			p.rewind()
+			r, size = p, p.size()
 		}
-		return nil, fmt.Errorf("%s", txt)
+		req, err := http.NewRequest("POST", url, r)
+		if err != nil {
+			return fmt.Errorf("cannot create http request: %v", err)
+		}
+		for header, value := range headers {
+			req.Header.Set(header, value)
+		}
+		req.Header.Set("Content-Length", strconv.Itoa(size))
+		response, err := t.client.Do(req)
+		if err != nil {
+			return &retriableError{err}
+		}
+		if compressed == nil {
+			p.waitClose()
+		}
+		if err := responseError(response); err != nil {
+			return err
+		}
+		body = response.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return response.Body, nil
+	return body, nil
 }
 
 func (t *httpTransport) endpoint() string {
@@ -6,6 +6,8 @@
 package tracer
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -16,10 +18,15 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
 )
 
 // integration indicates if the test suite should run integration tests.
@@ -182,6 +189,245 @@ func TestTransportResponse(t *testing.T) {
 	}
 }
 
+func TestTransportRetry(t *testing.T) {
+	defer func(min, max time.Duration) {
+		sendRetryMinBackoff, sendRetryMaxBackoff = min, max
+	}(sendRetryMinBackoff, sendRetryMaxBackoff)
+	sendRetryMinBackoff, sendRetryMaxBackoff = time.Millisecond, 5*time.Millisecond
+
+	// newServer returns a server responding with the given status codes in order,
+	// and 200 once they are exhausted.
+	newServer := func(codes ...int) (*httptest.Server, *int32) {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			n := int(atomic.AddInt32(&hits, 1))
+			if n <= len(codes) {
+				w.WriteHeader(codes[n-1])
+			}
+		}))
+		return srv, &hits
+	}
+
+	for name, tt := range map[string]struct {
+		codes    []int
+		attempts int
+		hits     int32
+		err      string
+	}{
+		"recovers":    {codes: []int{503, 500}, attempts: 3, hits: 3},
+		"rate-limit":  {codes: []int{429, 429}, attempts: 2, hits: 2, err: "Too Many Requests"},
+		"timeout":     {codes: []int{408, 408}, attempts: 2, hits: 2, err: "Request Timeout"},
+		"client-err":  {codes: []int{400}, attempts: 3, hits: 1, err: "Bad Request"},
+		"no-retries":  {codes: []int{503}, attempts: 1, hits: 1, err: "Service Unavailable"},
+		"exhausted":   {codes: []int{502, 502, 502, 502}, attempts: 3, hits: 3, err: "Bad Gateway"},
+		"not-retried": {codes: []int{404, 503}, attempts: 3, hits: 1, err: "Not Found"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("traces", func(t *testing.T) {
+				assert := assert.New(t)
+				srv, hits := newServer(tt.codes...)
+				defer srv.Close()
+				transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+				transport.maxAttempts = tt.attempts
+				p, err := encode(getTestTrace(3, 2))
+				assert.NoError(err)
+				rc, err := transport.send(p)
+				assert.Equal(tt.hits, atomic.LoadInt32(hits))
+				if tt.err != "" {
+					assert.EqualError(err, tt.err)
+					return
+				}
+				assert.NoError(err)
+				rc.Close()
+			})
+
+			t.Run("stats", func(t *testing.T) {
+				srv, hits := newServer(tt.codes...)
+				defer srv.Close()
+				transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+				transport.maxAttempts = tt.attempts
+				err := transport.sendStats(&statsPayload{})
+				assert.Equal(t, tt.hits, atomic.LoadInt32(hits))
+				if tt.err != "" {
+					assert.EqualError(t, err, tt.err)
+					return
+				}
+				assert.NoError(t, err)
+			})
+		})
+	}
+
+	t.Run("body", func(t *testing.T) {
+		assert := assert.New(t)
+		var bodies [][]byte
+		var mu sync.Mutex
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			bodies = append(bodies, body)
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+		transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+		p, err := encode(getTestTrace(3, 2))
+		assert.NoError(err)
+		_, err = transport.send(p)
+		assert.NoError(err)
+		assert.Len(bodies, 2)
+		assert.NotEmpty(bodies[0])
+		assert.Equal(bodies[0], bodies[1])
+	})
+
+	t.Run("connection", func(t *testing.T) {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		addr := ln.Addr().String()
+		ln.Close() // nothing listens on addr anymore
+		transport := newHTTPTransport(addr, defaultClient)
+		_, err = transport.send(newPayload())
+		assert.Error(t, err)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		sendRetryMinBackoff, sendRetryMaxBackoff = time.Hour, time.Hour
+		defer func() {
+			sendRetryMinBackoff, sendRetryMaxBackoff = time.Millisecond, 5*time.Millisecond
+		}()
+		srv, hits := newServer(503, 503, 503)
+		defer srv.Close()
+		transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+		done := make(chan error)
+		go func() {
+			_, err := transport.send(newPayload())
+			done <- err
+		}()
+		for atomic.LoadInt32(hits) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		transport.close()
+		select {
+		case err := <-done:
+			assert.EqualError(t, err, "Service Unavailable")
+		case <-time.After(5 * time.Second):
+			t.Fatal("send did not give up after close")
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+}
+
+func TestTransportCompression(t *testing.T) {
+	// decompress returns the body of r, decompressed according to its Content-Encoding.
+	decompress := func(r *http.Request) ([]byte, error) {
+		switch enc := r.Header.Get("Content-Encoding"); enc {
+		case "":
+			return ioutil.ReadAll(r.Body)
+		case encodingGzip:
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.ReadAll(zr)
+		default:
+			return nil, fmt.Errorf("unexpected encoding %q", enc)
+		}
+	}
+
+	for _, enc := range []string{"", encodingGzip} {
+		t.Run(enc, func(t *testing.T) {
+			assert := assert.New(t)
+			var (
+				mu        sync.Mutex
+				encodings = make(map[string]string)
+				bodies    = make(map[string][]byte)
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := decompress(r)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				encodings[r.URL.Path] = r.Header.Get("Content-Encoding")
+				bodies[r.URL.Path] = body
+			}))
+			defer srv.Close()
+			transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+			transport.setContentEncoding(enc)
+
+			traces := getTestTrace(10, 10)
+			p, err := encode(traces)
+			assert.NoError(err)
+			_, err = transport.send(p)
+			assert.NoError(err)
+			assert.Equal(enc, encodings["/v0.4/traces"])
+			var got spanLists
+			assert.NoError(msgp.Decode(bytes.NewReader(bodies["/v0.4/traces"]), &got))
+			assert.Len(got, len(traces))
+
+			stats := &statsPayload{Hostname: "host", Env: "env", Version: "1.0"}
+			assert.NoError(transport.sendStats(stats))
+			assert.Equal(enc, encodings["/v0.6/stats"])
+			var gotStats statsPayload
+			assert.NoError(msgp.Decode(bytes.NewReader(bodies["/v0.6/stats"]), &gotStats))
+			assert.Equal(*stats, gotStats)
+
+			pipeline := &datastreams.StatsPayload{
+				Env:     "env",
+				Service: "service",
+				Stats: []datastreams.StatsBucket{{
+					Start:    10,
+					Duration: 10,
+					Stats: []datastreams.StatsPoint{{
+						EdgeTags:       []string{"direction:in"},
+						Hash:           2,
+						ParentHash:     1,
+						PathwayLatency: []byte{1},
+						EdgeLatency:    []byte{2},
+					}},
+				}},
+			}
+			assert.NoError(transport.sendPipelineStats(pipeline))
+			assert.Equal(encodingGzip, encodings["/v0.1/pipeline_stats"], "pipeline stats should always be compressed")
+			var gotPipeline datastreams.StatsPayload
+			assert.NoError(msgp.Decode(bytes.NewReader(bodies["/v0.1/pipeline_stats"]), &gotPipeline))
+			assert.Equal(*pipeline, gotPipeline)
+		})
+	}
+}
+
+func TestTransportV05(t *testing.T) {
+	assert := assert.New(t)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v0.5/traces" {
+			traces, err := decodeV05(r.Body)
+			assert.NoError(err)
+			assert.Len(traces, 2)
+		}
+	}))
+	defer srv.Close()
+	transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), defaultClient)
+
+	p, err := encode(getTestTrace(2, 2))
+	assert.NoError(err)
+	_, err = transport.send(p)
+	assert.NoError(err)
+
+	p = newPayloadV05()
+	for _, trace := range getTestTrace(2, 2) {
+		assert.NoError(p.push(trace))
+	}
+	_, err = transport.send(p)
+	assert.NoError(err)
+	assert.Equal([]string{"/v0.4/traces", "/v0.5/traces"}, paths)
+}
+
 func TestTraceCountHeader(t *testing.T) {
 	assert := assert.New(t)
 
@@ -46,15 +46,32 @@ type agentTraceWriter struct {
 	// prioritySampling is the prioritySampler into which agentTraceWriter will
 	// read sampling rates sent by the agent
 	prioritySampling *prioritySampler
+
+	// spill holds the payloads which failed to be sent, when enabled.
+	spill *spillQueue
+
+	// features holds the capabilities of the agent, which determine the
+	// format of new payloads. It may be nil.
+	features *agentFeatures
 }
 
 func newAgentTraceWriter(c *config, s *prioritySampler) *agentTraceWriter {
-	return &agentTraceWriter{
+	h := &agentTraceWriter{
 		config:           c,
 		payload:          newPayload(),
 		climit:           make(chan struct{}, concurrentConnectionLimit),
 		prioritySampling: s,
 	}
+	if c.spillDir != "" {
+		q, err := newSpillQueue(c)
+		if err != nil {
+			log.Warn("Spilling payloads to disk disabled: %v", err)
+		} else {
+			h.spill = q
+			q.start(h.replay)
+		}
+	}
+	return h
 }
 
 func (h *agentTraceWriter) add(trace []*span) {
@@ -72,6 +89,9 @@ func (h *agentTraceWriter) stop() {
 	h.config.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:shutdown"}, 1)
 	h.flush()
 	h.wg.Wait()
+	if h.spill != nil {
+		h.spill.close()
+	}
 }
 
 // flush will push any currently buffered traces to the server.
@@ -91,6 +111,14 @@ func (h *agentTraceWriter) flush() {
 		log.Debug("Sending payload: size: %d traces: %d\n", size, count)
 		rc, err := h.config.transport.send(p)
 		if err != nil {
+			if h.spill != nil && shouldSpill(err) {
+				serr := h.spill.spill(p)
+				if serr == nil {
+					log.Debug("Spilled %d traces to disk after send failure: %v", count, err)
+					return
+				}
+				log.Error("Spilling payload: %v", serr)
+			}
 			h.config.statsd.Count("datadog.tracer.traces_dropped", int64(count), []string{"reason:send_failed"}, 1)
 			log.Error("lost %d traces: %v", count, err)
 		} else {
@@ -99,9 +127,50 @@ func (h *agentTraceWriter) flush() {
 			if err := h.prioritySampling.readRatesJSON(rc); err != nil {
 				h.config.statsd.Incr("datadog.tracer.decode_error", nil, 1)
 			}
+			if h.spill != nil {
+				// the agent is reachable; replay anything left behind
+				h.spill.notify()
+			}
 		}
 	}(h.payload)
-	h.payload = newPayload()
+	h.payload = h.newPayload()
+}
+
+// newPayload returns a new payload, using the v0.5 format when the agent supports it.
+func (h *agentTraceWriter) newPayload() *payload {
+	if h.features != nil && h.features.Load().V05 {
+		return newPayloadV05()
+	}
+	return newPayload()
+}
+
+// shouldSpill reports whether a payload which could not be sent because of err
+// may be accepted by the agent at a later time. Payloads rejected by the agent
+// for any other reason than a timeout, rate limiting or a server error would be
+// rejected again.
+func shouldSpill(err error) bool {
+	switch e := err.(type) {
+	case *retriableError:
+		return shouldSpill(e.err)
+	case *statusError:
+		return isRetriableStatus(e.code)
+	}
+	// network error
+	return true
+}
+
+// replay sends a payload which was previously spilled to disk.
+func (h *agentTraceWriter) replay(p *payload) error {
+	h.climit <- struct{}{}
+	defer func() { <-h.climit }()
+	rc, err := h.config.transport.send(p)
+	if err != nil {
+		return err
+	}
+	if err := h.prioritySampling.readRatesJSON(rc); err != nil {
+		h.config.statsd.Incr("datadog.tracer.decode_error", nil, 1)
+	}
+	return nil
 }
 
 // logTraceWriter encodes traces into a format understood by the Datadog Forwarder
@@ -8,9 +8,11 @@ package tracer
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,6 +22,35 @@ import (
 func TestImplementsTraceWriter(t *testing.T) {
 	assert.Implements(t, (*traceWriter)(nil), &agentTraceWriter{})
 	assert.Implements(t, (*traceWriter)(nil), &logTraceWriter{})
+	assert.Implements(t, (*traceWriter)(nil), &otlpTraceWriter{})
+}
+
+func TestAgentTraceWriterV05(t *testing.T) {
+	assert := assert.New(t)
+	transport := newDummyTransport()
+	c := newConfig(withTransport(transport), withStatsdClient(&testStatsdClient{}))
+	h := newAgentTraceWriter(c, newPrioritySampler())
+	h.features = &agentFeatures{}
+
+	// payloads use the v0.4 format until the agent reports v0.5 support
+	assert.Nil(h.payload.strings)
+	h.add([]*span{makeSpan(1)})
+	h.flush()
+	h.wg.Wait()
+	assert.Nil(h.payload.strings)
+
+	h.features.Store(agentFeatures{V05: true})
+	h.add([]*span{makeSpan(2)})
+	h.flush()
+	h.wg.Wait()
+	assert.NotNil(h.payload.strings)
+	h.add([]*span{makeSpan(3), makeSpan(3)})
+	h.stop()
+
+	traces := transport.Traces()
+	assert.Len(traces, 3)
+	assert.Len(traces[2], 2)
+	assert.Len(traces[2][0].Meta, 3+len(makeSpan(0).Meta))
 }
 
 // makeSpan returns a span, adding n entries to meta and metrics each.
@@ -312,3 +343,23 @@ func BenchmarkJsonEncodeFloat(b *testing.B) {
 		encodeFloat(bs, float64(1e-9))
 	}
 }
+
+func TestShouldSpill(t *testing.T) {
+	for name, tt := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"network":     {err: errors.New("connection refused"), want: true},
+		"bad-request": {err: &statusError{code: http.StatusBadRequest, err: errors.New("Bad Request")}, want: false},
+		"too-large":   {err: &statusError{code: http.StatusRequestEntityTooLarge, err: errors.New("Request Entity Too Large")}, want: false},
+		"timeout":     {err: &statusError{code: http.StatusRequestTimeout, err: errors.New("Request Timeout")}, want: true},
+		"server": {
+			err:  &retriableError{&statusError{code: http.StatusServiceUnavailable, err: errors.New("Service Unavailable")}},
+			want: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, shouldSpill(tt.err))
+		})
+	}
+}
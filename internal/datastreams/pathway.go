@@ -0,0 +1,154 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package datastreams measures the latency of the messages flowing through data
+// pipelines, such as the ones built on top of Kafka. Each message carries a
+// pathway, which identifies the services and queues it went through along with
+// the times at which it entered the pipeline and at which it reached its last
+// checkpoint. The latencies observed at each checkpoint are aggregated and
+// periodically sent to the agent by the started tracer.
+package datastreams
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// PathwayHeader is the name of the message header carrying the encoded pathway.
+const PathwayHeader = "dd-pathway-ctx"
+
+// errInvalidPathway is returned when decoding a malformed pathway.
+var errInvalidPathway = errors.New("datastreams: invalid encoded pathway")
+
+// Pathway describes the path taken by a message through a data pipeline.
+type Pathway struct {
+	// Hash identifies the checkpoints the message went through, in order.
+	Hash uint64
+	// PathwayStart is the time at which the message entered the pipeline.
+	PathwayStart time.Time
+	// EdgeStart is the time at which the message reached its last checkpoint.
+	EdgeStart time.Time
+}
+
+// IsZero reports whether p is the zero Pathway, which belongs to messages which
+// did not go through any checkpoint yet.
+func (p Pathway) IsZero() bool {
+	return p.Hash == 0 && p.PathwayStart.IsZero() && p.EdgeStart.IsZero()
+}
+
+// Encode returns the binary encoding of p, made up of its hash followed by the
+// varint encoded start times, in milliseconds.
+func (p Pathway) Encode() []byte {
+	b := make([]byte, 8+2*binary.MaxVarintLen64)
+	binary.LittleEndian.PutUint64(b, p.Hash)
+	n := 8
+	n += binary.PutVarint(b[n:], toMillis(p.PathwayStart))
+	n += binary.PutVarint(b[n:], toMillis(p.EdgeStart))
+	return b[:n]
+}
+
+// Decode returns the pathway encoded in b by Encode.
+func Decode(b []byte) (Pathway, error) {
+	if len(b) < 8 {
+		return Pathway{}, errInvalidPathway
+	}
+	p := Pathway{Hash: binary.LittleEndian.Uint64(b)}
+	b = b[8:]
+	pathwayStart, n := binary.Varint(b)
+	if n <= 0 {
+		return Pathway{}, errInvalidPathway
+	}
+	edgeStart, m := binary.Varint(b[n:])
+	if m <= 0 {
+		return Pathway{}, errInvalidPathway
+	}
+	p.PathwayStart = fromMillis(pathwayStart)
+	p.EdgeStart = fromMillis(edgeStart)
+	return p, nil
+}
+
+// Carrier gives access to the headers of a message, such as the carriers used by
+// integrations to propagate span contexts.
+type Carrier interface {
+	ForeachKey(handler func(key, val string) error) error
+	Set(key, val string)
+}
+
+// ExtractPathway returns the pathway carried by c, or the zero Pathway if it
+// carries none.
+func ExtractPathway(c Carrier) Pathway {
+	var p Pathway
+	c.ForeachKey(func(key, val string) error {
+		if key == PathwayHeader {
+			p, _ = Decode([]byte(val))
+		}
+		return nil
+	})
+	return p
+}
+
+// InjectPathway sets the pathway carried by c to p.
+func InjectPathway(c Carrier, p Pathway) {
+	c.Set(PathwayHeader, string(p.Encode()))
+}
+
+type contextKey struct{}
+
+// ContextWithPathway returns a copy of ctx carrying p. It allows a pathway, such
+// as the one of a consumed message, to be continued by the messages produced while
+// processing it (see PathwayFromContext).
+func ContextWithPathway(ctx context.Context, p Pathway) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// PathwayFromContext returns the pathway carried by ctx, if any.
+func PathwayFromContext(ctx context.Context) (Pathway, bool) {
+	if ctx == nil {
+		return Pathway{}, false
+	}
+	p, ok := ctx.Value(contextKey{}).(Pathway)
+	return p, ok
+}
+
+// pathwayHash returns the hash of the checkpoint identified by the given service
+// and edge tags, following the checkpoint identified by parent. The edge tags
+// must be sorted.
+func pathwayHash(service string, edgeTags []string, parent uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(service))
+	for _, t := range edgeTags {
+		h.Write([]byte(t))
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], parent)
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// sortedTags returns a sorted copy of tags.
+func sortedTags(tags []string) []string {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,91 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathwayEncoding(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		start := time.Unix(1600000000, 123*int64(time.Millisecond))
+		p := Pathway{
+			Hash:         0xdeadbeef12345678,
+			PathwayStart: start,
+			EdgeStart:    start.Add(1500 * time.Millisecond),
+		}
+		decoded, err := Decode(p.Encode())
+		assert.NoError(t, err)
+		assert.Equal(t, p.Hash, decoded.Hash)
+		assert.True(t, p.PathwayStart.Equal(decoded.PathwayStart))
+		assert.True(t, p.EdgeStart.Equal(decoded.EdgeStart))
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		decoded, err := Decode(Pathway{}.Encode())
+		assert.NoError(t, err)
+		assert.True(t, decoded.IsZero())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, b := range [][]byte{nil, {1, 2, 3}, {1, 2, 3, 4, 5, 6, 7, 8}, {1, 2, 3, 4, 5, 6, 7, 8, 0x80}} {
+			_, err := Decode(b)
+			assert.Equal(t, errInvalidPathway, err)
+		}
+	})
+}
+
+func TestPathwayHash(t *testing.T) {
+	h := pathwayHash("service", []string{"direction:in", "topic:orders"}, 0)
+	assert.Equal(t, h, pathwayHash("service", []string{"direction:in", "topic:orders"}, 0))
+	assert.NotEqual(t, h, pathwayHash("other-service", []string{"direction:in", "topic:orders"}, 0))
+	assert.NotEqual(t, h, pathwayHash("service", []string{"direction:in", "topic:users"}, 0))
+	assert.NotEqual(t, h, pathwayHash("service", []string{"direction:in", "topic:orders"}, 1))
+}
+
+// mapCarrier is a Carrier holding headers in a map.
+type mapCarrier map[string]string
+
+func (c mapCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c mapCarrier) Set(key, val string) { c[key] = val }
+
+func TestPathwayPropagation(t *testing.T) {
+	c := mapCarrier{"other": "header"}
+	assert.True(t, ExtractPathway(c).IsZero())
+
+	start := time.Unix(1600000000, 0)
+	p := Pathway{Hash: 42, PathwayStart: start, EdgeStart: start}
+	InjectPathway(c, p)
+	assert.Len(t, c, 2)
+	extracted := ExtractPathway(c)
+	assert.Equal(t, uint64(42), extracted.Hash)
+	assert.True(t, start.Equal(extracted.EdgeStart))
+
+	c[PathwayHeader] = "garbage"
+	assert.True(t, ExtractPathway(c).IsZero())
+}
+
+func TestPathwayContext(t *testing.T) {
+	_, ok := PathwayFromContext(context.Background())
+	assert.False(t, ok)
+
+	p := Pathway{Hash: 42, PathwayStart: time.Unix(1600000000, 0)}
+	got, ok := PathwayFromContext(ContextWithPathway(context.Background(), p))
+	assert.True(t, ok)
+	assert.Equal(t, p, got)
+}
@@ -0,0 +1,54 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:generate msgp -unexported -marshal=false -o=payload_msgp.go -tests=false
+
+package datastreams
+
+// StatsPayload holds the stats computed at the checkpoints of the data pipelines
+// and is encoded to be sent to the agent.
+type StatsPayload struct {
+	// Env specifies the env. of the application, as defined by the user.
+	Env string
+
+	// Service specifies the service of the application.
+	Service string
+
+	// Stats holds all stats buckets computed within this payload.
+	Stats []StatsBucket
+
+	// TracerVersion specifies the version of the tracer which computed the stats.
+	TracerVersion string
+
+	// Lang specifies the language of the tracer which computed the stats.
+	Lang string
+}
+
+// StatsBucket specifies a set of stats computed over a duration.
+type StatsBucket struct {
+	// Start specifies the beginning of this bucket, in nanoseconds.
+	Start uint64
+
+	// Duration specifies the duration of this bucket, in nanoseconds.
+	Duration uint64
+
+	// Stats contains the stats computed at each checkpoint for the duration of
+	// this bucket.
+	Stats []StatsPoint
+}
+
+// StatsPoint contains the latencies observed at a checkpoint, preceded by the
+// checkpoint identified by ParentHash.
+type StatsPoint struct {
+	EdgeTags   []string
+	Hash       uint64
+	ParentHash uint64
+
+	// PathwayLatency and EdgeLatency hold the serialized sketches of the latencies,
+	// in seconds, since the messages entered the pipeline and since their previous
+	// checkpoint.
+	PathwayLatency []byte
+	EdgeLatency    []byte
+}
@@ -0,0 +1,333 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/DataDog/sketches-go/ddsketch"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultBucketSize specifies the span of time over which the latencies are
+// aggregated before being reported.
+var defaultBucketSize = (10 * time.Second).Nanoseconds()
+
+// staleOffsetAge is the duration after which the offsets which were not updated,
+// such as the ones of partitions revoked from a consumer group, are evicted.
+const staleOffsetAge = 5 * time.Minute
+
+var (
+	defaultProcessorOnce sync.Once
+	defaultProcessor     *processor
+
+	transportMu sync.RWMutex
+	transport   Transport // nil when the tracer is not started
+)
+
+// Transport sends the stats computed at the checkpoints to the agent.
+type Transport interface {
+	// SendPipelineStats sends the payload p to the agent.
+	SendPipelineStats(p *StatsPayload) error
+}
+
+// SetTransport sets the transport used to send the stats computed at the
+// checkpoints to the agent. It is called by the tracer when it starts, and with
+// nil when it stops, in which case the stats are discarded.
+func SetTransport(t Transport) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	transport = t
+}
+
+func getTransport() Transport {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	return transport
+}
+
+// Checkpoint records that a message coming from the given parent pathway, which
+// is the zero Pathway for messages entering the pipeline, went through the
+// checkpoint identified by edgeTags (e.g. "direction:in", "topic:orders",
+// "type:kafka"). It returns the pathway of the message, which must be propagated
+// along with it.
+func Checkpoint(parent Pathway, edgeTags ...string) Pathway {
+	return getProcessor().checkpoint(time.Now(), globalconfig.ServiceName(), parent, edgeTags)
+}
+
+// TrackKafkaCommitOffset records that the given consumer group committed offset,
+// which is the offset of the next message it will consume, on the partition of
+// topic. Along with TrackKafkaHighWatermarkOffset, it allows reporting the lag of
+// the consumer group.
+func TrackKafkaCommitOffset(group, topic string, partition int32, offset int64) {
+	getProcessor().trackOffset(time.Now(), partitionKey{group: group, topic: topic, partition: partition}, offset)
+}
+
+// TrackKafkaHighWatermarkOffset records that offset is the high watermark of the
+// partition of topic, that is the offset of the next message produced to it.
+func TrackKafkaHighWatermarkOffset(topic string, partition int32, offset int64) {
+	getProcessor().trackOffset(time.Now(), partitionKey{topic: topic, partition: partition}, offset)
+}
+
+// getProcessor returns the default processor, starting it on first use.
+func getProcessor() *processor {
+	defaultProcessorOnce.Do(func() {
+		defaultProcessor = newProcessor(defaultBucketSize)
+		go defaultProcessor.run(time.NewTicker(time.Duration(defaultBucketSize)).C)
+	})
+	return defaultProcessor
+}
+
+// statsKey specifies the checkpoint, and the one preceding it, under which
+// latencies are aggregated inside a bucket.
+type statsKey struct {
+	edgeTags   string // sorted, comma separated
+	hash       uint64
+	parentHash uint64
+}
+
+// edgeStats holds the latencies observed at a checkpoint.
+type edgeStats struct {
+	edgeLatency    *ddsketch.DDSketch
+	pathwayLatency *ddsketch.DDSketch
+}
+
+func newEdgeStats() *edgeStats {
+	const (
+		// relativeAccuracy is the value accuracy we have on the percentiles.
+		relativeAccuracy = 0.01
+		// maxNumBins is the maximum number of bins of the sketches.
+		maxNumBins = 2048
+	)
+	edgeSketch, err := ddsketch.LogCollapsingLowestDenseDDSketch(relativeAccuracy, maxNumBins)
+	if err != nil {
+		log.Error("Error when creating ddsketch: %v", err)
+	}
+	pathwaySketch, err := ddsketch.LogCollapsingLowestDenseDDSketch(relativeAccuracy, maxNumBins)
+	if err != nil {
+		log.Error("Error when creating ddsketch: %v", err)
+	}
+	return &edgeStats{
+		edgeLatency:    edgeSketch,
+		pathwayLatency: pathwaySketch,
+	}
+}
+
+// export returns the stats of the checkpoint k, with their sketches serialized.
+func (s *edgeStats) export(k statsKey) (StatsPoint, error) {
+	edgeLatency, err := proto.Marshal(s.edgeLatency.ToProto())
+	if err != nil {
+		return StatsPoint{}, err
+	}
+	pathwayLatency, err := proto.Marshal(s.pathwayLatency.ToProto())
+	if err != nil {
+		return StatsPoint{}, err
+	}
+	var edgeTags []string
+	if k.edgeTags != "" {
+		edgeTags = strings.Split(k.edgeTags, ",")
+	}
+	return StatsPoint{
+		EdgeTags:       edgeTags,
+		Hash:           k.hash,
+		ParentHash:     k.parentHash,
+		PathwayLatency: pathwayLatency,
+		EdgeLatency:    edgeLatency,
+	}, nil
+}
+
+// partitionKey identifies a Kafka partition and, for committed offsets, the
+// consumer group which committed them.
+type partitionKey struct {
+	group     string // empty for high watermarks
+	topic     string
+	partition int32
+}
+
+// trackedOffset holds an offset along with the time at which it was last updated.
+type trackedOffset struct {
+	offset  int64
+	updated time.Time
+}
+
+// processor aggregates the latencies observed at checkpoints in time buckets and
+// sends them to the agent once their bucket is complete. It also reports the lag of the
+// Kafka consumer groups.
+type processor struct {
+	mu         sync.Mutex
+	buckets    map[int64]map[statsKey]*edgeStats // keyed by bucket start, in nanoseconds
+	bucketSize int64                             // the size of a bucket in nanoseconds
+	offsets    map[partitionKey]trackedOffset    // latest committed offsets and high watermarks
+}
+
+func newProcessor(bucketSize int64) *processor {
+	return &processor{
+		buckets:    make(map[int64]map[statsKey]*edgeStats),
+		bucketSize: bucketSize,
+		offsets:    make(map[partitionKey]trackedOffset),
+	}
+}
+
+// run sends the complete buckets to the agent at each tick, and reports the lags.
+func (p *processor) run(tick <-chan time.Time) {
+	for now := range tick {
+		payload := p.flush(now)
+		if t := getTransport(); t != nil && len(payload.Stats) > 0 {
+			if err := t.SendPipelineStats(payload); err != nil {
+				log.Error("Error sending pipeline stats payload: %v", err)
+			}
+		}
+		// offsets are evicted even when the lags can not be reported
+		p.lags(now, func(k partitionKey, lag int64) {
+			if statsd := globalconfig.Statsd(); statsd != nil {
+				reportLag(statsd, k, lag)
+			}
+		})
+	}
+}
+
+// trackOffset records offset, at time now, as the latest one of k.
+func (p *processor) trackOffset(now time.Time, k partitionKey, offset int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.offsets[k] = trackedOffset{offset: offset, updated: now}
+}
+
+// lags calls fn with the lag of each consumer group on each partition it committed
+// offsets on, which is the number of messages separating its committed offset from
+// the high watermark of the partition. Partitions whose high watermark is unknown
+// are skipped. The offsets which were not updated for staleOffsetAge before time
+// now are evicted beforehand.
+func (p *processor) lags(now time.Time, fn func(k partitionKey, lag int64)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, o := range p.offsets {
+		if now.Sub(o.updated) > staleOffsetAge {
+			delete(p.offsets, k)
+		}
+	}
+	for k, committed := range p.offsets {
+		if k.group == "" {
+			continue
+		}
+		high, ok := p.offsets[partitionKey{topic: k.topic, partition: k.partition}]
+		if !ok {
+			continue
+		}
+		lag := high.offset - committed.offset
+		if lag < 0 {
+			// the high watermark was not updated since the commit
+			lag = 0
+		}
+		fn(k, lag)
+	}
+}
+
+// checkpoint records the checkpoint at time now of a message coming from parent
+// and returns its new pathway.
+func (p *processor) checkpoint(now time.Time, service string, parent Pathway, edgeTags []string) Pathway {
+	tags := sortedTags(edgeTags)
+	child := Pathway{
+		Hash:         pathwayHash(service, tags, parent.Hash),
+		PathwayStart: parent.PathwayStart,
+		EdgeStart:    now,
+	}
+	var edgeLatency time.Duration
+	if parent.PathwayStart.IsZero() {
+		child.PathwayStart = now
+	}
+	if !parent.EdgeStart.IsZero() {
+		edgeLatency = now.Sub(parent.EdgeStart)
+	}
+	key := statsKey{
+		edgeTags:   strings.Join(tags, ","),
+		hash:       child.Hash,
+		parentHash: parent.Hash,
+	}
+	p.add(now, key, edgeLatency, now.Sub(child.PathwayStart))
+	return child
+}
+
+// add adds the given latencies into the bucket covering time now.
+func (p *processor) add(now time.Time, k statsKey, edgeLatency, pathwayLatency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ts := now.UnixNano()
+	btime := ts - ts%p.bucketSize
+	b, ok := p.buckets[btime]
+	if !ok {
+		b = make(map[statsKey]*edgeStats)
+		p.buckets[btime] = b
+	}
+	s, ok := b[k]
+	if !ok {
+		s = newEdgeStats()
+		b[k] = s
+	}
+	// the clocks of the producers and consumers may not be in sync
+	s.edgeLatency.Add(positiveSeconds(edgeLatency))
+	s.pathwayLatency.Add(positiveSeconds(pathwayLatency))
+}
+
+// flush returns the stats of all the buckets which ended before time now, and
+// removes them.
+func (p *processor) flush(now time.Time) *StatsPayload {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ts := now.UnixNano()
+	payload := &StatsPayload{}
+	for btime, b := range p.buckets {
+		if btime > ts-p.bucketSize {
+			// do not flush the current bucket
+			continue
+		}
+		sb := StatsBucket{
+			Start:    uint64(btime),
+			Duration: uint64(p.bucketSize),
+			Stats:    make([]StatsPoint, 0, len(b)),
+		}
+		for k, s := range b {
+			point, err := s.export(k)
+			if err != nil {
+				log.Error("Could not export pipeline stats: %v.", err)
+				continue
+			}
+			sb.Stats = append(sb.Stats, point)
+		}
+		payload.Stats = append(payload.Stats, sb)
+		delete(p.buckets, btime)
+	}
+	return payload
+}
+
+// reportLag sends the lag of the consumer group on the partition identified by k
+// through statsd.
+func reportLag(statsd globalconfig.StatsdClient, k partitionKey, lag int64) {
+	tags := []string{
+		"group:" + k.group,
+		"topic:" + k.topic,
+		fmt.Sprintf("partition:%d", k.partition),
+		"type:kafka",
+	}
+	statsd.Gauge("datadog.tracer.data_streams.kafka.lag", float64(lag), tags, 1)
+}
+
+// positiveSeconds returns d in seconds, or zero if it is negative.
+func positiveSeconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return d.Seconds()
+}
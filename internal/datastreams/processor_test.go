@@ -0,0 +1,186 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
+
+	"github.com/DataDog/sketches-go/ddsketch/pb/sketchpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// testStatsdClient records the metrics it receives.
+type testStatsdClient struct {
+	gauges map[string]float64
+}
+
+func (c *testStatsdClient) Count(name string, value int64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *testStatsdClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	if c.gauges == nil {
+		c.gauges = make(map[string]float64)
+	}
+	c.gauges[name] = value
+	return nil
+}
+
+func (c *testStatsdClient) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	return nil
+}
+
+// testTransport records the payloads it sends.
+type testTransport struct {
+	payloads []*StatsPayload
+}
+
+func (t *testTransport) SendPipelineStats(p *StatsPayload) error {
+	t.payloads = append(t.payloads, p)
+	return nil
+}
+
+// assertSketch asserts that the serialized sketch b holds the given values.
+func assertSketch(t *testing.T, b []byte, values ...float64) {
+	want := newEdgeStats().edgeLatency
+	for _, v := range values {
+		want.Add(v)
+	}
+	var got sketchpb.DDSketch
+	if assert.NoError(t, proto.Unmarshal(b, &got)) {
+		assert.True(t, proto.Equal(want.ToProto(), &got), "got %v, want %v", &got, want.ToProto())
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	bucketSize := (10 * time.Second).Nanoseconds()
+	p := newProcessor(bucketSize)
+	start := time.Unix(1600000000, 0)
+
+	// a message is produced, then consumed twice by the same consumer group
+	produced := p.checkpoint(start, "producer", Pathway{}, []string{"type:kafka", "topic:orders", "direction:out"})
+	assert.Equal(t, start, produced.PathwayStart)
+	assert.Equal(t, start, produced.EdgeStart)
+	edgeTags := []string{"type:kafka", "topic:orders", "group:billing", "direction:in"}
+	consumed := p.checkpoint(start.Add(2*time.Second), "consumer", produced, edgeTags)
+	assert.Equal(t, start, consumed.PathwayStart)
+	assert.Equal(t, start.Add(2*time.Second), consumed.EdgeStart)
+	assert.NotEqual(t, produced.Hash, consumed.Hash)
+	again := p.checkpoint(start.Add(4*time.Second), "consumer", produced, edgeTags)
+	assert.Equal(t, consumed.Hash, again.Hash)
+
+	payload := p.flush(start.Add(5 * time.Second))
+	assert.Empty(t, payload.Stats, "the current bucket should not be flushed")
+
+	payload = p.flush(start.Add(10 * time.Second))
+	assert.Empty(t, p.buckets)
+	if !assert.Len(t, payload.Stats, 1) {
+		return
+	}
+	bucket := payload.Stats[0]
+	assert.Equal(t, uint64(start.UnixNano()), bucket.Start)
+	assert.Equal(t, uint64(bucketSize), bucket.Duration)
+	assert.Len(t, bucket.Stats, 2)
+	for _, point := range bucket.Stats {
+		switch point.Hash {
+		case produced.Hash:
+			assert.Equal(t, uint64(0), point.ParentHash)
+			assert.Equal(t, []string{"direction:out", "topic:orders", "type:kafka"}, point.EdgeTags)
+			assertSketch(t, point.EdgeLatency, 0)
+			assertSketch(t, point.PathwayLatency, 0)
+		case consumed.Hash:
+			assert.Equal(t, produced.Hash, point.ParentHash)
+			assert.Equal(t, []string{"direction:in", "group:billing", "topic:orders", "type:kafka"}, point.EdgeTags)
+			assertSketch(t, point.EdgeLatency, 2, 4)
+			assertSketch(t, point.PathwayLatency, 2, 4)
+		default:
+			t.Fatalf("unexpected checkpoint %016x", point.Hash)
+		}
+	}
+}
+
+func TestProcessorClockSkew(t *testing.T) {
+	p := newProcessor((10 * time.Second).Nanoseconds())
+	start := time.Unix(1600000000, 0)
+	produced := Pathway{Hash: 1, PathwayStart: start, EdgeStart: start}
+	p.checkpoint(start.Add(-time.Second), "consumer", produced, []string{"direction:in"})
+
+	payload := p.flush(start.Add(time.Minute))
+	if assert.Len(t, payload.Stats, 1) && assert.Len(t, payload.Stats[0].Stats, 1) {
+		assertSketch(t, payload.Stats[0].Stats[0].EdgeLatency, 0)
+	}
+}
+
+func TestProcessorRun(t *testing.T) {
+	p := newProcessor((10 * time.Second).Nanoseconds())
+	start := time.Unix(1600000000, 0)
+	p.checkpoint(start, "producer", Pathway{}, []string{"direction:out"})
+	p.trackOffset(start, partitionKey{group: "billing", topic: "orders"}, 10)
+	p.trackOffset(start, partitionKey{topic: "orders"}, 25)
+	run := func(now time.Time) {
+		tick := make(chan time.Time, 1)
+		tick <- now
+		close(tick)
+		p.run(tick)
+	}
+
+	t.Run("stopped", func(t *testing.T) {
+		run(start.Add(time.Minute))
+		assert.Empty(t, p.buckets, "the stats should be discarded")
+	})
+
+	t.Run("started", func(t *testing.T) {
+		var (
+			tt testTransport
+			tg testStatsdClient
+		)
+		SetTransport(&tt)
+		defer SetTransport(nil)
+		globalconfig.SetStatsd(&tg)
+		defer globalconfig.SetStatsd(nil)
+
+		run(start.Add(2 * time.Minute))
+		assert.Empty(t, tt.payloads, "empty payloads should not be sent")
+		assert.Equal(t, 15., tg.gauges["datadog.tracer.data_streams.kafka.lag"])
+
+		p.checkpoint(start.Add(2*time.Minute), "producer", Pathway{}, []string{"direction:out"})
+		run(start.Add(3 * time.Minute))
+		assert.Len(t, tt.payloads, 1)
+	})
+}
+
+func TestProcessorLags(t *testing.T) {
+	p := newProcessor((10 * time.Second).Nanoseconds())
+	now := time.Unix(1600000000, 0)
+	lags := func() map[partitionKey]int64 {
+		m := make(map[partitionKey]int64)
+		p.lags(now, func(k partitionKey, lag int64) { m[k] = lag })
+		return m
+	}
+	billing := partitionKey{group: "billing", topic: "orders", partition: 1}
+	shipping := partitionKey{group: "shipping", topic: "orders", partition: 1}
+
+	p.trackOffset(now, billing, 10)
+	assert.Empty(t, lags(), "the lag should not be reported without a high watermark")
+
+	p.trackOffset(now, partitionKey{topic: "orders", partition: 1}, 25)
+	p.trackOffset(now, shipping, 30)
+	assert.Equal(t, map[partitionKey]int64{billing: 15, shipping: 0}, lags())
+
+	now = now.Add(staleOffsetAge)
+	p.trackOffset(now, shipping, 35)
+	now = now.Add(time.Second)
+	assert.Equal(t, map[partitionKey]int64{}, lags(), "stale offsets should be evicted")
+	assert.Equal(t, map[partitionKey]trackedOffset{shipping: {offset: 35, updated: now.Add(-time.Second)}}, p.offsets)
+
+	var tg testStatsdClient
+	reportLag(&tg, billing, 15)
+	assert.Equal(t, 15., tg.gauges["datadog.tracer.data_streams.kafka.lag"])
+}
@@ -10,6 +10,7 @@ package globalconfig
 import (
 	"math"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -24,6 +25,14 @@ type config struct {
 	analyticsRate float64
 	serviceName   string
 	runtimeID     string
+	statsd        StatsdClient
+}
+
+// StatsdClient is the client used by the started tracer to send metrics to the agent.
+type StatsdClient interface {
+	Count(name string, value int64, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
 }
 
 // AnalyticsRate returns the sampling rate at which events should be marked. It uses
@@ -62,3 +71,18 @@ func RuntimeID() string {
 	defer cfg.mu.RUnlock()
 	return cfg.runtimeID
 }
+
+// Statsd returns the client used by the started tracer to send metrics, allowing
+// integrations to report their own. It returns nil when the tracer is not started.
+func Statsd() StatsdClient {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.statsd
+}
+
+// SetStatsd sets the client used by the started tracer to send metrics.
+func SetStatsd(c StatsdClient) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.statsd = c
+}